@@ -0,0 +1,520 @@
+// Package backup writes and restores a portable archive of a user's shelf.
+//
+// An archive is a gzipped tar holding a manifest and one JSON lines file per
+// record type. Backups and restores go through db.GoshelfQuerier, so they
+// work against Postgres or a remote server alike.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+const (
+	Format = "goshelf-backup"
+	// Bumped when the archive layout changes. Restore reads this version
+	// and older. Version 2 added series, reviews, notes, reading states,
+	// loans, locations and copies.
+	FormatVersion = 2
+	// The model version records are encoded with
+	SchemaVersion = "v1"
+
+	ManifestFile    = "manifest.json"
+	AuthorsFile     = "authors.jsonl"
+	BooksFile       = "books.jsonl"
+	CollectionsFile = "collections.jsonl"
+	MembershipsFile = "memberships.jsonl"
+	SeriesFile      = "series.jsonl"
+	ReviewsFile     = "reviews.jsonl"
+	NotesFile       = "notes.jsonl"
+	ReadingFile     = "reading.jsonl"
+	LoansFile       = "loans.jsonl"
+	LocationsFile   = "locations.jsonl"
+	CopiesFile      = "copies.jsonl"
+)
+
+// The files Backup writes, in archive order. Archives from older versions
+// have fewer; Read goes by the manifest.
+var dataFiles = []string{
+	AuthorsFile, BooksFile, CollectionsFile, MembershipsFile, SeriesFile,
+	ReviewsFile, NotesFile, ReadingFile, LoansFile, LocationsFile, CopiesFile,
+}
+
+type Manifest struct {
+	Format        string     `json:"format"`
+	FormatVersion int        `json:"formatVersion"`
+	SchemaVersion string     `json:"schemaVersion"`
+	CreatedTs     time.Time  `json:"createdTs"`
+	Files         []FileInfo `json:"files"`
+}
+
+type FileInfo struct {
+	Name    string `json:"name"`
+	Sha256  string `json:"sha256"`
+	Records int    `json:"records"`
+}
+
+// A book's membership in a collection. BookId is the id in the archive,
+// not the id a restore creates.
+type Membership struct {
+	Collection string  `json:"collection"`
+	BookId     int     `json:"bookId"`
+	Note       *string `json:"note,omitempty"`
+}
+
+// Collects JSON lines records for one archive file.
+type jsonLines struct {
+	buf     bytes.Buffer
+	records int
+}
+
+func (j *jsonLines) add(v interface{}) error {
+	line, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	j.buf.Write(line)
+	j.buf.WriteByte('\n')
+	j.records++
+
+	return nil
+}
+
+// Writes every book and collection visible to q to w, with the series,
+// loans, locations and copies visible to q. A book's reviews, notes and
+// reading state are only kept when they're its owner's, as restore
+// writes them as the restoring user, who owns the restored books. Only
+// the current reading state and active loans are kept, not their history.
+func Backup(q db.GoshelfQuerier, w io.Writer) error {
+	files := map[string]*jsonLines{}
+	for _, name := range dataFiles {
+		files[name] = &jsonLines{}
+	}
+
+	books, err := q.BookFilter(nil)
+
+	if err != nil {
+		return err
+	}
+
+	seenAuthors := map[int]bool{}
+
+	for _, b := range books {
+		if !seenAuthors[b.Author.AuthorId] {
+			seenAuthors[b.Author.AuthorId] = true
+
+			if err := files[AuthorsFile].add(b.Author); err != nil {
+				return err
+			}
+		}
+
+		if err := files[BooksFile].add(b); err != nil {
+			return err
+		}
+
+		if err := backupReading(q, &b, files); err != nil {
+			return err
+		}
+	}
+
+	if err := backupInventory(q, files); err != nil {
+		return err
+	}
+
+	collections, err := q.CollectionList(nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, c := range collections {
+		title := c.Title
+		full, err := q.CollectionGet(&title)
+
+		if err != nil {
+			return err
+		}
+
+		if full == nil {
+			// Removed since listing
+			continue
+		}
+
+		// A smart collection's books are matches, not members
+		if full.Smart {
+			full.Books = nil
+		}
+
+		notes := map[int]*string{}
+
+		for _, e := range full.Entries {
+			notes[e.BookId] = e.Note
+		}
+
+		// In collection order, which restore keeps
+		for _, b := range full.Books {
+			err := files[MembershipsFile].add(Membership{Collection: full.Title, BookId: b.BookId, Note: notes[b.BookId]})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		full.Books = nil
+
+		if err := files[CollectionsFile].add(full); err != nil {
+			return err
+		}
+	}
+
+	manifest := Manifest{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		SchemaVersion: SchemaVersion,
+		CreatedTs:     time.Now().UTC(),
+		Files:         make([]FileInfo, 0, len(dataFiles)),
+	}
+
+	for _, name := range dataFiles {
+		sum := sha256.Sum256(files[name].buf.Bytes())
+		manifest.Files = append(manifest.Files, FileInfo{
+			Name:    name,
+			Sha256:  hex.EncodeToString(sum[:]),
+			Records: files[name].records,
+		})
+	}
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: manifest.CreatedTs,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tw.Write(data)
+
+		return err
+	}
+
+	// The manifest comes first so readers can check the version early
+	if err := write(ManifestFile, manifestJson); err != nil {
+		return err
+	}
+
+	for _, name := range dataFiles {
+		if err := write(name, files[name].buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// Adds the owner's review, notes and reading state of b to files.
+func backupReading(q db.GoshelfQuerier, b *v1.Book, files map[string]*jsonLines) error {
+	reviews, err := q.ReviewList(b.BookId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reviews {
+		if r.UserId == b.OwnerId {
+			if err := files[ReviewsFile].add(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	notes, err := q.NoteList(b.BookId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notes {
+		if n.UserId == b.OwnerId {
+			if err := files[NotesFile].add(n); err != nil {
+				return err
+			}
+		}
+	}
+
+	state, err := q.BookProgressGet(b.BookId)
+
+	if err != nil || state == nil || state.UserId != b.OwnerId {
+		return err
+	}
+
+	state.History = nil
+
+	return files[ReadingFile].add(state)
+}
+
+// Adds the series, active loans, locations and copies visible to q to
+// files. Series memberships are kept on the books.
+func backupInventory(q db.GoshelfQuerier, files map[string]*jsonLines) error {
+	series, err := q.SeriesList()
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range series {
+		s.Entries = nil
+
+		if err := files[SeriesFile].add(s); err != nil {
+			return err
+		}
+	}
+
+	loans, err := q.LoanList(&v1.LoanFilter{Active: true})
+
+	if err != nil {
+		return err
+	}
+
+	for _, l := range loans {
+		if err := files[LoansFile].add(l); err != nil {
+			return err
+		}
+	}
+
+	// Sorted by path, so parents come before the locations inside them
+	locations, err := q.LocationList()
+
+	if err != nil {
+		return err
+	}
+
+	for _, l := range locations {
+		if err := files[LocationsFile].add(l); err != nil {
+			return err
+		}
+	}
+
+	copies, err := q.CopyList(nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, c := range copies {
+		c.Moves = nil
+
+		if err := files[CopiesFile].add(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The contents of a verified archive.
+type Archive struct {
+	Manifest    Manifest
+	Authors     []v1.Author
+	Books       []v1.Book
+	Collections []v1.Collection
+	Memberships []Membership
+	Series      []v1.Series
+	Reviews     []v1.Review
+	Notes       []v1.Note
+	Reading     []v1.ReadingState
+	Loans       []v1.Loan
+	Locations   []v1.Location
+	Copies      []v1.Copy
+}
+
+// Reads an archive from r, checking its format version and checksums.
+func Read(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	contents := map[string][]byte{}
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("not a backup archive: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		contents[header.Name] = data
+	}
+
+	manifestJson, ok := contents[ManifestFile]
+
+	if !ok {
+		return nil, errors.New("not a backup archive: missing " + ManifestFile)
+	}
+
+	archive := &Archive{}
+
+	if err := json.Unmarshal(manifestJson, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	manifest := &archive.Manifest
+
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a backup archive: format %q", manifest.Format)
+	}
+
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.FormatVersion)
+	}
+
+	if manifest.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %q", manifest.SchemaVersion)
+	}
+
+	for _, info := range manifest.Files {
+		data, ok := contents[info.Name]
+
+		if !ok {
+			return nil, fmt.Errorf("archive is missing %s", info.Name)
+		}
+
+		sum := sha256.Sum256(data)
+
+		if hex.EncodeToString(sum[:]) != info.Sha256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", info.Name)
+		}
+	}
+
+	decoders := map[string]func(*json.Decoder) error{
+		AuthorsFile: func(d *json.Decoder) error {
+			var a v1.Author
+			err := d.Decode(&a)
+			archive.Authors = append(archive.Authors, a)
+			return err
+		},
+		BooksFile: func(d *json.Decoder) error {
+			var b v1.Book
+			err := d.Decode(&b)
+			archive.Books = append(archive.Books, b)
+			return err
+		},
+		CollectionsFile: func(d *json.Decoder) error {
+			var c v1.Collection
+			err := d.Decode(&c)
+			archive.Collections = append(archive.Collections, c)
+			return err
+		},
+		MembershipsFile: func(d *json.Decoder) error {
+			var m Membership
+			err := d.Decode(&m)
+			archive.Memberships = append(archive.Memberships, m)
+			return err
+		},
+		SeriesFile: func(d *json.Decoder) error {
+			var s v1.Series
+			err := d.Decode(&s)
+			archive.Series = append(archive.Series, s)
+			return err
+		},
+		ReviewsFile: func(d *json.Decoder) error {
+			var r v1.Review
+			err := d.Decode(&r)
+			archive.Reviews = append(archive.Reviews, r)
+			return err
+		},
+		NotesFile: func(d *json.Decoder) error {
+			var n v1.Note
+			err := d.Decode(&n)
+			archive.Notes = append(archive.Notes, n)
+			return err
+		},
+		ReadingFile: func(d *json.Decoder) error {
+			var s v1.ReadingState
+			err := d.Decode(&s)
+			archive.Reading = append(archive.Reading, s)
+			return err
+		},
+		LoansFile: func(d *json.Decoder) error {
+			var l v1.Loan
+			err := d.Decode(&l)
+			archive.Loans = append(archive.Loans, l)
+			return err
+		},
+		LocationsFile: func(d *json.Decoder) error {
+			var l v1.Location
+			err := d.Decode(&l)
+			archive.Locations = append(archive.Locations, l)
+			return err
+		},
+		CopiesFile: func(d *json.Decoder) error {
+			var c v1.Copy
+			err := d.Decode(&c)
+			archive.Copies = append(archive.Copies, c)
+			return err
+		},
+	}
+
+	for _, info := range manifest.Files {
+		decode, ok := decoders[info.Name]
+
+		if !ok {
+			// Unknown files are checksummed but otherwise ignored
+			continue
+		}
+
+		d := json.NewDecoder(bytes.NewReader(contents[info.Name]))
+
+		for i := 0; i < info.Records; i++ {
+			if err := decode(d); err != nil {
+				return nil, fmt.Errorf("%s record %d: %w", info.Name, i+1, err)
+			}
+		}
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,312 @@
+package backup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBackup(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Backup Suite")
+}
+
+// In-memory querier holding books and collections. Unimplemented methods
+// panic through the nil embedded interface.
+type mockShelf struct {
+	db.GoshelfQuerier
+	books       []v1.Book
+	collections []v1.Collection
+	series      []v1.Series
+	reviews     []v1.Review
+	notes       []v1.Note
+	states      []v1.ReadingState
+	loans       []v1.Loan
+	locations   []v1.Location
+	copies      []v1.Copy
+}
+
+func (m *mockShelf) BookCreate(b *v1.Book) (*int, error) {
+	book := *b
+	book.BookId = len(m.books) + 100
+	book.Author.AuthorId = len(m.books) + 100
+	if book.WorkId == 0 {
+		book.WorkId = book.BookId + 1000
+	}
+	m.books = append(m.books, book)
+
+	return &book.BookId, nil
+}
+
+func (m *mockShelf) BookGet(id int) (*v1.Book, error) {
+	for i := range m.books {
+		if m.books[i].BookId == id {
+			return &m.books[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *mockShelf) BookFilter(filter *v1.BookFilter) ([]v1.Book, error) {
+	books := make([]v1.Book, 0)
+
+	for _, b := range m.books {
+		if filter != nil && filter.TitleExact != nil && !strings.EqualFold(b.Title, *filter.TitleExact) {
+			continue
+		}
+
+		if filter == nil || filter.Title == nil || strings.Contains(b.Title, *filter.Title) {
+			books = append(books, b)
+		}
+	}
+
+	return books, nil
+}
+
+func (m *mockShelf) CollectionList(title *string) ([]v1.Collection, error) {
+	cols := make([]v1.Collection, 0)
+
+	for _, c := range m.collections {
+		c.Books = nil
+		cols = append(cols, c)
+	}
+
+	return cols, nil
+}
+
+func (m *mockShelf) collection(title string) *v1.Collection {
+	for i := range m.collections {
+		if m.collections[i].Title == title {
+			return &m.collections[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *mockShelf) CollectionGet(title *string) (*v1.Collection, error) {
+	c := m.collection(*title)
+
+	if c == nil {
+		return nil, nil
+	}
+
+	ret := *c
+	ret.Books = append([]v1.Book{}, c.Books...)
+
+	return &ret, nil
+}
+
+func (m *mockShelf) CollectionCreate(title *string, bookIds []int) (*string, error) {
+	m.collections = append(m.collections, v1.Collection{CollectionId: len(m.collections) + 1, Title: *title})
+
+	return title, m.CollectionAddBooks(title, bookIds)
+}
+
+func (m *mockShelf) CollectionCreateSmart(title *string, filter *v1.BookFilter) (*string, error) {
+	m.collections = append(m.collections, v1.Collection{CollectionId: len(m.collections) + 1, Title: *title, Smart: true, Filter: filter})
+
+	return title, nil
+}
+
+func (m *mockShelf) CollectionAddBooks(title *string, bookIds []int) error {
+	c := m.collection(*title)
+
+	for _, id := range bookIds {
+		for _, b := range m.books {
+			if b.BookId == id {
+				c.Books = append(c.Books, b)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *mockShelf) CollectionSetNote(title *string, bookId int, note *string) error {
+	c := m.collection(*title)
+	c.Entries = append(c.Entries, v1.CollectionEntry{BookId: bookId, Note: note})
+
+	return nil
+}
+
+func (m *mockShelf) CollectionSetParent(title *string, parent *string) error {
+	m.collection(*title).Parent = parent
+
+	return nil
+}
+
+func (m *mockShelf) CollectionUpdate(id int, u *v1.CollectionUpdate) (*v1.Collection, error) {
+	for i := range m.collections {
+		if m.collections[i].CollectionId == id {
+			m.collections[i].Description = u.Description
+			m.collections[i].CoverUrl = u.CoverUrl
+
+			return &m.collections[i], nil
+		}
+	}
+
+	return nil, errors.New("collection not found")
+}
+
+func (m *mockShelf) CollectionSetPublic(title *string, public bool) error {
+	m.collection(*title).Public = public
+
+	return nil
+}
+
+func (m *mockShelf) SeriesList() ([]v1.Series, error) {
+	return append([]v1.Series{}, m.series...), nil
+}
+
+func (m *mockShelf) SeriesCreate(s *v1.Series) (*int, error) {
+	series := *s
+	series.SeriesId = len(m.series) + 1
+	m.series = append(m.series, series)
+
+	return &series.SeriesId, nil
+}
+
+func (m *mockShelf) SeriesSetBook(seriesId int, bookId int, position float64) error {
+	for _, s := range m.series {
+		if s.SeriesId == seriesId {
+			b, _ := m.BookGet(bookId)
+			b.Series = &v1.BookSeries{SeriesId: seriesId, Name: s.Name, Position: position}
+
+			return nil
+		}
+	}
+
+	return errors.New("series not found")
+}
+
+func (m *mockShelf) ReviewList(bookId int) ([]v1.Review, error) {
+	reviews := make([]v1.Review, 0)
+
+	for _, r := range m.reviews {
+		if r.BookId == bookId {
+			reviews = append(reviews, r)
+		}
+	}
+
+	return reviews, nil
+}
+
+func (m *mockShelf) ReviewSet(r *v1.Review) (*v1.Review, error) {
+	for i := range m.reviews {
+		if m.reviews[i].BookId == r.BookId {
+			m.reviews[i] = *r
+
+			return r, nil
+		}
+	}
+
+	m.reviews = append(m.reviews, *r)
+
+	return r, nil
+}
+
+func (m *mockShelf) NoteList(bookId int) ([]v1.Note, error) {
+	notes := make([]v1.Note, 0)
+
+	for _, n := range m.notes {
+		if n.BookId == bookId {
+			notes = append(notes, n)
+		}
+	}
+
+	return notes, nil
+}
+
+func (m *mockShelf) NoteCreate(n *v1.Note) (*int, error) {
+	note := *n
+	note.NoteId = len(m.notes) + 1
+	m.notes = append(m.notes, note)
+
+	return &note.NoteId, nil
+}
+
+func (m *mockShelf) BookProgressGet(bookId int) (*v1.ReadingState, error) {
+	for i := range m.states {
+		if m.states[i].BookId == bookId {
+			state := m.states[i]
+
+			return &state, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *mockShelf) BookProgressUpdate(bookId int, u *v1.ProgressUpdate) (*v1.ReadingState, error) {
+	state := v1.ReadingState{BookId: bookId, Status: *u.Status, Page: u.Page, FinishedTs: u.FinishedTs}
+	m.states = append(m.states, state)
+
+	return &state, nil
+}
+
+func (m *mockShelf) LoanList(filter *v1.LoanFilter) ([]v1.Loan, error) {
+	loans := make([]v1.Loan, 0)
+
+	for _, l := range m.loans {
+		if filter.BookId == nil || l.BookId == *filter.BookId {
+			loans = append(loans, l)
+		}
+	}
+
+	return loans, nil
+}
+
+func (m *mockShelf) LoanCreate(l *v1.Loan) (*int, error) {
+	loan := *l
+	loan.LoanId = len(m.loans) + 1
+	m.loans = append(m.loans, loan)
+
+	return &loan.LoanId, nil
+}
+
+func (m *mockShelf) LocationList() ([]v1.Location, error) {
+	return append([]v1.Location{}, m.locations...), nil
+}
+
+func (m *mockShelf) LocationCreate(l *v1.Location) (*int, error) {
+	location := *l
+	location.LocationId = len(m.locations) + 1
+	location.Path = l.Name
+
+	for _, p := range m.locations {
+		if l.ParentId != nil && p.LocationId == *l.ParentId {
+			location.Path = p.Path + "/" + l.Name
+		}
+	}
+
+	m.locations = append(m.locations, location)
+
+	return &location.LocationId, nil
+}
+
+func (m *mockShelf) CopyList(filter *v1.CopyFilter) ([]v1.Copy, error) {
+	copies := make([]v1.Copy, 0)
+
+	for _, c := range m.copies {
+		if filter == nil || filter.BookId == nil || c.BookId == *filter.BookId {
+			copies = append(copies, c)
+		}
+	}
+
+	return copies, nil
+}
+
+func (m *mockShelf) CopyCreate(c *v1.Copy) (*int, error) {
+	copy := *c
+	copy.CopyId = len(m.copies) + 1
+	m.copies = append(m.copies, copy)
+
+	return &copy.CopyId, nil
+}
@@ -0,0 +1,327 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backup", func() {
+	var source *mockShelf
+
+	BeforeEach(func() {
+		author := v1.Author{AuthorId: 1, FirstName: "Frank", LastName: "Herbert"}
+		dune := v1.Book{BookId: 1, Title: "Dune", Author: author}
+		messiah := v1.Book{BookId: 2, Title: "Dune Messiah", Author: author}
+
+		source = &mockShelf{
+			books: []v1.Book{dune, messiah},
+			collections: []v1.Collection{
+				{Title: "scifi", Public: true, Books: []v1.Book{dune, messiah}},
+				{Title: "empty"},
+			},
+		}
+	})
+
+	backup := func() []byte {
+		var buf bytes.Buffer
+		Expect(Backup(source, &buf)).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("writes a manifest with record counts", func() {
+		archive, err := Read(bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(archive.Manifest.FormatVersion).To(Equal(FormatVersion))
+		Expect(archive.Manifest.Files).To(HaveLen(len(dataFiles)))
+		Expect(archive.Authors).To(HaveLen(1))
+		Expect(archive.Books).To(HaveLen(2))
+		Expect(archive.Collections).To(HaveLen(2))
+		Expect(archive.Memberships).To(ConsistOf(
+			Membership{Collection: "scifi", BookId: 1},
+			Membership{Collection: "scifi", BookId: 2},
+		))
+	})
+
+	It("restores into an empty shelf with remapped ids", func() {
+		target := &mockShelf{}
+
+		report, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Errors).To(BeEmpty())
+		Expect(report.BooksCreated).To(Equal(2))
+		Expect(report.CollectionsCreated).To(Equal(2))
+		Expect(report.Memberships).To(Equal(2))
+
+		scifi := target.collection("scifi")
+		Expect(scifi.Public).To(BeTrue())
+		Expect(scifi.Books).To(HaveLen(2))
+		Expect(scifi.Books[0].BookId).To(Equal(target.books[0].BookId))
+	})
+
+	It("does not duplicate books when restored twice", func() {
+		archive := backup()
+		target := &mockShelf{}
+
+		_, err := Restore(target, bytes.NewReader(archive))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := Restore(target, bytes.NewReader(archive))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.BooksCreated).To(Equal(0))
+		Expect(report.BooksExisting).To(Equal(2))
+		Expect(target.books).To(HaveLen(2))
+	})
+
+	It("keeps editions of a work together", func() {
+		translationOf := 1
+		source.books[0].WorkId = 7
+		source.books = append(source.books, v1.Book{
+			BookId:        3,
+			WorkId:        7,
+			Title:         "Der Wüstenplanet",
+			Author:        source.books[0].Author,
+			TranslationOf: &translationOf,
+		})
+
+		target := &mockShelf{}
+
+		_, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target.books).To(HaveLen(3))
+
+		dune, translation := target.books[0], target.books[2]
+		Expect(translation.WorkId).To(Equal(dune.WorkId))
+		Expect(*translation.TranslationOf).To(Equal(dune.BookId))
+		Expect(target.books[1].WorkId).ToNot(Equal(dune.WorkId))
+	})
+
+	It("keeps collection order and notes", func() {
+		note := "Start here"
+		source.collections[0].Books = []v1.Book{source.books[1], source.books[0]}
+		source.collections[0].Entries = []v1.CollectionEntry{{BookId: 2, Position: 1, Note: &note}, {BookId: 1, Position: 2}}
+
+		target := &mockShelf{}
+
+		_, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+
+		scifi := target.collection("scifi")
+		Expect(scifi.Books[0].Title).To(Equal("Dune Messiah"))
+		Expect(scifi.Entries).To(HaveLen(1))
+		Expect(scifi.Entries[0].BookId).To(Equal(scifi.Books[0].BookId))
+		Expect(*scifi.Entries[0].Note).To(Equal(note))
+	})
+
+	It("restores nested collections under their parents", func() {
+		parent := "scifi"
+		source.collections[1].Parent = &parent
+
+		target := &mockShelf{}
+
+		report, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Errors).To(BeEmpty())
+		Expect(*target.collection("empty").Parent).To(Equal("scifi"))
+	})
+
+	It("restores collection descriptions and covers", func() {
+		description, cover := "Desert planets", "https://covers.example/dune.jpg"
+		source.collections[0].Description = &description
+		source.collections[0].CoverUrl = &cover
+
+		target := &mockShelf{}
+
+		report, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Errors).To(BeEmpty())
+		Expect(*target.collection("scifi").Description).To(Equal(description))
+		Expect(*target.collection("scifi").CoverUrl).To(Equal(cover))
+		Expect(target.collection("empty").Description).To(BeNil())
+	})
+
+	It("restores smart collections as filters", func() {
+		title := "Dune"
+		source.collections = append(source.collections, v1.Collection{
+			Title:  "dune",
+			Smart:  true,
+			Filter: &v1.BookFilter{Title: &title},
+			Books:  source.books,
+		})
+
+		archive, err := Read(bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(archive.Memberships).To(HaveLen(2))
+
+		target := &mockShelf{}
+
+		_, err = Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+
+		dune := target.collection("dune")
+		Expect(dune.Smart).To(BeTrue())
+		Expect(*dune.Filter.Title).To(Equal("Dune"))
+		Expect(dune.Books).To(BeEmpty())
+	})
+
+	It("drops series and works that weren't restored from smart filters", func() {
+		seriesId, workId := 9, 8
+		source.collections = append(source.collections, v1.Collection{
+			Title:  "saga",
+			Smart:  true,
+			Filter: &v1.BookFilter{SeriesId: &seriesId, WorkId: &workId},
+		})
+
+		target := &mockShelf{}
+
+		report, err := Restore(target, bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Errors).To(ConsistOf(
+			"collection saga: work 8 was not restored, removed from the filter",
+			"collection saga: series 9 was not restored, removed from the filter",
+		))
+
+		saga := target.collection("saga")
+		Expect(saga.Filter.SeriesId).To(BeNil())
+		Expect(saga.Filter.WorkId).To(BeNil())
+	})
+
+	Context("with reading data and inventory", func() {
+		BeforeEach(func() {
+			rating, page, price := 4.5, 12, 9.99
+			seriesId, studyId, shelfId := 3, 1, 2
+			source.books[0].OwnerId = 5
+			source.books[1].OwnerId = 5
+			source.books[1].Series = &v1.BookSeries{SeriesId: 3, Name: "Dune", Position: 2}
+			source.series = []v1.Series{{SeriesId: 3, Name: "Dune"}}
+			source.collections = append(source.collections, v1.Collection{
+				Title:  "dune-series",
+				Smart:  true,
+				Filter: &v1.BookFilter{SeriesId: &seriesId},
+			})
+			source.reviews = []v1.Review{
+				{BookId: 1, UserId: 5, Rating: &rating},
+				{BookId: 1, UserId: 6, Rating: &rating},
+			}
+			source.notes = []v1.Note{{NoteId: 1, BookId: 1, UserId: 5, Page: &page, Body: "Fear is the mind-killer"}}
+			source.states = []v1.ReadingState{{BookId: 2, UserId: 5, Status: v1.ReadingStatusReading, Page: &page}}
+			source.loans = []v1.Loan{{LoanId: 1, BookId: 2, Borrower: "Chani"}}
+			source.locations = []v1.Location{
+				{LocationId: 1, Name: "study", Path: "study"},
+				{LocationId: 2, ParentId: &studyId, Name: "shelf", Path: "study/shelf"},
+			}
+			source.copies = []v1.Copy{{CopyId: 1, BookId: 1, Price: &price, LocationId: &shelfId, LocationPath: "study/shelf"}}
+		})
+
+		It("restores them remapped to the restored books", func() {
+			target := &mockShelf{}
+
+			report, err := Restore(target, bytes.NewReader(backup()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Errors).To(BeEmpty())
+
+			dune, messiah := target.books[0], target.books[1]
+			Expect(messiah.Series.SeriesId).To(Equal(target.series[0].SeriesId))
+			Expect(messiah.Series.Position).To(Equal(2.0))
+			Expect(*target.collection("dune-series").Filter.SeriesId).To(Equal(target.series[0].SeriesId))
+
+			// Only the owner's review is kept
+			Expect(target.reviews).To(HaveLen(1))
+			Expect(target.reviews[0].BookId).To(Equal(dune.BookId))
+			Expect(*target.reviews[0].Rating).To(Equal(4.5))
+
+			Expect(target.notes).To(HaveLen(1))
+			Expect(target.notes[0].BookId).To(Equal(dune.BookId))
+			Expect(target.states).To(HaveLen(1))
+			Expect(target.states[0].BookId).To(Equal(messiah.BookId))
+			Expect(*target.states[0].Page).To(Equal(12))
+			Expect(target.loans).To(HaveLen(1))
+			Expect(target.loans[0].BookId).To(Equal(messiah.BookId))
+
+			Expect(target.locations).To(HaveLen(2))
+			Expect(target.locations[1].Path).To(Equal("study/shelf"))
+			Expect(target.copies).To(HaveLen(1))
+			Expect(target.copies[0].BookId).To(Equal(dune.BookId))
+			Expect(*target.copies[0].LocationId).To(Equal(target.locations[1].LocationId))
+		})
+
+		It("does not duplicate them when restored twice", func() {
+			archive := backup()
+			target := &mockShelf{}
+
+			_, err := Restore(target, bytes.NewReader(archive))
+			Expect(err).ToNot(HaveOccurred())
+
+			report, err := Restore(target, bytes.NewReader(archive))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Errors).To(BeEmpty())
+			Expect(report.SeriesCreated + report.Notes + report.ReadingStates + report.Loans).To(BeZero())
+			Expect(report.LocationsCreated + report.CopiesCreated).To(BeZero())
+			Expect(target.series).To(HaveLen(1))
+			Expect(target.notes).To(HaveLen(1))
+			Expect(target.states).To(HaveLen(1))
+			Expect(target.loans).To(HaveLen(1))
+			Expect(target.locations).To(HaveLen(2))
+			Expect(target.copies).To(HaveLen(1))
+		})
+	})
+
+	It("rejects a tampered archive", func() {
+		// Rewrite the archive with a changed books file
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		src, err := gzip.NewReader(bytes.NewReader(backup()))
+		Expect(err).ToNot(HaveOccurred())
+		tr := tar.NewReader(src)
+
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := io.ReadAll(tr)
+			Expect(err).ToNot(HaveOccurred())
+
+			if header.Name == BooksFile {
+				data = bytes.Replace(data, []byte("Dune"), []byte("Tune"), 1)
+			}
+
+			header.Size = int64(len(data))
+			Expect(tw.WriteHeader(header)).To(Succeed())
+			_, err = tw.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		_, err = Read(&buf)
+		Expect(err).To(MatchError(ContainSubstring("checksum mismatch")))
+	})
+
+	It("rejects archives from a newer version", func() {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		manifest := []byte(`{"format":"goshelf-backup","formatVersion":99,"schemaVersion":"v1"}`)
+		Expect(tw.WriteHeader(&tar.Header{Name: ManifestFile, Mode: 0600, Size: int64(len(manifest))})).To(Succeed())
+		_, err := tw.Write(manifest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+
+		_, err = Read(&buf)
+		Expect(err).To(MatchError(ContainSubstring("unsupported backup version")))
+	})
+})
@@ -0,0 +1,522 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/bookcsv"
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The outcome of a restore. Books and collections that already exist are
+// reused rather than duplicated, so restoring an archive twice is safe.
+type RestoreReport struct {
+	BooksCreated       int      `json:"booksCreated"`
+	BooksExisting      int      `json:"booksExisting"`
+	CollectionsCreated int      `json:"collectionsCreated"`
+	Memberships        int      `json:"memberships"`
+	SeriesCreated      int      `json:"seriesCreated"`
+	Reviews            int      `json:"reviews"`
+	Notes              int      `json:"notes"`
+	ReadingStates      int      `json:"readingStates"`
+	Loans              int      `json:"loans"`
+	LocationsCreated   int      `json:"locationsCreated"`
+	CopiesCreated      int      `json:"copiesCreated"`
+	Errors             []string `json:"errors"`
+}
+
+// Restores the archive in r through q. Restored books are owned by q's
+// user and get new ids; memberships, series, reviews, notes, reading
+// states, loans and copies are remapped to them. Per-record failures are
+// reported and the rest of the archive still restored.
+func Restore(q db.GoshelfQuerier, r io.Reader) (*RestoreReport, error) {
+	archive, err := Read(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{Errors: make([]string, 0)}
+
+	// Archive book id -> restored book id
+	bookIds := map[int]int{}
+	// Archive work id -> restored work id
+	workIds := map[int]int{}
+
+	for _, b := range archive.Books {
+		existing, err := bookcsv.FindExisting(q, &b)
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("book %d: %s", b.BookId, err))
+			continue
+		}
+
+		if existing != nil {
+			bookIds[b.BookId] = existing.BookId
+			if _, ok := workIds[b.WorkId]; !ok && b.WorkId != 0 {
+				workIds[b.WorkId] = existing.WorkId
+			}
+
+			report.BooksExisting++
+			continue
+		}
+
+		// Editions of the same archive work share a restored work, and
+		// translations link to restored editions
+		book := b
+		book.WorkId = workIds[b.WorkId]
+		book.TranslationOf = nil
+
+		if b.TranslationOf != nil {
+			if id, ok := bookIds[*b.TranslationOf]; ok {
+				book.TranslationOf = &id
+			}
+		}
+
+		id, err := q.BookCreate(&book)
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("book %d: %s", b.BookId, err))
+			continue
+		}
+
+		bookIds[b.BookId] = *id
+		report.BooksCreated++
+
+		if _, ok := workIds[b.WorkId]; !ok && b.WorkId != 0 {
+			created, err := q.BookGet(*id)
+
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("book %d: %s", b.BookId, err))
+				continue
+			}
+
+			if created != nil {
+				workIds[b.WorkId] = created.WorkId
+			}
+		}
+	}
+
+	seriesIds := restoreSeries(q, archive, bookIds, report)
+	restoreReading(q, archive, bookIds, report)
+	restoreInventory(q, archive, bookIds, report)
+
+	members := map[string][]int{}
+	notes := map[string]map[int]*string{}
+
+	for _, m := range archive.Memberships {
+		id, ok := bookIds[m.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors,
+				fmt.Sprintf("collection %s: book %d was not restored", m.Collection, m.BookId))
+			continue
+		}
+
+		members[m.Collection] = append(members[m.Collection], id)
+
+		if m.Note != nil {
+			if notes[m.Collection] == nil {
+				notes[m.Collection] = map[int]*string{}
+			}
+
+			notes[m.Collection][id] = m.Note
+		}
+	}
+
+	for _, c := range archive.Collections {
+		title := c.Title
+
+		existing, err := q.CollectionGet(&title)
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("collection %s: %s", title, err))
+			continue
+		}
+
+		if existing == nil && c.Filter != nil {
+			// Work and series ids change on restore. Ones that weren't
+			// restored would match another shelf's books, so they're
+			// dropped from the filter.
+			if c.Filter.WorkId != nil {
+				if workId, ok := workIds[*c.Filter.WorkId]; ok {
+					c.Filter.WorkId = &workId
+				} else {
+					report.Errors = append(report.Errors,
+						fmt.Sprintf("collection %s: work %d was not restored, removed from the filter", title, *c.Filter.WorkId))
+					c.Filter.WorkId = nil
+				}
+			}
+
+			if c.Filter.SeriesId != nil {
+				if seriesId, ok := seriesIds[*c.Filter.SeriesId]; ok {
+					c.Filter.SeriesId = &seriesId
+				} else {
+					report.Errors = append(report.Errors,
+						fmt.Sprintf("collection %s: series %d was not restored, removed from the filter", title, *c.Filter.SeriesId))
+					c.Filter.SeriesId = nil
+				}
+			}
+
+			_, err = q.CollectionCreateSmart(&title, c.Filter)
+
+			if err == nil {
+				report.CollectionsCreated++
+			}
+		} else if existing == nil {
+			_, err = q.CollectionCreate(&title, members[title])
+
+			if err == nil {
+				report.CollectionsCreated++
+			}
+		} else {
+			err = q.CollectionAddBooks(&title, members[title])
+		}
+
+		if err == nil && c.Public {
+			err = q.CollectionSetPublic(&title, true)
+		}
+
+		if err == nil && (c.Description != nil || c.CoverUrl != nil) {
+			err = restoreCollectionMetadata(q, &c)
+		}
+
+		for bookId, note := range notes[title] {
+			if err == nil {
+				err = q.CollectionSetNote(&title, bookId, note)
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("collection %s: %s", title, err))
+			continue
+		}
+
+		report.Memberships += len(members[title])
+	}
+
+	// Once every collection exists, so parents can be listed after children
+	for _, c := range archive.Collections {
+		if c.Parent == nil {
+			continue
+		}
+
+		title := c.Title
+
+		if err := q.CollectionSetParent(&title, c.Parent); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("collection %s: %s", title, err))
+		}
+	}
+
+	return report, nil
+}
+
+// Sets the description and cover of the collection restored from c. Ids
+// aren't kept across restores, so the collection is found by title.
+func restoreCollectionMetadata(q db.GoshelfQuerier, c *v1.Collection) error {
+	restored, err := q.CollectionGet(&c.Title)
+
+	if err != nil {
+		return err
+	}
+
+	if restored == nil {
+		return fmt.Errorf("collection %s was not restored", c.Title)
+	}
+
+	_, err = q.CollectionUpdate(restored.CollectionId, &v1.CollectionUpdate{
+		Description: c.Description,
+		CoverUrl:    c.CoverUrl,
+	})
+
+	return err
+}
+
+// Restores the archive's series, reusing existing ones with the same
+// name, and puts the restored books back in them. Returns the restored
+// id of each archive series.
+func restoreSeries(q db.GoshelfQuerier, archive *Archive, bookIds map[int]int, report *RestoreReport) map[int]int {
+	seriesIds := map[int]int{}
+
+	if len(archive.Series) == 0 {
+		return seriesIds
+	}
+
+	existing, err := q.SeriesList()
+
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("series: %s", err))
+		return seriesIds
+	}
+
+	byName := map[string]int{}
+	for _, s := range existing {
+		byName[s.Name] = s.SeriesId
+	}
+
+	for _, s := range archive.Series {
+		if id, ok := byName[s.Name]; ok {
+			seriesIds[s.SeriesId] = id
+			continue
+		}
+
+		series := v1.Series{Name: s.Name, Description: s.Description}
+		id, err := q.SeriesCreate(&series)
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("series %s: %s", s.Name, err))
+			continue
+		}
+
+		seriesIds[s.SeriesId] = *id
+		byName[s.Name] = *id
+		report.SeriesCreated++
+	}
+
+	for _, b := range archive.Books {
+		if b.Series == nil {
+			continue
+		}
+
+		bookId, ok := bookIds[b.BookId]
+		seriesId, found := seriesIds[b.Series.SeriesId]
+
+		if !ok || !found {
+			continue
+		}
+
+		if err := q.SeriesSetBook(seriesId, bookId, b.Series.Position); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("series %s: book %d: %s", b.Series.Name, b.BookId, err))
+		}
+	}
+
+	return seriesIds
+}
+
+// Restores reviews, notes and reading states as q's user. Notes and
+// states already on the shelf aren't written again.
+func restoreReading(q db.GoshelfQuerier, archive *Archive, bookIds map[int]int, report *RestoreReport) {
+	for _, r := range archive.Reviews {
+		bookId, ok := bookIds[r.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("review: book %d was not restored", r.BookId))
+			continue
+		}
+
+		if _, err := q.ReviewSet(&v1.Review{BookId: bookId, Rating: r.Rating, Body: r.Body}); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("review: book %d: %s", r.BookId, err))
+			continue
+		}
+
+		report.Reviews++
+	}
+
+	for _, n := range archive.Notes {
+		bookId, ok := bookIds[n.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("note %d: book %d was not restored", n.NoteId, n.BookId))
+			continue
+		}
+
+		existing, err := q.NoteList(bookId)
+
+		if err == nil && !hasNote(existing, &n) {
+			note := v1.Note{BookId: bookId, Page: n.Page, Highlight: n.Highlight, Body: n.Body}
+			_, err = q.NoteCreate(&note)
+
+			if err == nil {
+				report.Notes++
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("note %d: %s", n.NoteId, err))
+		}
+	}
+
+	for _, s := range archive.Reading {
+		bookId, ok := bookIds[s.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("reading state: book %d was not restored", s.BookId))
+			continue
+		}
+
+		existing, err := q.BookProgressGet(bookId)
+
+		if err == nil && (existing == nil || existing.Status != s.Status) {
+			status := s.Status
+			_, err = q.BookProgressUpdate(bookId, &v1.ProgressUpdate{
+				Status:     &status,
+				Page:       s.Page,
+				Percent:    s.Percent,
+				StartedTs:  s.StartedTs,
+				FinishedTs: s.FinishedTs,
+			})
+
+			if err == nil {
+				report.ReadingStates++
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("reading state: book %d: %s", s.BookId, err))
+		}
+	}
+}
+
+func hasNote(notes []v1.Note, n *v1.Note) bool {
+	for _, e := range notes {
+		if e.Body == n.Body && reflect.DeepEqual(e.Page, n.Page) && reflect.DeepEqual(e.Highlight, n.Highlight) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Restores active loans, locations and copies. Locations are reused by
+// path, and books already on loan or with a matching copy are skipped.
+func restoreInventory(q db.GoshelfQuerier, archive *Archive, bookIds map[int]int, report *RestoreReport) {
+	for _, l := range archive.Loans {
+		bookId, ok := bookIds[l.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("loan %d: book %d was not restored", l.LoanId, l.BookId))
+			continue
+		}
+
+		active, err := q.LoanList(&v1.LoanFilter{BookId: &bookId, Active: true})
+
+		if err == nil && len(active) == 0 {
+			loan := v1.Loan{BookId: bookId, Borrower: l.Borrower, DueTs: l.DueTs, Note: l.Note}
+			_, err = q.LoanCreate(&loan)
+
+			if err == nil {
+				report.Loans++
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("loan %d: %s", l.LoanId, err))
+		}
+	}
+
+	locationIds := map[int]int{}
+
+	if len(archive.Locations) > 0 {
+		locationIds = restoreLocations(q, archive, report)
+	}
+
+	for _, c := range archive.Copies {
+		bookId, ok := bookIds[c.BookId]
+
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("copy %d: book %d was not restored", c.CopyId, c.BookId))
+			continue
+		}
+
+		restored := v1.Copy{BookId: bookId, Condition: c.Condition, AcquiredTs: c.AcquiredTs, Price: c.Price}
+
+		if c.LocationId != nil {
+			locationId, ok := locationIds[*c.LocationId]
+
+			if !ok {
+				report.Errors = append(report.Errors,
+					fmt.Sprintf("copy %d: location %s was not restored", c.CopyId, c.LocationPath))
+				continue
+			}
+
+			restored.LocationId = &locationId
+		}
+
+		existing, err := q.CopyList(&v1.CopyFilter{BookId: &bookId})
+
+		if err == nil && !hasCopy(existing, &restored) {
+			_, err = q.CopyCreate(&restored)
+
+			if err == nil {
+				report.CopiesCreated++
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("copy %d: %s", c.CopyId, err))
+		}
+	}
+}
+
+// Restores the archive's locations, parents first, reusing existing ones
+// with the same path. Returns the restored id of each archive location.
+func restoreLocations(q db.GoshelfQuerier, archive *Archive, report *RestoreReport) map[int]int {
+	locationIds := map[int]int{}
+
+	existing, err := q.LocationList()
+
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("locations: %s", err))
+		return locationIds
+	}
+
+	byPath := map[string]int{}
+	for _, l := range existing {
+		byPath[l.Path] = l.LocationId
+	}
+
+	locations := append([]v1.Location{}, archive.Locations...)
+	sort.SliceStable(locations, func(i, j int) bool { return locations[i].Path < locations[j].Path })
+
+	for _, l := range locations {
+		if id, ok := byPath[l.Path]; ok {
+			locationIds[l.LocationId] = id
+			continue
+		}
+
+		location := v1.Location{Name: l.Name, Kind: l.Kind}
+
+		if l.ParentId != nil {
+			parentId, ok := locationIds[*l.ParentId]
+
+			if !ok {
+				report.Errors = append(report.Errors, fmt.Sprintf("location %s: its parent was not restored", l.Path))
+				continue
+			}
+
+			location.ParentId = &parentId
+		}
+
+		id, err := q.LocationCreate(&location)
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("location %s: %s", l.Path, err))
+			continue
+		}
+
+		locationIds[l.LocationId] = *id
+		byPath[l.Path] = *id
+		report.LocationsCreated++
+	}
+
+	return locationIds
+}
+
+func hasCopy(copies []v1.Copy, c *v1.Copy) bool {
+	for _, e := range copies {
+		if reflect.DeepEqual(e.Condition, c.Condition) && reflect.DeepEqual(e.Price, c.Price) &&
+			reflect.DeepEqual(e.LocationId, c.LocationId) && equalTime(e.AcquiredTs, c.AcquiredTs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equalTime(a *time.Time, b *time.Time) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+}
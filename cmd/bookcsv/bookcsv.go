@@ -0,0 +1,328 @@
+// Package bookcsv reads and writes books as CSV for importing and
+// exporting shelves.
+package bookcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// A v1.Book (or v1.Author) field a CSV column can map to.
+type Field string
+
+const (
+	FieldTitle           Field = "title"
+	FieldAuthor          Field = "author"  // Full name, "First Last" or "Last, First"
+	FieldAuthors         Field = "authors" // Comma separated "First Last" names, the first is used
+	FieldAuthorFirstName Field = "authorFirstName"
+	FieldAuthorLastName  Field = "authorLastName"
+	FieldPublishDate     Field = "publishDate"
+	FieldEdition         Field = "edition"
+	FieldDescription     Field = "description"
+	FieldGenre           Field = "genre"
+	FieldIsbn            Field = "isbn" // ISBN-10 or ISBN-13, stored as ISBN-13
+)
+
+// Maps normalized header names (see normalizeHeader) to fields. Columns
+// not listed are ignored.
+type Columns map[string]Field
+
+var DefaultColumns = Columns{
+	"title":           FieldTitle,
+	"author":          FieldAuthor,
+	"authorfirstname": FieldAuthorFirstName,
+	"firstname":       FieldAuthorFirstName,
+	"authorlastname":  FieldAuthorLastName,
+	"lastname":        FieldAuthorLastName,
+	"publishdate":     FieldPublishDate,
+	"published":       FieldPublishDate,
+	"edition":         FieldEdition,
+	"description":     FieldDescription,
+	"genre":           FieldGenre,
+	"isbn":            FieldIsbn,
+	"isbn13":          FieldIsbn,
+	"isbn10":          FieldIsbn,
+}
+
+// The header written by Write, readable with DefaultColumns.
+var ExportHeader = []string{
+	"title",
+	"author_first_name",
+	"author_last_name",
+	"publish_date",
+	"edition",
+	"description",
+	"genre",
+	"isbn13",
+}
+
+// A parsed CSV row. Line is the 1-based line in the file (the header is
+// line 1).
+type Row struct {
+	Line   int
+	Book   v1.Book
+	Fields map[string]string // Raw values by normalized header, for importers needing other columns
+}
+
+type RowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Lowercases a header and strips everything but letters and digits, so
+// "Author First Name" and "author_first_name" both map to
+// "authorfirstname".
+func normalizeHeader(h string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(strings.TrimSpace(h)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// Reads books from CSV with a header row, mapping columns to fields with
+// columns. Rows that cannot be parsed are returned as errors rather than
+// failing the whole read.
+func Read(r io.Reader, columns Columns) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil, nil, errors.New("csv is empty")
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := make([]string, len(header))
+	mapped := false
+
+	for i, h := range header {
+		headers[i] = normalizeHeader(h)
+		if _, ok := columns[headers[i]]; ok {
+			mapped = true
+		}
+	}
+
+	if !mapped {
+		return nil, nil, errors.New("csv header has no recognized columns")
+	}
+
+	rows := make([]Row, 0)
+	rowErrors := make([]RowError, 0)
+	line := 1
+
+	for {
+		record, err := reader.Read()
+		line++
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+
+		row := Row{Line: line, Fields: map[string]string{}}
+
+		for i, v := range record {
+			if i < len(headers) {
+				row.Fields[headers[i]] = strings.TrimSpace(v)
+			}
+		}
+
+		if err := fillBook(&row.Book, headers, row.Fields, columns); err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+// Sets b's fields from values. Headers are applied in file order, so a
+// later non-empty column mapping to the same field wins.
+func fillBook(b *v1.Book, headers []string, values map[string]string, columns Columns) error {
+	for _, header := range headers {
+		field, ok := columns[header]
+		v := unwrapFormula(values[header])
+
+		if !ok || v == "" {
+			continue
+		}
+
+		switch field {
+		case FieldTitle:
+			b.Title = v
+		case FieldAuthor:
+			b.Author.FirstName, b.Author.LastName = SplitAuthorName(v)
+		case FieldAuthors:
+			// Only one author is stored, see the design doc
+			first, _, _ := strings.Cut(v, ",")
+			b.Author.FirstName, b.Author.LastName = SplitAuthorName(first)
+		case FieldAuthorFirstName:
+			b.Author.FirstName = v
+		case FieldAuthorLastName:
+			b.Author.LastName = v
+		case FieldPublishDate:
+			date, err := ParseDate(v)
+
+			if err != nil {
+				return err
+			}
+
+			b.PublishDate = date
+		case FieldEdition:
+			edInt64, err := strconv.ParseInt(v, 10, 16)
+
+			if err != nil || edInt64 < 1 {
+				return errors.New("invalid edition " + strconv.Quote(v) + " (must be a positive integer)")
+			}
+
+			edition := int(edInt64)
+			b.Edition = &edition
+		case FieldDescription:
+			description := v
+			b.Description = &description
+		case FieldGenre:
+			genre := v
+			b.Genre = &genre
+		case FieldIsbn:
+			isbn13, err := isbn.Normalize(v)
+
+			if err != nil {
+				return errors.New("invalid isbn " + strconv.Quote(v) + ": " + err.Error())
+			}
+
+			b.Isbn13 = &isbn13
+		}
+	}
+
+	if b.Title == "" {
+		return errors.New("missing title")
+	}
+
+	if b.Author.FirstName == "" && b.Author.LastName == "" {
+		return errors.New("missing author")
+	}
+
+	return nil
+}
+
+// Returns the text of a spreadsheet formula like ="0441013597", which
+// exports such as Goodreads use to keep leading zeros. Other values are
+// returned as they are.
+func unwrapFormula(v string) string {
+	if strings.HasPrefix(v, `="`) && strings.HasSuffix(v, `"`) && len(v) >= 3 {
+		return v[2 : len(v)-1]
+	}
+
+	return v
+}
+
+// Splits a full author name into first and last names. Accepts "First
+// Last" (the last word is the last name) and "Last, First".
+func SplitAuthorName(name string) (string, string) {
+	name = strings.Join(strings.Fields(name), " ")
+
+	if last, first, found := strings.Cut(name, ","); found {
+		return strings.TrimSpace(first), strings.TrimSpace(last)
+	}
+
+	idx := strings.LastIndex(name, " ")
+
+	if idx < 0 {
+		return "", name
+	}
+
+	return name[:idx], name[idx+1:]
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006/01/02",
+	"2006-01",
+	"2006",
+}
+
+// Parses the date formats commonly found in spreadsheets and library
+// exports. Year-only dates are the first of January.
+func ParseDate(v string) (*time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, errors.New("invalid date " + strconv.Quote(v) + " (expected YYYY-MM-DD)")
+}
+
+// Writes books as CSV with ExportHeader.
+func Write(w io.Writer, books []v1.Book) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(ExportHeader); err != nil {
+		return err
+	}
+
+	for _, b := range books {
+		record := []string{
+			b.Title,
+			b.Author.FirstName,
+			b.Author.LastName,
+			"",
+			"",
+			"",
+			"",
+			"",
+		}
+
+		if b.PublishDate != nil {
+			record[3] = b.PublishDate.Format("2006-01-02")
+		}
+
+		if b.Edition != nil {
+			record[4] = fmt.Sprint(*b.Edition)
+		}
+
+		if b.Description != nil {
+			record[5] = *b.Description
+		}
+
+		if b.Genre != nil {
+			record[6] = *b.Genre
+		}
+
+		if b.Isbn13 != nil {
+			record[7] = *b.Isbn13
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,126 @@
+package bookcsv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBookCsv(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Book CSV Suite")
+}
+
+// In-memory querier holding books. Unimplemented methods panic through
+// the nil embedded interface.
+type mockBookQuerier struct {
+	db.GoshelfQuerier
+	books       []v1.Book
+	collections map[string][]int
+	states      map[int]*v1.ReadingState
+	updates     int
+	reviews     map[int]v1.Review
+}
+
+func (m *mockBookQuerier) BookProgressGet(bookId int) (*v1.ReadingState, error) {
+	return m.states[bookId], nil
+}
+
+func (m *mockBookQuerier) BookProgressUpdate(bookId int, u *v1.ProgressUpdate) (*v1.ReadingState, error) {
+	if m.states == nil {
+		m.states = map[int]*v1.ReadingState{}
+	}
+
+	state := &v1.ReadingState{BookId: bookId, Status: *u.Status, FinishedTs: u.FinishedTs}
+	m.states[bookId] = state
+	m.updates++
+
+	return state, nil
+}
+
+func (m *mockBookQuerier) ReviewSet(r *v1.Review) (*v1.Review, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	if m.reviews == nil {
+		m.reviews = map[int]v1.Review{}
+	}
+
+	m.reviews[r.BookId] = *r
+
+	return r, nil
+}
+
+func (m *mockBookQuerier) CollectionGet(title *string) (*v1.Collection, error) {
+	if _, ok := m.collections[*title]; !ok {
+		return nil, nil
+	}
+
+	return &v1.Collection{Title: *title}, nil
+}
+
+func (m *mockBookQuerier) CollectionCreate(title *string, bookIds []int) (*string, error) {
+	if m.collections == nil {
+		m.collections = map[string][]int{}
+	}
+
+	m.collections[*title] = append([]int{}, bookIds...)
+
+	return title, nil
+}
+
+func (m *mockBookQuerier) CollectionAddBooks(title *string, bookIds []int) error {
+	for _, id := range bookIds {
+		found := false
+		for _, existing := range m.collections[*title] {
+			found = found || existing == id
+		}
+
+		if !found {
+			m.collections[*title] = append(m.collections[*title], id)
+		}
+	}
+
+	return nil
+}
+
+func (m *mockBookQuerier) BookCreate(b *v1.Book) (*int, error) {
+	book := *b
+	book.BookId = len(m.books) + 1
+	m.books = append(m.books, book)
+
+	return &book.BookId, nil
+}
+
+func (m *mockBookQuerier) BookFilter(filter *v1.BookFilter) ([]v1.Book, error) {
+	books := make([]v1.Book, 0)
+
+	for _, b := range m.books {
+		if filter != nil && filter.Isbn != nil {
+			if b.Isbn13 != nil && *b.Isbn13 == *filter.Isbn {
+				books = append(books, b)
+			}
+
+			continue
+		}
+
+		if filter != nil && filter.TitleExact != nil {
+			if strings.EqualFold(b.Title, *filter.TitleExact) {
+				books = append(books, b)
+			}
+
+			continue
+		}
+
+		if filter == nil || filter.Title == nil || strings.Contains(b.Title, *filter.Title) {
+			books = append(books, b)
+		}
+	}
+
+	return books, nil
+}
@@ -0,0 +1,135 @@
+package bookcsv
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Book CSV", func() {
+	Context("reading", func() {
+		It("should map headers to book fields", func() {
+			input := "Title,Author,Publish Date,Edition,Genre,Ignored\n" +
+				"Dune,Frank Herbert,1965-08-01,1,sci-fi,x\n" +
+				"Emma,\"Austen, Jane\",1815,,,\n"
+
+			rows, rowErrors, err := Read(strings.NewReader(input), DefaultColumns)
+			Expect(err).To(BeNil())
+			Expect(rowErrors).To(BeEmpty())
+			Expect(rows).To(HaveLen(2))
+
+			dune := rows[0].Book
+			Expect(dune.Title).To(Equal("Dune"))
+			Expect(dune.Author.FirstName).To(Equal("Frank"))
+			Expect(dune.Author.LastName).To(Equal("Herbert"))
+			Expect(dune.PublishDate.Format("2006-01-02")).To(Equal("1965-08-01"))
+			Expect(*dune.Edition).To(Equal(1))
+			Expect(*dune.Genre).To(Equal("sci-fi"))
+
+			emma := rows[1].Book
+			Expect(emma.Author.FirstName).To(Equal("Jane"))
+			Expect(emma.Author.LastName).To(Equal("Austen"))
+			Expect(emma.PublishDate.Year()).To(Equal(1815))
+			Expect(emma.Edition).To(BeNil())
+		})
+
+		It("should report bad rows by line", func() {
+			input := "title,author_first_name,author_last_name,edition\n" +
+				"Dune,Frank,Herbert,first\n" +
+				",Frank,Herbert,1\n" +
+				"Emma,Jane,Austen,1\n"
+
+			rows, rowErrors, err := Read(strings.NewReader(input), DefaultColumns)
+			Expect(err).To(BeNil())
+			Expect(rows).To(HaveLen(1))
+			Expect(rowErrors).To(HaveLen(2))
+			Expect(rowErrors[0].Line).To(Equal(2))
+			Expect(rowErrors[0].Message).To(ContainSubstring("edition"))
+			Expect(rowErrors[1].Line).To(Equal(3))
+			Expect(rowErrors[1].Message).To(Equal("missing title"))
+		})
+
+		It("should reject files without known columns", func() {
+			_, _, err := Read(strings.NewReader("foo,bar\n1,2\n"), DefaultColumns)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Context("round trip", func() {
+		It("should read what it writes", func() {
+			date := time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC)
+			edition := 2
+			desc := "Spice, \"sand\" and worms"
+			books := []v1.Book{{
+				Title:       "Dune",
+				Author:      v1.Author{FirstName: "Frank", LastName: "Herbert"},
+				PublishDate: &date,
+				Edition:     &edition,
+				Description: &desc,
+			}}
+
+			buf := &bytes.Buffer{}
+			Expect(Write(buf, books)).To(Succeed())
+
+			rows, rowErrors, err := Read(buf, DefaultColumns)
+			Expect(err).To(BeNil())
+			Expect(rowErrors).To(BeEmpty())
+			Expect(rows).To(HaveLen(1))
+			Expect(BookKey(&rows[0].Book)).To(Equal(BookKey(&books[0])))
+			Expect(*rows[0].Book.Description).To(Equal(desc))
+		})
+	})
+
+	Context("importing", func() {
+		var q *mockBookQuerier
+		var rows []Row
+
+		BeforeEach(func() {
+			q = &mockBookQuerier{}
+			q.BookCreate(&v1.Book{Title: "Dune", Author: v1.Author{FirstName: "Frank", LastName: "Herbert"}})
+
+			input := "title,author\n" +
+				"Dune,Frank Herbert\n" +
+				"Emma,Jane Austen\n" +
+				"emma, Jane  Austen \n"
+
+			var err error
+			rows, _, err = Read(strings.NewReader(input), DefaultColumns)
+			Expect(err).To(BeNil())
+		})
+
+		It("should skip existing and repeated books", func() {
+			report := Import(q, rows, nil, false)
+			Expect(report.Imported).To(Equal(1))
+			Expect(report.BookIds).To(Equal([]int{2}))
+			Expect(report.Duplicates).To(HaveLen(2))
+			Expect(report.Duplicates[0].Message).To(Equal("duplicate of book 1"))
+			Expect(report.Duplicates[1].Message).To(Equal("duplicate of line 3"))
+			Expect(q.books).To(HaveLen(2))
+		})
+
+		It("should match existing books whose title differs only by case", func() {
+			q.BookCreate(&v1.Book{Title: "100% Wolf", Author: v1.Author{FirstName: "Jayne", LastName: "Lyons"}})
+
+			rows, _, err := Read(strings.NewReader("title,author\nDUNE,Frank Herbert\n100_ wolf,Jayne Lyons\n"), DefaultColumns)
+			Expect(err).To(BeNil())
+
+			report := Import(q, rows, nil, false)
+			Expect(report.Imported).To(Equal(1))
+			Expect(report.Duplicates).To(HaveLen(1))
+			Expect(report.Duplicates[0].Message).To(Equal("duplicate of book 1"))
+		})
+
+		It("should not create books in a dry run", func() {
+			report := Import(q, rows, []RowError{{Line: 9, Message: "bad"}}, true)
+			Expect(report.Imported).To(Equal(1))
+			Expect(report.BookIds).To(BeEmpty())
+			Expect(report.Errors).To(HaveLen(1))
+			Expect(q.books).To(HaveLen(1))
+		})
+	})
+})
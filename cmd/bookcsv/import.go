@@ -0,0 +1,148 @@
+package bookcsv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The outcome of an import. Duplicates and errors are reported per row;
+// errors without a line (0) are not tied to a row.
+type ImportReport struct {
+	DryRun     bool       `json:"dryRun"`
+	Imported   int        `json:"imported"` // Rows created, or that would be created in a dry run
+	BookIds    []int      `json:"bookIds"`
+	Duplicates []RowError `json:"duplicates"`
+	Errors     []RowError `json:"errors"`
+	// Collections created or added to, see ImportLibrary
+	Collections []string `json:"collections,omitempty"`
+	// Reading states and reviews written, see ImportLibrary
+	ReadingStates int `json:"readingStates,omitempty"`
+	Reviews       int `json:"reviews,omitempty"`
+}
+
+// Returns the identity the design doc gives a book: title, author,
+// edition and publish date. Case and whitespace are ignored.
+func BookKey(b *v1.Book) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+
+	edition, date := "", ""
+
+	if b.Edition != nil {
+		edition = fmt.Sprint(*b.Edition)
+	}
+
+	if b.PublishDate != nil {
+		date = b.PublishDate.Format("2006-01-02")
+	}
+
+	return strings.Join([]string{
+		normalize(b.Title),
+		normalize(b.Author.FirstName),
+		normalize(b.Author.LastName),
+		edition,
+		date,
+	}, "\x00")
+}
+
+// Returns the existing book with b's ISBN, or else with the same BookKey
+// as b, or nil if none.
+func FindExisting(q db.GoshelfQuerier, b *v1.Book) (*v1.Book, error) {
+	if b.Isbn13 != nil {
+		matches, err := q.BookFilter(&v1.BookFilter{Isbn: b.Isbn13})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) > 0 {
+			return &matches[0], nil
+		}
+	}
+
+	title := strings.TrimSpace(b.Title)
+
+	candidates, err := q.BookFilter(&v1.BookFilter{TitleExact: &title})
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := BookKey(b)
+
+	for i := range candidates {
+		if BookKey(&candidates[i]) == key {
+			return &candidates[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Creates the books in rows, skipping books that already exist or appear
+// earlier in rows. rowErrors (e.g., from Read) are carried into the report.
+// A dry run reports what would be imported without creating anything.
+func Import(q db.GoshelfQuerier, rows []Row, rowErrors []RowError, dryRun bool) *ImportReport {
+	report := &ImportReport{
+		DryRun:     dryRun,
+		BookIds:    make([]int, 0),
+		Duplicates: make([]RowError, 0),
+		Errors:     append(make([]RowError, 0), rowErrors...),
+	}
+
+	seen := map[string]int{}
+
+	for _, row := range rows {
+		key := BookKey(&row.Book)
+
+		if line, ok := seen[key]; ok {
+			report.Duplicates = append(report.Duplicates, RowError{
+				Line:    row.Line,
+				Message: fmt.Sprintf("duplicate of line %d", line),
+			})
+			continue
+		}
+
+		seen[key] = row.Line
+
+		existing, err := FindExisting(q, &row.Book)
+
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+
+		if existing != nil {
+			report.Duplicates = append(report.Duplicates, RowError{
+				Line:    row.Line,
+				Message: fmt.Sprintf("duplicate of book %d", existing.BookId),
+			})
+			continue
+		}
+
+		if dryRun {
+			report.Imported++
+			continue
+		}
+
+		book := row.Book
+		id, err := q.BookCreate(&book)
+
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+
+		report.Imported++
+
+		if id != nil {
+			report.BookIds = append(report.BookIds, *id)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,293 @@
+package bookcsv
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The CSV export of a reading app. Each shelf a book is on becomes a
+// goshelf collection, and the reading status, read date, rating and
+// review become the importing user's reading state and review.
+type LibraryFormat struct {
+	Name    string
+	Columns Columns
+	Shelves func(fields map[string]string) []string
+	Reading func(fields map[string]string) (*LibraryReading, error)
+}
+
+// A row's reading data. Nil fields weren't given.
+type LibraryReading struct {
+	Status     *string    // One of v1.ReadingStatuses
+	FinishedTs *time.Time // Date last read
+	Rating     *float64
+	Review     *string
+}
+
+// The date format both apps export
+const libraryDateFormat = "2006/01/02"
+
+// Goodreads "Export Library" CSV. "Author l-f" follows "Author" in the
+// export, so the unambiguous "Last, First" name wins when present, as
+// does "ISBN13" over "ISBN". Both are wrapped as ="..." formulas.
+var Goodreads = LibraryFormat{
+	Name: "goodreads",
+	Columns: Columns{
+		"title":         FieldTitle,
+		"author":        FieldAuthor,
+		"authorlf":      FieldAuthor,
+		"yearpublished": FieldPublishDate,
+		"isbn":          FieldIsbn,
+		"isbn13":        FieldIsbn,
+	},
+	Shelves: func(fields map[string]string) []string {
+		return append(splitList(fields["bookshelves"]), fields["exclusiveshelf"])
+	},
+	// "My Rating" is whole stars with 0 for unrated. Custom exclusive
+	// shelves have no reading status.
+	Reading: func(fields map[string]string) (*LibraryReading, error) {
+		return libraryReading(fields, map[string]string{
+			"read":              v1.ReadingStatusFinished,
+			"currently-reading": v1.ReadingStatusReading,
+			"to-read":           v1.ReadingStatusWantToRead,
+		}, "exclusiveshelf", "dateread", "myrating", "myreview")
+	},
+}
+
+// StoryGraph "Export StoryGraph Library" CSV.
+var StoryGraph = LibraryFormat{
+	Name: "storygraph",
+	Columns: Columns{
+		"title":   FieldTitle,
+		"authors": FieldAuthors,
+	},
+	Shelves: func(fields map[string]string) []string {
+		return append(splitList(fields["tags"]), fields["readstatus"])
+	},
+	// "Star Rating" allows quarter stars, which are rounded to the
+	// nearest half star.
+	Reading: func(fields map[string]string) (*LibraryReading, error) {
+		return libraryReading(fields, map[string]string{
+			"read":              v1.ReadingStatusFinished,
+			"currently-reading": v1.ReadingStatusReading,
+			"to-read":           v1.ReadingStatusWantToRead,
+			"did-not-finish":    v1.ReadingStatusAbandoned,
+		}, "readstatus", "lastdateread", "starrating", "review")
+	},
+}
+
+var LibraryFormats = map[string]LibraryFormat{
+	Goodreads.Name:  Goodreads,
+	StoryGraph.Name: StoryGraph,
+}
+
+// Reads a row's reading data from the given columns. statuses maps the
+// app's status to a reading status; unknown statuses are ignored.
+func libraryReading(fields map[string]string, statuses map[string]string, statusCol, dateCol, ratingCol, reviewCol string) (*LibraryReading, error) {
+	reading := &LibraryReading{}
+
+	if status, ok := statuses[strings.ToLower(strings.TrimSpace(fields[statusCol]))]; ok {
+		reading.Status = &status
+	}
+
+	if v := strings.TrimSpace(fields[dateCol]); v != "" {
+		ts, err := time.Parse(libraryDateFormat, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: not a date: %s", dateCol, v)
+		}
+
+		reading.FinishedTs = &ts
+	}
+
+	if v := strings.TrimSpace(fields[ratingCol]); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+
+		if err != nil || rating < 0 || rating > v1.MaxRating {
+			return nil, fmt.Errorf("%s: not a rating: %s", ratingCol, v)
+		}
+
+		if rating = math.Round(rating*2) / 2; rating >= v1.MinRating {
+			reading.Rating = &rating
+		}
+	}
+
+	if v := strings.TrimSpace(fields[reviewCol]); v != "" {
+		reading.Review = &v
+	}
+
+	return reading, nil
+}
+
+// Records a book's reading data. The status is only updated when it
+// differs from the current one, so re-importing doesn't grow the
+// history. Returns whether the state and the review were written.
+func importReading(q db.GoshelfQuerier, bookId int, reading *LibraryReading) (bool, bool, error) {
+	stateSet, reviewSet := false, false
+
+	if reading.Status != nil {
+		state, err := q.BookProgressGet(bookId)
+
+		if err != nil {
+			return false, false, err
+		}
+
+		if state == nil || state.Status != *reading.Status {
+			update := &v1.ProgressUpdate{Status: reading.Status}
+
+			if *reading.Status == v1.ReadingStatusFinished {
+				update.FinishedTs = reading.FinishedTs
+			}
+
+			if _, err = q.BookProgressUpdate(bookId, update); err != nil {
+				return false, false, err
+			}
+
+			stateSet = true
+		}
+	}
+
+	if reading.Rating != nil || reading.Review != nil {
+		review, err := q.ReviewSet(&v1.Review{BookId: bookId, Rating: reading.Rating, Body: reading.Review})
+
+		if err != nil {
+			return stateSet, false, err
+		}
+
+		reviewSet = review != nil
+	}
+
+	return stateSet, reviewSet, nil
+}
+
+func splitList(v string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(v, ",") {
+		items = append(items, strings.TrimSpace(item))
+	}
+
+	return items
+}
+
+// Converts a shelf name to a collection title, keeping letters, digits,
+// dashes and underscores and replacing spaces with dashes.
+func ShelfTitle(shelf string) string {
+	var b strings.Builder
+
+	for _, r := range strings.Join(strings.Fields(strings.ToLower(shelf)), "-") {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// Imports a reading app export. Books already on the shelf are matched
+// rather than duplicated, and every book (new or existing) is added to the
+// collections named after its shelves, so re-running the import after a
+// fresh export only adds new entries. Reading data is recorded for the
+// current user; a row whose reading data can't be read is reported as an
+// error, and in a dry run the reading data is only checked.
+func ImportLibrary(q db.GoshelfQuerier, r io.Reader, format LibraryFormat, dryRun bool) (*ImportReport, error) {
+	rows, rowErrors, err := Read(r, format.Columns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading data by line, checked before anything is written
+	readings := map[int]*LibraryReading{}
+
+	for _, row := range rows {
+		reading, err := format.Reading(row.Fields)
+
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+
+		readings[row.Line] = reading
+	}
+
+	report := Import(q, rows, rowErrors, dryRun)
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Books created or matched by each shelf's collection title
+	shelves := map[string][]int{}
+
+	for _, row := range rows {
+		book, err := FindExisting(q, &row.Book)
+
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+
+		// Failed to import, already reported
+		if book == nil {
+			continue
+		}
+
+		if reading := readings[row.Line]; reading != nil {
+			stateSet, reviewSet, err := importReading(q, book.BookId, reading)
+
+			if stateSet {
+				report.ReadingStates++
+			}
+
+			if reviewSet {
+				report.Reviews++
+			}
+
+			if err != nil {
+				report.Errors = append(report.Errors, RowError{Line: row.Line, Message: err.Error()})
+			}
+		}
+
+		for _, shelf := range format.Shelves(row.Fields) {
+			if title := ShelfTitle(shelf); title != "" {
+				shelves[title] = append(shelves[title], book.BookId)
+			}
+		}
+	}
+
+	titles := make([]string, 0, len(shelves))
+	for title := range shelves {
+		titles = append(titles, title)
+	}
+
+	sort.Strings(titles)
+
+	for _, title := range titles {
+		title := title
+
+		col, err := q.CollectionGet(&title)
+
+		if err == nil && col == nil {
+			_, err = q.CollectionCreate(&title, shelves[title])
+		} else if err == nil {
+			err = q.CollectionAddBooks(&title, shelves[title])
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Message: "collection " + title + ": " + err.Error()})
+			continue
+		}
+
+		report.Collections = append(report.Collections, title)
+	}
+
+	return report, nil
+}
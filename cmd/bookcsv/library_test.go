@@ -0,0 +1,133 @@
+package bookcsv
+
+import (
+	"strings"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const goodreadsExport = `Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies
+234225,Dune,Frank Herbert,"Herbert, Frank",,"=""0441013597""","=""9780441013593""",5,4.25,Ace,Paperback,688,2005,1965,2023/01/04,2022/12/01,"sci-fi, favorites","sci-fi (#1), favorites (#3)",read,,,,1,0
+13079982,The Left Hand of Darkness,Ursula K. Le Guin,"Le Guin, Ursula K.",,"=""""","=""""",0,4.09,Ace,Paperback,304,2000,1969,,2023/02/10,,,to-read,,,,0,0
+`
+
+const storyGraphExport = `Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?
+Piranesi,Susanna Clarke,,9781635575637,hardcover,read,2023/03/01,2023/03/10,2023/03/01-2023/03/10,1,mysterious,medium,Plot,Yes,Yes,No,Yes,4.5,,,,"book club, Fantasy",Yes
+Good Omens,"Terry Pratchett, Neil Gaiman",,9780060853983,paperback,to-read,2023/04/01,,,0,,,,,,,,,,,,,No
+`
+
+var _ = Describe("Library imports", func() {
+	var q *mockBookQuerier
+
+	BeforeEach(func() {
+		q = &mockBookQuerier{}
+	})
+
+	Context("Goodreads", func() {
+		It("should import books and shelves", func() {
+			report, err := ImportLibrary(q, strings.NewReader(goodreadsExport), Goodreads, false)
+			Expect(err).To(BeNil())
+			Expect(report.Errors).To(BeEmpty())
+			Expect(report.Imported).To(Equal(2))
+
+			Expect(q.books[0].Title).To(Equal("Dune"))
+			Expect(q.books[0].Author.LastName).To(Equal("Herbert"))
+			Expect(q.books[0].PublishDate.Year()).To(Equal(2005))
+			Expect(q.books[1].Author.FirstName).To(Equal("Ursula K."))
+			Expect(q.books[1].Author.LastName).To(Equal("Le Guin"))
+			Expect(*q.books[0].Isbn13).To(Equal("9780441013593"))
+			Expect(q.books[1].Isbn13).To(BeNil())
+
+			Expect(q.collections).To(HaveKeyWithValue("read", []int{1}))
+			Expect(q.collections).To(HaveKeyWithValue("sci-fi", []int{1}))
+			Expect(q.collections).To(HaveKeyWithValue("favorites", []int{1}))
+			Expect(q.collections).To(HaveKeyWithValue("to-read", []int{2}))
+		})
+
+		It("should be idempotent", func() {
+			_, err := ImportLibrary(q, strings.NewReader(goodreadsExport), Goodreads, false)
+			Expect(err).To(BeNil())
+
+			report, err := ImportLibrary(q, strings.NewReader(goodreadsExport), Goodreads, false)
+			Expect(err).To(BeNil())
+			Expect(report.Imported).To(Equal(0))
+			Expect(report.Duplicates).To(HaveLen(2))
+			Expect(q.books).To(HaveLen(2))
+			Expect(q.collections["read"]).To(Equal([]int{1}))
+			Expect(q.updates).To(Equal(2))
+		})
+
+		It("should import reading status, read date and rating", func() {
+			report, err := ImportLibrary(q, strings.NewReader(goodreadsExport), Goodreads, false)
+			Expect(err).To(BeNil())
+			Expect(report.ReadingStates).To(Equal(2))
+			Expect(report.Reviews).To(Equal(1))
+
+			Expect(q.states[1].Status).To(Equal(v1.ReadingStatusFinished))
+			Expect(q.states[1].FinishedTs.Format("2006-01-02")).To(Equal("2023-01-04"))
+			Expect(*q.reviews[1].Rating).To(Equal(5.0))
+
+			// A rating of 0 means unrated
+			Expect(q.states[2].Status).To(Equal(v1.ReadingStatusWantToRead))
+			Expect(q.reviews).ToNot(HaveKey(2))
+		})
+
+		It("should report rows with unreadable reading data", func() {
+			export := strings.Replace(goodreadsExport, "2023/01/04", "last winter", 1)
+
+			report, err := ImportLibrary(q, strings.NewReader(export), Goodreads, true)
+			Expect(err).To(BeNil())
+			Expect(report.Errors).To(HaveLen(1))
+			Expect(report.Errors[0].Line).To(Equal(2))
+			Expect(report.Errors[0].Message).To(ContainSubstring("not a date"))
+		})
+
+		It("should match books already on the shelf by ISBN", func() {
+			isbn13 := "9780441013593"
+			q.books = []v1.Book{{BookId: 1, Title: "Dune (Dune Chronicles #1)", Isbn13: &isbn13}}
+
+			report, err := ImportLibrary(q, strings.NewReader(goodreadsExport), Goodreads, false)
+			Expect(err).To(BeNil())
+			Expect(report.Imported).To(Equal(1))
+			Expect(report.Duplicates[0].Message).To(Equal("duplicate of book 1"))
+			Expect(q.collections["sci-fi"]).To(Equal([]int{1}))
+		})
+	})
+
+	Context("StoryGraph", func() {
+		It("should import the first author and tags", func() {
+			report, err := ImportLibrary(q, strings.NewReader(storyGraphExport), StoryGraph, false)
+			Expect(err).To(BeNil())
+			Expect(report.Errors).To(BeEmpty())
+			Expect(report.Imported).To(Equal(2))
+
+			Expect(q.books[1].Author.FirstName).To(Equal("Terry"))
+			Expect(q.books[1].Author.LastName).To(Equal("Pratchett"))
+
+			Expect(q.collections).To(HaveKeyWithValue("book-club", []int{1}))
+			Expect(q.collections).To(HaveKeyWithValue("fantasy", []int{1}))
+			Expect(q.collections).To(HaveKeyWithValue("to-read", []int{2}))
+		})
+
+		It("should import reading status, read date and rating", func() {
+			export := strings.Replace(storyGraphExport, "to-read", "did-not-finish", 1)
+
+			report, err := ImportLibrary(q, strings.NewReader(export), StoryGraph, false)
+			Expect(err).To(BeNil())
+			Expect(report.Errors).To(BeEmpty())
+
+			Expect(q.states[1].Status).To(Equal(v1.ReadingStatusFinished))
+			Expect(q.states[1].FinishedTs.Format("2006-01-02")).To(Equal("2023-03-10"))
+			Expect(*q.reviews[1].Rating).To(Equal(4.5))
+			Expect(q.states[2].Status).To(Equal(v1.ReadingStatusAbandoned))
+		})
+	})
+
+	It("should convert shelf names to collection titles", func() {
+		Expect(ShelfTitle(" Book Club! ")).To(Equal("book-club"))
+		Expect(ShelfTitle("currently-reading")).To(Equal("currently-reading"))
+		Expect(ShelfTitle("")).To(BeEmpty())
+	})
+})
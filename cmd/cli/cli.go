@@ -23,6 +23,40 @@ func GetCliPrompt(prompt *string, reader io.Reader) (*string, error) {
 	return &ret, nil
 }
 
+// Prompts for a yes or no answer, adding " [y/N]: " to prompt. Returns
+// true only for an answer starting with y.
+func GetCliConfirm(prompt string, reader io.Reader) (bool, error) {
+	withChoices := prompt + " [y/N]: "
+	in, err := GetCliPrompt(&withChoices, reader)
+
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(strings.ToLower(*in), "y"), nil
+}
+
+// Prompts like GetCliPrompt, showing def and returning it if the input is
+// empty. Without a default this is the same as GetCliPrompt.
+func GetCliPromptWithDefault(prompt *string, def string, reader io.Reader) (*string, error) {
+	if def == "" {
+		return GetCliPrompt(prompt, reader)
+	}
+
+	withDefault := strings.TrimSuffix(*prompt, ": ") + " [" + def + "]: "
+	in, err := GetCliPrompt(&withDefault, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if *in == "" {
+		return &def, nil
+	}
+
+	return in, nil
+}
+
 func GetIntFromCli(prompt *string, r io.Reader, w io.Writer) (*int, error) {
 	for {
 		valStr, err := GetCliPrompt(prompt, r)
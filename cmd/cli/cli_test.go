@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -32,6 +33,34 @@ var _ = Describe("Cli", func() {
 			GetCliPrompt(&prompt, r)
 		})
 
+		It("should return the default for empty input", func() {
+			prompt := "\tEnter title: "
+			val, err := GetCliPromptWithDefault(&prompt, "Dune", strings.NewReader("\n"))
+			Expect(err).To(BeNil())
+			Expect(*val).To(Equal("Dune"))
+
+			val, err = GetCliPromptWithDefault(&prompt, "Dune", strings.NewReader("Emma\n"))
+			Expect(err).To(BeNil())
+			Expect(*val).To(Equal("Emma"))
+		})
+
+		It("should only confirm a yes", func() {
+			for input, confirmed := range map[string]bool{"y\n": true, "Yes\n": true, "\n": false, "no\n": false} {
+				ok, err := GetCliConfirm("\tRemove book 12?", strings.NewReader(input))
+				Expect(err).To(BeNil())
+				Expect(ok).To(Equal(confirmed))
+			}
+		})
+
+		It("should return the text saved by the editor", func() {
+			GinkgoT().Setenv("VISUAL", "")
+			GinkgoT().Setenv("EDITOR", "sed -i s/draft/final/")
+
+			text, err := EditText("a draft review\n")
+			Expect(err).To(BeNil())
+			Expect(*text).To(Equal("a final review"))
+		})
+
 		// TODO: add more tests
 	})
 
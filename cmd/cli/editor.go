@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The editor used when neither $VISUAL nor $EDITOR is set
+const DefaultEditor = "vi"
+
+// Opens initial in the user's editor ($VISUAL, then $EDITOR) and returns
+// the saved text with surrounding whitespace trimmed. The editor command
+// is run by the shell, so it may include arguments, e.g. "code --wait".
+func EditText(initial string) (*string, error) {
+	editor := os.Getenv("VISUAL")
+
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = DefaultEditor
+	}
+
+	file, err := os.CreateTemp("", "goshelf-*.md")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(initial)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New("editor failed: " + err.Error())
+	}
+
+	edited, err := os.ReadFile(file.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := strings.TrimSpace(string(edited))
+
+	return &ret, nil
+}
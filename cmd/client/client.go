@@ -0,0 +1,1114 @@
+// Package client implements db.GoshelfQuerier over the goshelf REST API so
+// services (and the CLI's remote mode) can use a goshelf server without
+// database credentials.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+const SchemaVersion = "v1"
+const PathPrefix = `/api/` + SchemaVersion + "/"
+
+const DefaultRetries = 2
+const DefaultRetryWait = 250 * time.Millisecond
+
+// Clients can be used wherever a backend is expected
+var _ db.GoshelfQuerier = (*Client)(nil)
+
+type Client struct {
+	BaseUrl    string // e.g., https://shelf.example
+	Token      string // API key sent as a bearer token, optional
+	HttpClient *http.Client
+	Retries    int           // Attempts after the first on transient failures
+	RetryWait  time.Duration // Doubled after each retry
+	ctx        context.Context
+}
+
+// The LXD style envelope returned by every endpoint.
+type response struct {
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	StatusCode int             `json:"status_code"`
+	Metadata   json.RawMessage `json:"metadata"`
+}
+
+// Returns a client for the server at baseUrl, authenticating with token
+// when it is not empty.
+func New(baseUrl string, token string) *Client {
+	return &Client{
+		BaseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		Token:      token,
+		HttpClient: http.DefaultClient,
+		Retries:    DefaultRetries,
+		RetryWait:  DefaultRetryWait,
+		ctx:        context.Background(),
+	}
+}
+
+// Returns a copy of the client whose requests use ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	scoped := *c
+	scoped.ctx = ctx
+	return &scoped
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// Checks the server is reachable and the token is accepted.
+func (c *Client) Connect() error {
+	_, err := c.Whoami()
+	return err
+}
+
+// The server acts as the user owning the API key, so the client cannot act
+// as another user. Returns the client unchanged.
+func (c *Client) AsUser(u *v1.User) db.GoshelfQuerier {
+	return c
+}
+
+// Sends a request and decodes the envelope's metadata into out (if not
+// nil). Idempotent requests are retried on transient failures.
+func (c *Client) do(method string, path string, query url.Values, body interface{}, out interface{}) error {
+	var payload []byte
+
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	target := c.BaseUrl + PathPrefix + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	wait := c.RetryWait
+	attempts := 1
+	if method != http.MethodPost {
+		attempts += c.Retries
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.context().Done():
+				return c.context().Err()
+			}
+
+			wait *= 2
+		}
+
+		var retry bool
+		retry, err = c.send(method, target, payload, out)
+
+		if !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Sends one request. Returns true with the error if it is worth retrying.
+func (c *Client) send(method string, target string, payload []byte, out interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(c.context(), method, target, body)
+
+	if err != nil {
+		return false, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+
+	if err != nil {
+		// Network failures are transient unless the caller gave up
+		return c.context().Err() == nil, err
+	}
+
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return true, err
+	}
+
+	transient := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+
+	envelope := response{}
+	if err := json.Unmarshal(resBody, &envelope); err != nil {
+		return transient, &Error{
+			StatusCode: res.StatusCode,
+			Message:    "unexpected response: " + strings.TrimSpace(string(resBody)),
+		}
+	}
+
+	if envelope.Status != "Success" {
+		return transient, newError(&envelope)
+	}
+
+	if out == nil || len(envelope.Metadata) == 0 {
+		return false, nil
+	}
+
+	return false, json.Unmarshal(envelope.Metadata, out)
+}
+
+func (c *Client) BookCreate(b *v1.Book) (*int, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	ret := struct {
+		BookId *int `json:"bookId"`
+	}{}
+
+	err := c.do(http.MethodPost, "book/", nil, b, &ret)
+
+	return ret.BookId, err
+}
+
+func (c *Client) BookGet(id int) (*v1.Book, error) {
+	ret := struct {
+		Book *v1.Book `json:"book"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Book, err
+}
+
+func (c *Client) BookRemove(id int) error {
+	return c.do(http.MethodDelete, "book/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) BookMerge(keep int, drop int) error {
+	body := map[string]int{"bookId": drop}
+
+	return c.do(http.MethodPost, "book/"+fmt.Sprint(keep)+"/merge", nil, body, nil)
+}
+
+// Returns the user's book with the given ISBN-10 or ISBN-13. Not part of
+// the querier interface; BookFilter with an ISBN is the portable form.
+func (c *Client) BookGetByIsbn(isbn string) (*v1.Book, error) {
+	ret := struct {
+		Book *v1.Book `json:"book"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/isbn/"+url.PathEscape(isbn), nil, nil, &ret)
+
+	return ret.Book, err
+}
+
+// Returns b with missing fields filled in by the server's metadata
+// provider. Nothing is created; pass the result to BookCreate to save it.
+func (c *Client) BookEnrich(b *v1.Book) (*v1.Book, error) {
+	ret := struct {
+		Book *v1.Book `json:"book"`
+	}{}
+
+	query := url.Values{}
+	query.Set("enrich", "true")
+
+	err := c.do(http.MethodPost, "book/", query, b, &ret)
+
+	return ret.Book, err
+}
+
+func (c *Client) BookFilter(filter *v1.BookFilter) ([]v1.Book, error) {
+	query := url.Values{}
+
+	if filter == nil {
+		filter = &v1.BookFilter{}
+	}
+
+	if filter.Title != nil {
+		query.Set("title", *filter.Title)
+	}
+
+	if filter.TitleExact != nil {
+		query.Set("titleExact", *filter.TitleExact)
+	}
+
+	if filter.Genre != nil {
+		query.Set("genre", *filter.Genre)
+	}
+
+	if filter.Edition != nil {
+		query.Set("edition", fmt.Sprint(*filter.Edition))
+	}
+
+	if filter.Isbn != nil {
+		query.Set("isbn", *filter.Isbn)
+	}
+
+	if filter.Status != nil {
+		query.Set("status", *filter.Status)
+	}
+
+	if filter.SeriesId != nil {
+		query.Set("seriesId", fmt.Sprint(*filter.SeriesId))
+	}
+
+	if filter.WorkId != nil {
+		query.Set("workId", fmt.Sprint(*filter.WorkId))
+	}
+
+	if filter.PublishedBefore != nil {
+		query.Set("publishedBefore", filter.PublishedBefore.Format("2006-01-02"))
+	}
+
+	if filter.PublishedAfter != nil {
+		query.Set("publishedAfter", filter.PublishedAfter.Format("2006-01-02"))
+	}
+
+	if filter.Sort != nil {
+		query.Set("sort", *filter.Sort)
+	}
+
+	ret := struct {
+		Books []v1.Book `json:"books"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/", query, nil, &ret)
+
+	return ret.Books, err
+}
+
+func (c *Client) BookProgressGet(bookId int) (*v1.ReadingState, error) {
+	ret := struct {
+		Progress *v1.ReadingState `json:"progress"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/"+fmt.Sprint(bookId)+"/progress", nil, nil, &ret)
+
+	return ret.Progress, err
+}
+
+func (c *Client) BookProgressUpdate(bookId int, u *v1.ProgressUpdate) (*v1.ReadingState, error) {
+	ret := struct {
+		Progress *v1.ReadingState `json:"progress"`
+	}{}
+
+	err := c.do(http.MethodPost, "book/"+fmt.Sprint(bookId)+"/progress", nil, u, &ret)
+
+	return ret.Progress, err
+}
+
+func (c *Client) LoanCreate(l *v1.Loan) (*int, error) {
+	ret := struct {
+		LoanId *int `json:"loanId"`
+	}{}
+
+	err := c.do(http.MethodPost, "loan/", nil, l, &ret)
+
+	return ret.LoanId, err
+}
+
+func (c *Client) LoanGet(id int) (*v1.Loan, error) {
+	ret := struct {
+		Loan *v1.Loan `json:"loan"`
+	}{}
+
+	err := c.do(http.MethodGet, "loan/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Loan, err
+}
+
+func (c *Client) LoanList(filter *v1.LoanFilter) ([]v1.Loan, error) {
+	query := url.Values{}
+
+	if filter == nil {
+		filter = &v1.LoanFilter{}
+	}
+
+	if filter.BookId != nil {
+		query.Set("bookId", fmt.Sprint(*filter.BookId))
+	}
+
+	if filter.Active {
+		query.Set("active", "true")
+	}
+
+	if filter.Overdue {
+		query.Set("overdue", "true")
+	}
+
+	ret := struct {
+		Loans []v1.Loan `json:"loans"`
+	}{}
+
+	err := c.do(http.MethodGet, "loan/", query, nil, &ret)
+
+	return ret.Loans, err
+}
+
+func (c *Client) LoanReturn(id int) error {
+	return c.do(http.MethodPost, "loan/"+fmt.Sprint(id)+"/return", nil, nil, nil)
+}
+
+func (c *Client) CopyCreate(bookCopy *v1.Copy) (*int, error) {
+	ret := struct {
+		CopyId *int `json:"copyId"`
+	}{}
+
+	err := c.do(http.MethodPost, "copy/", nil, bookCopy, &ret)
+
+	return ret.CopyId, err
+}
+
+func (c *Client) CopyGet(id int) (*v1.Copy, error) {
+	ret := struct {
+		Copy *v1.Copy `json:"copy"`
+	}{}
+
+	err := c.do(http.MethodGet, "copy/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Copy, err
+}
+
+func (c *Client) CopyList(filter *v1.CopyFilter) ([]v1.Copy, error) {
+	query := url.Values{}
+
+	if filter == nil {
+		filter = &v1.CopyFilter{}
+	}
+
+	if filter.BookId != nil {
+		query.Set("bookId", fmt.Sprint(*filter.BookId))
+	}
+
+	if filter.LocationId != nil {
+		query.Set("locationId", fmt.Sprint(*filter.LocationId))
+	}
+
+	ret := struct {
+		Copies []v1.Copy `json:"copies"`
+	}{}
+
+	err := c.do(http.MethodGet, "copy/", query, nil, &ret)
+
+	return ret.Copies, err
+}
+
+func (c *Client) CopyMove(id int, locationId *int) error {
+	body := map[string]interface{}{
+		"locationId": locationId,
+	}
+
+	return c.do(http.MethodPost, "copy/"+fmt.Sprint(id)+"/move", nil, body, nil)
+}
+
+func (c *Client) CopyRemove(id int) error {
+	return c.do(http.MethodDelete, "copy/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) LocationCreate(l *v1.Location) (*int, error) {
+	ret := struct {
+		LocationId *int `json:"locationId"`
+	}{}
+
+	err := c.do(http.MethodPost, "location/", nil, l, &ret)
+
+	return ret.LocationId, err
+}
+
+func (c *Client) LocationList() ([]v1.Location, error) {
+	ret := struct {
+		Locations []v1.Location `json:"locations"`
+	}{}
+
+	err := c.do(http.MethodGet, "location/", nil, nil, &ret)
+
+	return ret.Locations, err
+}
+
+func (c *Client) LocationRemove(id int) error {
+	return c.do(http.MethodDelete, "location/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) SeriesCreate(series *v1.Series) (*int, error) {
+	ret := struct {
+		SeriesId *int `json:"seriesId"`
+	}{}
+
+	err := c.do(http.MethodPost, "series/", nil, series, &ret)
+
+	return ret.SeriesId, err
+}
+
+func (c *Client) SeriesGet(id int) (*v1.Series, error) {
+	ret := struct {
+		Series *v1.Series `json:"series"`
+	}{}
+
+	err := c.do(http.MethodGet, "series/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Series, err
+}
+
+func (c *Client) SeriesList() ([]v1.Series, error) {
+	ret := struct {
+		Series []v1.Series `json:"series"`
+	}{}
+
+	err := c.do(http.MethodGet, "series/", nil, nil, &ret)
+
+	return ret.Series, err
+}
+
+func (c *Client) SeriesRemove(id int) error {
+	return c.do(http.MethodDelete, "series/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) SeriesSetBook(seriesId int, bookId int, position float64) error {
+	body := map[string]interface{}{
+		"position": position,
+	}
+
+	return c.do(http.MethodPut, fmt.Sprintf("series/%d/book/%d", seriesId, bookId), nil, body, nil)
+}
+
+func (c *Client) SeriesRemoveBook(seriesId int, bookId int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("series/%d/book/%d", seriesId, bookId), nil, nil, nil)
+}
+
+func (c *Client) SeriesNextUnread(id int) (*v1.Book, error) {
+	ret := struct {
+		Book *v1.Book `json:"book"`
+	}{}
+
+	err := c.do(http.MethodGet, "series/"+fmt.Sprint(id)+"/next", nil, nil, &ret)
+
+	return ret.Book, err
+}
+
+func (c *Client) ReviewList(bookId int) ([]v1.Review, error) {
+	ret := struct {
+		Reviews []v1.Review `json:"reviews"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/"+fmt.Sprint(bookId)+"/review", nil, nil, &ret)
+
+	return ret.Reviews, err
+}
+
+func (c *Client) ReviewSet(r *v1.Review) (*v1.Review, error) {
+	ret := struct {
+		Review *v1.Review `json:"review"`
+	}{}
+
+	err := c.do(http.MethodPut, "book/"+fmt.Sprint(r.BookId)+"/review", nil, r, &ret)
+
+	return ret.Review, err
+}
+
+func (c *Client) ReviewRemove(bookId int) error {
+	return c.do(http.MethodDelete, "book/"+fmt.Sprint(bookId)+"/review", nil, nil, nil)
+}
+
+func (c *Client) NoteCreate(n *v1.Note) (*int, error) {
+	ret := struct {
+		NoteId *int `json:"noteId"`
+	}{}
+
+	err := c.do(http.MethodPost, "book/"+fmt.Sprint(n.BookId)+"/note", nil, n, &ret)
+
+	return ret.NoteId, err
+}
+
+func (c *Client) NoteGet(id int) (*v1.Note, error) {
+	ret := struct {
+		Note *v1.Note `json:"note"`
+	}{}
+
+	err := c.do(http.MethodGet, "note/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Note, err
+}
+
+func (c *Client) NoteList(bookId int) ([]v1.Note, error) {
+	ret := struct {
+		Notes []v1.Note `json:"notes"`
+	}{}
+
+	err := c.do(http.MethodGet, "book/"+fmt.Sprint(bookId)+"/note", nil, nil, &ret)
+
+	return ret.Notes, err
+}
+
+func (c *Client) NoteUpdate(n *v1.Note) error {
+	return c.do(http.MethodPut, "note/"+fmt.Sprint(n.NoteId), nil, n, nil)
+}
+
+func (c *Client) NoteRemove(id int) error {
+	return c.do(http.MethodDelete, "note/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) WorkGet(id int) (*v1.Work, error) {
+	ret := struct {
+		Work *v1.Work `json:"work"`
+	}{}
+
+	err := c.do(http.MethodGet, "work/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.Work, err
+}
+
+func (c *Client) WorkList() ([]v1.Work, error) {
+	ret := struct {
+		Works []v1.Work `json:"works"`
+	}{}
+
+	err := c.do(http.MethodGet, "work/", nil, nil, &ret)
+
+	return ret.Works, err
+}
+
+func (c *Client) WorkUpdate(w *v1.Work) error {
+	return c.do(http.MethodPut, "work/"+fmt.Sprint(w.WorkId), nil, w, nil)
+}
+
+func (c *Client) WorkSetBook(workId int, bookId int) error {
+	return c.do(http.MethodPut, fmt.Sprintf("work/%d/edition/%d", workId, bookId), nil, nil, nil)
+}
+
+func (c *Client) CollectionCreate(title *string, bookIds []int) (*string, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	body := map[string]interface{}{
+		"title":   *title,
+		"bookIds": bookIds,
+	}
+
+	if err := c.do(http.MethodPost, "collection/", nil, body, nil); err != nil {
+		return nil, err
+	}
+
+	return title, nil
+}
+
+// Returns nil, nil if the collection does not exist.
+func (c *Client) CollectionCreateSmart(title *string, filter *v1.BookFilter) (*string, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	body := map[string]interface{}{
+		"title":  *title,
+		"filter": filter,
+	}
+
+	if err := c.do(http.MethodPost, "collection/", nil, body, nil); err != nil {
+		return nil, err
+	}
+
+	return title, nil
+}
+
+func (c *Client) CollectionGet(title *string) (*v1.Collection, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	ret := struct {
+		Collection *v1.Collection `json:"collection"`
+	}{}
+
+	err := c.do(http.MethodGet, collectionPath(*title), nil, nil, &ret)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	return ret.Collection, err
+}
+
+func (c *Client) CollectionList(title *string) ([]v1.Collection, error) {
+	query := url.Values{}
+
+	if title != nil {
+		query.Set("title", *title)
+	}
+
+	ret := struct {
+		Collections []v1.Collection `json:"collections"`
+	}{}
+
+	err := c.do(http.MethodGet, "collection/", query, nil, &ret)
+
+	return ret.Collections, err
+}
+
+func (c *Client) CollectionSetParent(title *string, parent *string) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"parent": parent,
+	}
+
+	return c.do(http.MethodPut, collectionPath(*title)+"/parent", nil, body, nil)
+}
+
+func (c *Client) CollectionTree() ([]v1.Collection, error) {
+	query := url.Values{}
+	query.Set("tree", "true")
+
+	ret := struct {
+		Collections []v1.Collection `json:"collections"`
+	}{}
+
+	err := c.do(http.MethodGet, "collection/", query, nil, &ret)
+
+	return ret.Collections, err
+}
+
+func (c *Client) CollectionGetRecursive(title *string) (*v1.Collection, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	query := url.Values{}
+	query.Set("recursive", "true")
+
+	ret := struct {
+		Collection *v1.Collection `json:"collection"`
+	}{}
+
+	err := c.do(http.MethodGet, collectionPath(*title), query, nil, &ret)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	return ret.Collection, err
+}
+
+func (c *Client) CollectionUpdate(id int, u *v1.CollectionUpdate) (*v1.Collection, error) {
+	ret := struct {
+		Collection *v1.Collection `json:"collection"`
+	}{}
+
+	err := c.do(http.MethodPut, fmt.Sprintf("collection/id/%d", id), nil, u, &ret)
+
+	return ret.Collection, err
+}
+
+func (c *Client) CollectionRemove(title *string) error {
+	if title == nil {
+		return nil
+	}
+
+	return c.do(http.MethodDelete, collectionPath(*title), nil, nil, nil)
+}
+
+func (c *Client) CollectionAddBooks(title *string, bookIds []int) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"bookIds": bookIds,
+	}
+
+	return c.do(http.MethodPost, collectionPath(*title)+"/book", nil, body, nil)
+}
+
+func (c *Client) CollectionMoveBook(title *string, bookId int, position int) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"position": position,
+	}
+
+	return c.do(http.MethodPut, collectionPath(*title)+"/book/"+fmt.Sprint(bookId), nil, body, nil)
+}
+
+func (c *Client) CollectionReorder(title *string, bookIds []int) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"bookIds": bookIds,
+	}
+
+	return c.do(http.MethodPut, collectionPath(*title)+"/book", nil, body, nil)
+}
+
+// Sets the note on a book in a collection. A nil note is sent as null,
+// which clears it.
+func (c *Client) CollectionSetNote(title *string, bookId int, note *string) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"note": note,
+	}
+
+	return c.do(http.MethodPut, collectionPath(*title)+"/book/"+fmt.Sprint(bookId), nil, body, nil)
+}
+
+func (c *Client) CollectionSetPublic(title *string, public bool) error {
+	if title == nil {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"public": public,
+	}
+
+	return c.do(http.MethodPut, collectionPath(*title)+"/public", nil, body, nil)
+}
+
+// Returns the public collection as the shared, read-only view; ids and
+// timestamps are not set. Returns nil, nil if not found.
+func (c *Client) CollectionGetPublic(username string, title string) (*v1.Collection, error) {
+	return c.sharedGet("shared/" + url.PathEscape(username) + "/" + url.PathEscape(title))
+}
+
+func (c *Client) CollectionShareCreate(title *string, prefix string, tokenHash string, expiresTs *time.Time) (*int, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	body := map[string]interface{}{
+		"prefix":    prefix,
+		"tokenHash": tokenHash,
+	}
+
+	if expiresTs != nil {
+		body["expiresTs"] = expiresTs
+	}
+
+	ret := struct {
+		ShareId *int `json:"shareId"`
+	}{}
+
+	err := c.do(http.MethodPost, collectionPath(*title)+"/share", nil, body, &ret)
+
+	return ret.ShareId, err
+}
+
+func (c *Client) CollectionShareList(title *string) ([]v1.CollectionShare, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	ret := struct {
+		Shares []v1.CollectionShare `json:"shares"`
+	}{}
+
+	err := c.do(http.MethodGet, collectionPath(*title)+"/share", nil, nil, &ret)
+
+	return ret.Shares, err
+}
+
+func (c *Client) CollectionShareRevoke(id int) error {
+	return c.do(http.MethodDelete, "collection/share/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+// Share tokens are only stored hashed, so shared collections are fetched
+// by token with SharedGet instead.
+func (c *Client) CollectionGetByShareToken(tokenHash string) (*v1.Collection, error) {
+	return nil, ErrUnsupported
+}
+
+// Returns the collection shared by token as the shared, read-only view;
+// ids and timestamps are not set. Returns nil, nil if not found.
+func (c *Client) SharedGet(token string) (*v1.Collection, error) {
+	return c.sharedGet("shared/" + url.PathEscape(token))
+}
+
+func (c *Client) sharedGet(path string) (*v1.Collection, error) {
+	ret := struct {
+		Collection *v1.SharedCollection `json:"collection"`
+	}{}
+
+	err := c.do(http.MethodGet, path, nil, nil, &ret)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	if err != nil || ret.Collection == nil {
+		return nil, err
+	}
+
+	col := &v1.Collection{
+		Title: ret.Collection.Title,
+		Books: make([]v1.Book, len(ret.Collection.Books)),
+	}
+
+	for i, b := range ret.Collection.Books {
+		col.Books[i] = v1.Book{
+			Title: b.Title,
+			Author: v1.Author{
+				FirstName: b.Author.FirstName,
+				LastName:  b.Author.LastName,
+			},
+			PublishDate: b.PublishDate,
+			Edition:     b.Edition,
+			Description: b.Description,
+			Genre:       b.Genre,
+		}
+	}
+
+	return col, nil
+}
+
+func (c *Client) UserCreate(u *v1.User) (*int, error) {
+	if u == nil {
+		return nil, nil
+	}
+
+	ret := struct {
+		UserId *int `json:"userId"`
+	}{}
+
+	err := c.do(http.MethodPost, "user/", nil, u, &ret)
+
+	return ret.UserId, err
+}
+
+func (c *Client) UserGet(id int) (*v1.User, error) {
+	ret := struct {
+		User *v1.User `json:"user"`
+	}{}
+
+	err := c.do(http.MethodGet, "user/"+fmt.Sprint(id), nil, nil, &ret)
+
+	return ret.User, err
+}
+
+// Returns the user owning the client's API key.
+func (c *Client) Whoami() (*v1.User, error) {
+	ret := struct {
+		User *v1.User `json:"user"`
+	}{}
+
+	err := c.do(http.MethodGet, "user/me", nil, nil, &ret)
+
+	if err == nil && ret.User == nil {
+		err = ErrUnauthorized
+	}
+
+	return ret.User, err
+}
+
+// Returns nil, nil if no user found.
+func (c *Client) UserGetByName(username string) (*v1.User, error) {
+	ret := struct {
+		Users []v1.User `json:"users"`
+	}{}
+
+	err := c.do(http.MethodGet, "user/", url.Values{"username": {username}}, nil, &ret)
+
+	if err != nil || len(ret.Users) < 1 {
+		return nil, err
+	}
+
+	return &ret.Users[0], nil
+}
+
+func (c *Client) UserList() ([]v1.User, error) {
+	ret := struct {
+		Users []v1.User `json:"users"`
+	}{}
+
+	err := c.do(http.MethodGet, "user/", nil, nil, &ret)
+
+	return ret.Users, err
+}
+
+func (c *Client) ApiKeyCreate(k *v1.ApiKey, keyHash string) (*int, error) {
+	if k == nil {
+		return nil, nil
+	}
+
+	body := map[string]interface{}{
+		"name":    k.Name,
+		"scope":   k.Scope,
+		"userId":  k.UserId,
+		"prefix":  k.Prefix,
+		"keyHash": keyHash,
+	}
+
+	ret := struct {
+		ApiKeyId *int `json:"apiKeyId"`
+	}{}
+
+	err := c.do(http.MethodPost, "apikey/", nil, body, &ret)
+
+	return ret.ApiKeyId, err
+}
+
+func (c *Client) ApiKeyList() ([]v1.ApiKey, error) {
+	ret := struct {
+		ApiKeys []v1.ApiKey `json:"apiKeys"`
+	}{}
+
+	err := c.do(http.MethodGet, "apikey/", nil, nil, &ret)
+
+	return ret.ApiKeys, err
+}
+
+// Keys are only stored hashed and looked up by the server itself.
+func (c *Client) ApiKeyGetByHash(keyHash string) (*v1.ApiKey, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *Client) ApiKeyRevoke(id int) error {
+	return c.do(http.MethodDelete, "apikey/"+fmt.Sprint(id), nil, nil, nil)
+}
+
+func (c *Client) AuditList(filter *v1.AuditFilter) ([]v1.AuditEntry, error) {
+	query := url.Values{}
+
+	if filter == nil {
+		filter = &v1.AuditFilter{}
+	}
+
+	if filter.Entity != nil {
+		query.Set("entity", *filter.Entity)
+	}
+
+	if filter.EntityId != nil {
+		query.Set("entityId", fmt.Sprint(*filter.EntityId))
+	}
+
+	if filter.ActorId != nil {
+		query.Set("actorId", fmt.Sprint(*filter.ActorId))
+	}
+
+	if filter.Since != nil {
+		query.Set("since", filter.Since.Format(time.RFC3339Nano))
+	}
+
+	if filter.Until != nil {
+		query.Set("until", filter.Until.Format(time.RFC3339Nano))
+	}
+
+	if filter.Limit > 0 {
+		query.Set("limit", fmt.Sprint(filter.Limit))
+	}
+
+	ret := struct {
+		Entries []v1.AuditEntry `json:"entries"`
+	}{}
+
+	err := c.do(http.MethodGet, "audit", query, nil, &ret)
+
+	return ret.Entries, err
+}
+
+func (c *Client) TrashList() (*v1.Trash, error) {
+	ret := struct {
+		Trash *v1.Trash `json:"trash"`
+	}{}
+
+	err := c.do(http.MethodGet, "trash", nil, nil, &ret)
+
+	return ret.Trash, err
+}
+
+func (c *Client) TrashRestoreBook(id int) error {
+	return c.do(http.MethodPost, "trash/book/"+fmt.Sprint(id)+"/restore", nil, nil, nil)
+}
+
+func (c *Client) TrashRestoreCollection(id int) error {
+	return c.do(http.MethodPost, "trash/collection/"+fmt.Sprint(id)+"/restore", nil, nil, nil)
+}
+
+func (c *Client) TrashPurge(before *time.Time) (*v1.TrashPurgeReport, error) {
+	query := url.Values{}
+
+	if before != nil {
+		query.Set("before", before.Format(time.RFC3339Nano))
+	} else {
+		query.Set("all", "true")
+	}
+
+	ret := struct {
+		Report *v1.TrashPurgeReport `json:"report"`
+	}{}
+
+	err := c.do(http.MethodDelete, "trash", query, nil, &ret)
+
+	return ret.Report, err
+}
+
+func (c *Client) UndoList(count int) ([]v1.AuditEntry, error) {
+	query := url.Values{}
+	query.Set("count", fmt.Sprint(count))
+
+	ret := struct {
+		Entries []v1.AuditEntry `json:"entries"`
+	}{}
+
+	err := c.do(http.MethodGet, "undo", query, nil, &ret)
+
+	return ret.Entries, err
+}
+
+func (c *Client) Undo(auditIds []int) ([]v1.AuditEntry, error) {
+	ret := struct {
+		Entries []v1.AuditEntry `json:"entries"`
+	}{}
+
+	err := c.do(http.MethodPost, "undo", nil, map[string][]int{"auditIds": auditIds}, &ret)
+
+	return ret.Entries, err
+}
+
+func collectionPath(title string) string {
+	return "collection/" + url.PathEscape(title)
+}
@@ -0,0 +1,530 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func writeEnvelope(w http.ResponseWriter, code int, metadata map[string]interface{}) {
+	status := "Success"
+	if code != 200 {
+		status = "Failure"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":        "sync",
+		"status":      status,
+		"status_code": code,
+		"metadata":    metadata,
+	})
+}
+
+var _ = Describe("Client", func() {
+	var server *httptest.Server
+	var handler http.HandlerFunc
+	var c *Client
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+
+		c = New(server.URL+"/", "gs_secret")
+		c.RetryWait = time.Millisecond
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("requests", func() {
+		It("should send the bearer token and decode metadata", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(PathPrefix + "book/7"))
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer gs_secret"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"book": v1.Book{BookId: 7, Title: "Dune"},
+				})
+			}
+
+			book, err := c.BookGet(7)
+			Expect(err).To(BeNil())
+			Expect(book.Title).To(Equal("Dune"))
+		})
+
+		It("should encode filters as query values", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("title")).To(Equal("Dune"))
+				Expect(r.URL.Query().Get("edition")).To(Equal("2"))
+				Expect(r.URL.Query().Has("genre")).To(BeFalse())
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"books": []v1.Book{{BookId: 1}, {BookId: 2}},
+				})
+			}
+
+			title := "Dune"
+			edition := 2
+			books, err := c.BookFilter(&v1.BookFilter{Title: &title, Edition: &edition})
+			Expect(err).To(BeNil())
+			Expect(books).To(HaveLen(2))
+		})
+
+		It("should look up books by ISBN", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(PathPrefix + "book/isbn/978-0-441-17271-9"))
+
+				isbn13 := "9780441172719"
+				writeEnvelope(w, 200, map[string]interface{}{
+					"book": v1.Book{BookId: 7, Isbn13: &isbn13},
+				})
+			}
+
+			book, err := c.BookGetByIsbn("978-0-441-17271-9")
+			Expect(err).To(BeNil())
+			Expect(*book.Isbn13).To(Equal("9780441172719"))
+		})
+
+		It("should request enrichment without creating", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Query().Get("enrich")).To(Equal("true"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"book": v1.Book{Title: "Dune", Author: v1.Author{LastName: "Herbert"}},
+				})
+			}
+
+			book, err := c.BookEnrich(&v1.Book{Title: "Dune"})
+			Expect(err).To(BeNil())
+			Expect(book.Author.LastName).To(Equal("Herbert"))
+		})
+
+		It("should post progress updates", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "book/7/progress"))
+
+				update := v1.ProgressUpdate{}
+				Expect(json.NewDecoder(r.Body).Decode(&update)).To(Succeed())
+				Expect(*update.Page).To(Equal(42))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"progress": v1.ReadingState{BookId: 7, Status: v1.ReadingStatusReading, Page: update.Page},
+				})
+			}
+
+			page := 42
+			state, err := c.BookProgressUpdate(7, &v1.ProgressUpdate{Page: &page})
+			Expect(err).To(BeNil())
+			Expect(state.Status).To(Equal(v1.ReadingStatusReading))
+		})
+
+		It("should encode loan filters", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(PathPrefix + "loan/"))
+				Expect(r.URL.Query().Get("overdue")).To(Equal("true"))
+				Expect(r.URL.Query().Get("bookId")).To(Equal("7"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"loans": []v1.Loan{{LoanId: 1, BookId: 7, Borrower: "Sam"}},
+				})
+			}
+
+			bookId := 7
+			loans, err := c.LoanList(&v1.LoanFilter{BookId: &bookId, Overdue: true})
+			Expect(err).To(BeNil())
+			Expect(loans[0].Borrower).To(Equal("Sam"))
+		})
+
+		It("should encode audit filters", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(PathPrefix + "audit"))
+				Expect(r.URL.Query().Get("entity")).To(Equal("collection"))
+				Expect(r.URL.Query().Get("since")).To(Equal("2024-03-10T00:00:00Z"))
+				Expect(r.URL.Query().Get("limit")).To(Equal("5"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"entries": []map[string]interface{}{
+						{"auditId": 9, "entity": "collection", "entityId": 7, "action": "update", "after": map[string]string{"title": "sf"}},
+					},
+				})
+			}
+
+			entity := v1.AuditEntityCollection
+			since := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+			entries, err := c.AuditList(&v1.AuditFilter{Entity: &entity, Since: &since, Limit: 5})
+			Expect(err).To(BeNil())
+			Expect(entries[0].EntityId).To(Equal(7))
+			Expect(string(entries[0].After)).To(MatchJSON(`{"title": "sf"}`))
+		})
+
+		It("should purge the trash before a time", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodDelete))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "trash"))
+				Expect(r.URL.Query().Get("before")).To(Equal("2024-03-01T00:00:00Z"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"report": map[string]int{"books": 2, "collections": 1},
+				})
+			}
+
+			before := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			report, err := c.TrashPurge(&before)
+			Expect(err).To(BeNil())
+			Expect(*report).To(Equal(v1.TrashPurgeReport{Books: 2, Collections: 1}))
+		})
+
+		It("should ask for the whole trash to be purged without a time", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("all")).To(Equal("true"))
+				Expect(r.URL.Query().Has("before")).To(BeFalse())
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"report": map[string]int{"books": 0, "collections": 0},
+				})
+			}
+
+			_, err := c.TrashPurge(nil)
+			Expect(err).To(BeNil())
+		})
+
+		It("should undo the last changes", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "undo"))
+
+				body := map[string]interface{}{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(HaveKeyWithValue("auditIds", Equal([]interface{}{11.0, 10.0})))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"entries": []map[string]interface{}{
+						{"auditId": 11, "entity": "book", "entityId": 4, "action": "delete"},
+						{"auditId": 10, "entity": "collection", "entityId": 7, "action": "update"},
+					},
+				})
+			}
+
+			entries, err := c.Undo([]int{11, 10})
+			Expect(err).To(BeNil())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].AuditId).To(Equal(11))
+		})
+
+		It("should move copies off the shelves with a null location", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "copy/5/move"))
+
+				body := map[string]interface{}{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(HaveKeyWithValue("locationId", BeNil()))
+
+				writeEnvelope(w, 200, map[string]interface{}{})
+			}
+
+			Expect(c.CopyMove(5, nil)).To(Succeed())
+		})
+
+		It("should put books in series with fractional positions", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPut))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "series/2/book/7"))
+
+				body := map[string]float64{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body["position"]).To(Equal(2.5))
+
+				writeEnvelope(w, 200, map[string]interface{}{})
+			}
+
+			Expect(c.SeriesSetBook(2, 7, 2.5)).To(Succeed())
+		})
+
+		It("should put reviews and sort by rating", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					Expect(r.URL.Query().Get("sort")).To(Equal(v1.BookSortRating))
+
+					writeEnvelope(w, 200, map[string]interface{}{"books": []v1.Book{}})
+					return
+				}
+
+				Expect(r.Method).To(Equal(http.MethodPut))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "book/7/review"))
+
+				review := v1.Review{}
+				Expect(json.NewDecoder(r.Body).Decode(&review)).To(Succeed())
+
+				writeEnvelope(w, 200, map[string]interface{}{"review": review})
+			}
+
+			rating := 4.5
+			review, err := c.ReviewSet(&v1.Review{BookId: 7, Rating: &rating})
+			Expect(err).To(BeNil())
+			Expect(*review.Rating).To(Equal(4.5))
+
+			sort := v1.BookSortRating
+			_, err = c.BookFilter(&v1.BookFilter{Sort: &sort})
+			Expect(err).To(BeNil())
+		})
+
+		It("should list a work's editions", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal(PathPrefix + "work/4"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"work": v1.Work{WorkId: 4, Title: "Dune", Editions: []v1.Book{{BookId: 1, WorkId: 4}, {BookId: 9, WorkId: 4}}},
+				})
+			}
+
+			work, err := c.WorkGet(4)
+			Expect(err).To(BeNil())
+			Expect(work.Editions).To(HaveLen(2))
+		})
+
+		It("should post smart collections with their filter", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "collection/"))
+
+				body := struct {
+					Title  string        `json:"title"`
+					Filter v1.BookFilter `json:"filter"`
+				}{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(*body.Filter.Genre).To(Equal("sci-fi"))
+				Expect(body.Filter.PublishedBefore.Year()).To(Equal(1980))
+
+				writeEnvelope(w, 200, map[string]interface{}{})
+			}
+
+			title := "classics"
+			genre := "sci-fi"
+			before := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+			_, err := c.CollectionCreateSmart(&title, &v1.BookFilter{Genre: &genre, PublishedBefore: &before})
+			Expect(err).To(BeNil())
+		})
+
+		It("should send a null note to clear it", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPut))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "collection/syllabus/book/7"))
+
+				body := map[string]interface{}{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(HaveKeyWithValue("note", BeNil()))
+
+				writeEnvelope(w, 200, map[string]interface{}{})
+			}
+
+			title := "syllabus"
+			Expect(c.CollectionSetNote(&title, 7, nil)).To(Succeed())
+		})
+
+		It("should request collection trees and recursive reads", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == PathPrefix+"collection/" {
+					Expect(r.URL.Query().Get("tree")).To(Equal("true"))
+
+					writeEnvelope(w, 200, map[string]interface{}{
+						"collections": []v1.Collection{{Title: "courses", Children: []v1.Collection{{Title: "algorithms"}}}},
+					})
+					return
+				}
+
+				Expect(r.URL.Path).To(Equal(PathPrefix + "collection/courses"))
+				Expect(r.URL.Query().Get("recursive")).To(Equal("true"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"collection": v1.Collection{Title: "courses", Books: []v1.Book{{BookId: 1}, {BookId: 2}}},
+				})
+			}
+
+			tree, err := c.CollectionTree()
+			Expect(err).To(BeNil())
+			Expect(tree[0].Children[0].Title).To(Equal("algorithms"))
+
+			title := "courses"
+			col, err := c.CollectionGetRecursive(&title)
+			Expect(err).To(BeNil())
+			Expect(col.Books).To(HaveLen(2))
+		})
+
+		It("should put collection updates by id", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPut))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "collection/id/7"))
+
+				body := map[string]interface{}{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body["title"]).To(Equal("Cours d'été"))
+				Expect(body).ToNot(HaveKey("coverUrl"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"collection": map[string]interface{}{"collectionId": 7, "title": "Cours d'été", "slug": "cours-d-été"},
+				})
+			}
+
+			title := "Cours d'été"
+			col, err := c.CollectionUpdate(7, &v1.CollectionUpdate{Title: &title})
+			Expect(err).To(BeNil())
+			Expect(col.Slug).To(Equal("cours-d-été"))
+		})
+
+		It("should escape Unicode collection titles", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.EscapedPath()).To(Equal(PathPrefix + "collection/Lectures%20d%27%C3%A9t%C3%A9"))
+
+				writeEnvelope(w, 200, map[string]interface{}{
+					"collection": map[string]interface{}{"title": "Lectures d'été"},
+				})
+			}
+
+			title := "Lectures d'été"
+			col, err := c.CollectionGet(&title)
+			Expect(err).To(BeNil())
+			Expect(col.Title).To(Equal(title))
+		})
+
+		It("should merge books", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal(PathPrefix + "book/3/merge"))
+
+				body := map[string]int{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body["bookId"]).To(Equal(9))
+
+				writeEnvelope(w, 200, map[string]interface{}{})
+			}
+
+			Expect(c.BookMerge(3, 9)).To(Succeed())
+		})
+
+		It("should post books as JSON", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+				book := v1.Book{}
+				Expect(json.NewDecoder(r.Body).Decode(&book)).To(Succeed())
+				Expect(book.Title).To(Equal("Dune"))
+
+				writeEnvelope(w, 200, map[string]interface{}{"bookId": 3})
+			}
+
+			id, err := c.BookCreate(&v1.Book{Title: "Dune"})
+			Expect(err).To(BeNil())
+			Expect(*id).To(Equal(3))
+		})
+	})
+
+	Context("errors", func() {
+		It("should map failure envelopes to errors", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				writeEnvelope(w, 401, map[string]interface{}{"message": "invalid api key"})
+			}
+
+			_, err := c.BookGet(1)
+			Expect(errors.Is(err, ErrUnauthorized)).To(BeTrue())
+
+			apiErr := &Error{}
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Message).To(Equal("invalid api key"))
+		})
+
+		It("should match duplicate books to the conflict error", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				writeEnvelope(w, 409, map[string]interface{}{"message": "a book with this isbn already exists"})
+			}
+
+			_, err := c.BookCreate(&v1.Book{Title: "Dune"})
+			Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+		})
+
+		It("should return nil for missing collections", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				writeEnvelope(w, 404, map[string]interface{}{"message": "not found"})
+			}
+
+			title := "missing"
+			col, err := c.CollectionGet(&title)
+			Expect(err).To(BeNil())
+			Expect(col).To(BeNil())
+		})
+
+		It("should match missing records by status code only", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				writeEnvelope(w, 400, map[string]interface{}{"message": "parent collection not found"})
+			}
+
+			title, parent := "week-1", "missing"
+			err := c.CollectionSetParent(&title, &parent)
+			Expect(errors.Is(err, ErrNotFound)).To(BeFalse())
+
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				writeEnvelope(w, 404, map[string]interface{}{"message": "loan not found"})
+			}
+
+			err = c.LoanReturn(3)
+			Expect(errors.Is(err, ErrNotFound)).To(BeTrue())
+			Expect(errors.Is(err, db.ErrNotFound)).To(BeTrue())
+		})
+
+		It("should retry transient failures", func() {
+			calls := 0
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				writeEnvelope(w, 200, map[string]interface{}{"books": []v1.Book{}})
+			}
+
+			_, err := c.BookFilter(nil)
+			Expect(err).To(BeNil())
+			Expect(calls).To(Equal(3))
+		})
+
+		It("should not retry creates", func() {
+			calls := 0
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			_, err := c.BookCreate(&v1.Book{Title: "Dune"})
+			Expect(err).ToNot(BeNil())
+			Expect(calls).To(Equal(1))
+		})
+
+		It("should stop when the context is cancelled", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := c.WithContext(ctx).BookFilter(nil)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		})
+	})
+})
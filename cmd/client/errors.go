@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden")
+var ErrNotFound = errors.New("not found")
+var ErrUnsupported = errors.New("not supported over HTTP")
+
+// An error returned by the server in a Failure envelope.
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func newError(envelope *response) *Error {
+	e := &Error{
+		StatusCode: envelope.StatusCode,
+		Status:     envelope.Status,
+	}
+
+	metadata := struct {
+		Message string `json:"message"`
+	}{}
+
+	if err := json.Unmarshal(envelope.Metadata, &metadata); err == nil {
+		e.Message = metadata.Message
+	}
+
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("goshelf: %d %s", e.StatusCode, e.Status)
+	}
+
+	return "goshelf: " + e.Message
+}
+
+// Allows errors.Is(err, ErrNotFound) and friends. A 404 also matches
+// db.ErrNotFound and a 409 db.ErrConflict, as the database backend returns.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case db.ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case db.ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
@@ -1,10 +1,97 @@
 package db
 
+import (
+	"time"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
 type ConnectionConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DbName   string
-	SslMode  string
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	DbName      string
+	SslMode     string
+	SslRootCert string // Optional CA file used to verify the server
+	SslCert     string // Optional client certificate file
+	SslKey      string // Optional client key file
+}
+
+// The operations shared by the CLI and API. Implemented by each backend.
+type GoshelfQuerier interface {
+	Connect() error
+	AsUser(u *v1.User) GoshelfQuerier
+	BookCreate(b *v1.Book) (*int, error)
+	BookGet(id int) (*v1.Book, error)
+	BookRemove(id int) error
+	BookMerge(keep int, drop int) error
+	BookFilter(filter *v1.BookFilter) ([]v1.Book, error)
+	BookProgressGet(bookId int) (*v1.ReadingState, error)
+	BookProgressUpdate(bookId int, u *v1.ProgressUpdate) (*v1.ReadingState, error)
+	LoanCreate(l *v1.Loan) (*int, error)
+	LoanGet(id int) (*v1.Loan, error)
+	LoanList(filter *v1.LoanFilter) ([]v1.Loan, error)
+	LoanReturn(id int) error
+	CopyCreate(c *v1.Copy) (*int, error)
+	CopyGet(id int) (*v1.Copy, error)
+	CopyList(filter *v1.CopyFilter) ([]v1.Copy, error)
+	CopyMove(id int, locationId *int) error
+	CopyRemove(id int) error
+	LocationCreate(l *v1.Location) (*int, error)
+	LocationList() ([]v1.Location, error)
+	LocationRemove(id int) error
+	SeriesCreate(s *v1.Series) (*int, error)
+	SeriesGet(id int) (*v1.Series, error)
+	SeriesList() ([]v1.Series, error)
+	SeriesRemove(id int) error
+	SeriesSetBook(seriesId int, bookId int, position float64) error
+	SeriesRemoveBook(seriesId int, bookId int) error
+	SeriesNextUnread(id int) (*v1.Book, error)
+	ReviewList(bookId int) ([]v1.Review, error)
+	ReviewSet(r *v1.Review) (*v1.Review, error)
+	ReviewRemove(bookId int) error
+	NoteCreate(n *v1.Note) (*int, error)
+	NoteGet(id int) (*v1.Note, error)
+	NoteList(bookId int) ([]v1.Note, error)
+	NoteUpdate(n *v1.Note) error
+	NoteRemove(id int) error
+	WorkGet(id int) (*v1.Work, error)
+	WorkList() ([]v1.Work, error)
+	WorkUpdate(w *v1.Work) error
+	WorkSetBook(workId int, bookId int) error
+	CollectionCreate(title *string, bookIds []int) (*string, error)
+	CollectionCreateSmart(title *string, filter *v1.BookFilter) (*string, error)
+	CollectionGet(title *string) (*v1.Collection, error)
+	CollectionList(title *string) ([]v1.Collection, error)
+	CollectionRemove(title *string) error
+	CollectionUpdate(id int, u *v1.CollectionUpdate) (*v1.Collection, error)
+	CollectionSetParent(title *string, parent *string) error
+	CollectionTree() ([]v1.Collection, error)
+	CollectionGetRecursive(title *string) (*v1.Collection, error)
+	CollectionAddBooks(title *string, bookIds []int) error
+	CollectionMoveBook(title *string, bookId int, position int) error
+	CollectionReorder(title *string, bookIds []int) error
+	CollectionSetNote(title *string, bookId int, note *string) error
+	CollectionSetPublic(title *string, public bool) error
+	CollectionGetPublic(username string, title string) (*v1.Collection, error)
+	CollectionShareCreate(title *string, prefix string, tokenHash string, expiresTs *time.Time) (*int, error)
+	CollectionShareList(title *string) ([]v1.CollectionShare, error)
+	CollectionShareRevoke(id int) error
+	CollectionGetByShareToken(tokenHash string) (*v1.Collection, error)
+	UserCreate(u *v1.User) (*int, error)
+	UserGet(id int) (*v1.User, error)
+	UserGetByName(username string) (*v1.User, error)
+	UserList() ([]v1.User, error)
+	ApiKeyCreate(k *v1.ApiKey, keyHash string) (*int, error)
+	ApiKeyList() ([]v1.ApiKey, error)
+	ApiKeyGetByHash(keyHash string) (*v1.ApiKey, error)
+	ApiKeyRevoke(id int) error
+	AuditList(filter *v1.AuditFilter) ([]v1.AuditEntry, error)
+	TrashList() (*v1.Trash, error)
+	TrashRestoreBook(id int) error
+	TrashRestoreCollection(id int) error
+	TrashPurge(before *time.Time) (*v1.TrashPurgeReport, error)
+	UndoList(count int) ([]v1.AuditEntry, error)
+	Undo(auditIds []int) ([]v1.AuditEntry, error)
 }
@@ -0,0 +1,45 @@
+package db
+
+import "errors"
+
+// Matched with errors.Is when a write would duplicate an existing record.
+// The API returns these as 409 Conflict.
+var ErrConflict = errors.New("conflict")
+
+type conflictError struct {
+	message string
+}
+
+// Returns an error with message that matches ErrConflict.
+func Conflict(message string) error {
+	return &conflictError{message: message}
+}
+
+func (e *conflictError) Error() string {
+	return e.message
+}
+
+func (e *conflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Matched with errors.Is when the record a request is about doesn't
+// exist. The API returns these as 404 Not Found.
+var ErrNotFound = errors.New("not found")
+
+type notFoundError struct {
+	message string
+}
+
+// Returns an error with message that matches ErrNotFound.
+func NotFound(message string) error {
+	return &notFoundError{message: message}
+}
+
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
@@ -0,0 +1,137 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	_ "github.com/lib/pq"
+)
+
+// Stores a new API key. Only the hash of the secret is persisted; the
+// secret itself is never written to the database. The key belongs to
+// k.UserId, or the current user if unset; only admins may create keys for
+// other users. Returns the api_key_id.
+func (pg *PgDb) ApiKeyCreate(k *v1.ApiKey, keyHash string) (*int, error) {
+	if k == nil {
+		return nil, nil
+	}
+
+	userId := k.UserId
+
+	if userId == 0 {
+		id, err := pg.ownerId()
+
+		if err != nil {
+			return nil, err
+		}
+
+		userId = id
+	}
+
+	if pg.isScoped() && userId != pg.User.UserId {
+		return nil, errors.New("admin role required")
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.api_key (user_id, name, prefix, key_hash, scope)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING api_key_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, k.Name, k.Prefix, keyHash, k.Scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns all API keys, including revoked keys. Members only see their
+// own keys.
+func (pg *PgDb) ApiKeyList() ([]v1.ApiKey, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT k.api_key_id, k.user_id, k.created_ts, k.name, k.prefix, k.scope, k.revoked_ts
+		FROM %s.api_key k
+	`, pg.SchemaVersion)
+
+	values := make([]interface{}, 0)
+
+	if pg.isScoped() {
+		queryStr += " WHERE k.user_id = $1 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY k.api_key_id ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedApiKeys(rows)
+}
+
+// Returns the active (non-revoked) API key matching the hash.
+// Returns nil, nil if no key matches.
+func (pg *PgDb) ApiKeyGetByHash(keyHash string) (*v1.ApiKey, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT k.api_key_id, k.user_id, k.created_ts, k.name, k.prefix, k.scope, k.revoked_ts
+		FROM %s.api_key k
+		WHERE k.key_hash = $1 AND k.revoked_ts IS NULL
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, keyHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ScanReturnedApiKeys(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) < 1 {
+		return nil, nil
+	}
+
+	return &keys[0], nil
+}
+
+// Revokes an API key by id. Revoked keys are kept for auditing. Members
+// may only revoke their own keys.
+func (pg *PgDb) ApiKeyRevoke(id int) error {
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.api_key
+		SET revoked_ts = CURRENT_TIMESTAMP
+		WHERE api_key_id = $1 AND revoked_ts IS NULL
+	`, pg.SchemaVersion)
+
+	values := []interface{}{id}
+
+	if pg.isScoped() {
+		queryStr += " AND user_id = $2 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" RETURNING api_key_id ", values...)
+
+	if err != nil {
+		return err
+	}
+
+	revokedId, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if revokedId == nil {
+		return db.NotFound("api key not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package postgresql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Records a change to an entity in the audit log, acting as pg.User.
+// before and after are stored as JSON, nil (or a nil pointer) for the side
+// that doesn't exist. Should run in the transaction making the change.
+// Changes made by an undo are linked to the entry they reverse.
+func (pg *PgDb) audit(entity string, entityId int, ownerId *int, action string, before interface{}, after interface{}) error {
+	var actorId *int
+	var actor *string
+
+	if pg.User != nil {
+		actorId, actor = &pg.User.UserId, &pg.User.Username
+	}
+
+	values := []interface{}{actorId, actor, ownerId, entity, entityId, action, pg.undoOf}
+
+	for _, side := range []interface{}{before, after} {
+		var value interface{}
+
+		if side != nil && !reflect.ValueOf(side).IsNil() {
+			sideJson, err := json.Marshal(side)
+
+			if err != nil {
+				return err
+			}
+
+			value = string(sideJson)
+		}
+
+		values = append(values, value)
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.audit_log (actor_id, actor, owner_id, entity, entity_id, action, undo_of, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, pg.SchemaVersion)
+
+	_, err := pg.conn().Exec(queryStr, values...)
+
+	return err
+}
+
+// Records a change to the book with the given id. before is the book
+// beforehand, nil for creates. The book is read again unless deleted.
+func (pg *PgDb) auditBook(action string, id int, before *v1.Book) error {
+	var after *v1.Book
+
+	if action != v1.AuditActionDelete {
+		book, err := pg.BookGet(id)
+
+		if err != nil {
+			return err
+		}
+
+		after = book
+	}
+
+	book := before
+
+	if book == nil {
+		book = after
+	}
+
+	if book == nil {
+		return nil
+	}
+
+	return pg.audit(v1.AuditEntityBook, id, &book.OwnerId, action, before, after)
+}
+
+// Runs fn in a transaction and records its change to the current user's
+// collection titled title. A collection that doesn't exist beforehand is
+// recorded as created and one gone afterwards as deleted; renames are
+// followed by id. Nothing is recorded if fn changes nothing, unless it is
+// an undo, which always records the entry it reverses.
+func (pg *PgDb) auditCollection(title *string, fn func(tx *PgDb) error) error {
+	if title == nil {
+		return fn(pg)
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	return pg.inTx(func(tx *PgDb) error {
+		before, err := tx.collectionSnapshot(ownerId, func() (*v1.Collection, error) {
+			return tx.collectionGetByTitle(ownerId, *title)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		after, err := tx.collectionSnapshot(ownerId, func() (*v1.Collection, error) {
+			if before != nil {
+				return tx.collectionGetById(ownerId, before.CollectionId)
+			}
+
+			return tx.collectionGetByTitle(ownerId, *title)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		var action string
+		var id int
+
+		switch {
+		case before == nil && after == nil:
+			return nil
+		case before == nil:
+			action, id = v1.AuditActionCreate, after.CollectionId
+		case after == nil:
+			action, id = v1.AuditActionDelete, before.CollectionId
+		default:
+			beforeJson, err := json.Marshal(before)
+
+			if err != nil {
+				return err
+			}
+
+			afterJson, err := json.Marshal(after)
+
+			if err != nil {
+				return err
+			}
+
+			if bytes.Equal(beforeJson, afterJson) && tx.undoOf == nil {
+				return nil
+			}
+
+			action, id = v1.AuditActionUpdate, before.CollectionId
+		}
+
+		return tx.audit(v1.AuditEntityCollection, id, &ownerId, action, before, after)
+	})
+}
+
+// Returns the collection found by get with its entries in place of books,
+// as recorded in the audit log. Returns nil, nil if not found.
+func (pg *PgDb) collectionSnapshot(ownerId int, get func() (*v1.Collection, error)) (*v1.Collection, error) {
+	collection, err := get()
+
+	if err != nil || collection == nil {
+		return nil, err
+	}
+
+	collection.Books = nil
+
+	if collection.Smart {
+		return collection, nil
+	}
+
+	collection.Entries, err = pg.collectionEntries(ownerId, collection.Title)
+
+	return collection, err
+}
+
+// Returns audit log entries matching filter, newest first. Members see
+// changes to their own books and collections and changes they made;
+// admins and unscoped queriers see everything.
+func (pg *PgDb) AuditList(filter *v1.AuditFilter) ([]v1.AuditEntry, error) {
+	if filter == nil {
+		filter = &v1.AuditFilter{}
+	}
+
+	wheres := []string{}
+	values := []interface{}{}
+
+	where := func(condition string, value interface{}) {
+		values = append(values, value)
+		wheres = append(wheres, fmt.Sprintf(condition, len(values)))
+	}
+
+	if pg.isScoped() {
+		where("(a.owner_id = $%[1]d OR a.actor_id = $%[1]d)", pg.User.UserId)
+	}
+
+	if filter.Entity != nil {
+		if err := v1.ValidateAuditEntity(*filter.Entity); err != nil {
+			return nil, err
+		}
+
+		where("a.entity = $%d", *filter.Entity)
+	}
+
+	if filter.EntityId != nil {
+		where("a.entity_id = $%d", *filter.EntityId)
+	}
+
+	if filter.ActorId != nil {
+		where("a.actor_id = $%d", *filter.ActorId)
+	}
+
+	if filter.Since != nil {
+		where("a.created_ts >= $%d", *filter.Since)
+	}
+
+	if filter.Until != nil {
+		where("a.created_ts < $%d", *filter.Until)
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT a.audit_id, a.created_ts, a.actor_id, a.actor, a.owner_id,
+			a.entity, a.entity_id, a.action, a.before, a.after, a.undo_of
+		FROM %s.audit_log a
+	`, pg.SchemaVersion)
+
+	if len(wheres) > 0 {
+		queryStr += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	queryStr += " ORDER BY a.created_ts DESC, a.audit_id DESC "
+
+	if filter.Limit > 0 {
+		queryStr += fmt.Sprintf(" LIMIT %d ", filter.Limit)
+	}
+
+	rows, err := pg.conn().Query(queryStr, values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedAuditEntries(rows)
+}
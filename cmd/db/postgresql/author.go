@@ -18,7 +18,7 @@ func (pg *PgDb) GetAuthorByName(b *v1.Book) (*v1.Author, error) {
 		SELECT a.author_id, a.created_ts, a.first_name, a.last_name FROM %s.author a WHERE first_name = $1 AND last_name = $2
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(
+	rows, err := pg.conn().Query(
 		queryStr,
 		b.Author.FirstName,
 		b.Author.LastName,
@@ -74,16 +74,38 @@ func (pg *PgDb) CreateAuthorIfNew(b *v1.Book) (*int, error) {
 		RETURNING author_id
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(
-		queryStr,
-		b.Author.FirstName,
-		b.Author.LastName,
-	)
+	var id *int
+
+	err = pg.inTx(func(tx *PgDb) error {
+		rows, err := tx.conn().Query(
+			queryStr,
+			b.Author.FirstName,
+			b.Author.LastName,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		id, err = ScanReturnedId(rows)
+
+		if err != nil || id == nil {
+			return err
+		}
+
+		// Authors are shared, so they have no owner
+		author, err := tx.GetAuthorByName(b)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(v1.AuditEntityAuthor, *id, nil, v1.AuditActionCreate, nil, author)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return ScanReturnedId(rows)
-
+	return id, nil
 }
@@ -1,32 +1,129 @@
 package postgresql
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/db"
+	"github.com/Max-Clark/goshelf/cmd/isbn"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// Creates a new book in the database. Returns the book_id generated.
+// Creates a new book in the database as an edition of b.WorkId, or of a
+// new work if not set. Returns the book_id generated.
 func (pg *PgDb) BookCreate(b *v1.Book) (*int, error) {
 	if b == nil {
 		return nil, nil
 	}
 
+	var id *int
+
+	err := pg.inTx(func(tx *PgDb) error {
+		var err error
+		id, err = tx.bookCreate(b)
+
+		if err != nil || id == nil {
+			return err
+		}
+
+		return tx.auditBook(v1.AuditActionCreate, *id, nil)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+func (pg *PgDb) bookCreate(b *v1.Book) (*int, error) {
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = isbn.NormalizeBook(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers, err := normalizeIdentifiers(b.Identifiers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b.TranslationOf != nil {
+		if err := pg.checkBookVisible(*b.TranslationOf); err != nil {
+			return nil, err
+		}
+	}
+
 	authId, err := pg.CreateAuthorIfNew(b)
 
 	if err != nil {
 		return nil, err
 	}
 
+	existing, err := pg.bookIdentityExists(b, *authId, ownerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existing {
+		return nil, db.Conflict(bookIdentityConflict)
+	}
+
+	// Trashed books keep their ISBN until purged
+	if b.Isbn13 != nil {
+		trashed, err := pg.trashedBookWithIsbn(ownerId, *b.Isbn13)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if trashed {
+			return nil, db.Conflict("a book with this isbn is in the trash")
+		}
+	}
+
+	workId := b.WorkId
+
+	if workId == 0 {
+		newWorkId, err := pg.workCreateFor(b, ownerId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		workId = *newWorkId
+	} else {
+		work, err := pg.workGet(workId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if work.OwnerId != ownerId {
+			return nil, errors.New("work belongs to another user")
+		}
+	}
+
 	// TODO: automate this with tags
-	inserts := []string{"title", "author_id"}
+	inserts := []string{"title", "author_id", "owner_id", "work_id"}
 	queryValues := []interface{}{
 		b.Title,
 		authId,
+		ownerId,
+		workId,
 	}
 
 	if b.PublishDate != nil {
@@ -49,6 +146,21 @@ func (pg *PgDb) BookCreate(b *v1.Book) (*int, error) {
 		queryValues = append(queryValues, b.Genre)
 	}
 
+	if b.Isbn13 != nil {
+		inserts = append(inserts, "isbn13")
+		queryValues = append(queryValues, b.Isbn13)
+	}
+
+	if b.Language != nil {
+		inserts = append(inserts, "language")
+		queryValues = append(queryValues, b.Language)
+	}
+
+	if b.TranslationOf != nil {
+		inserts = append(inserts, "translation_of")
+		queryValues = append(queryValues, b.TranslationOf)
+	}
+
 	valueVars := make([]string, len(inserts))
 	for i := 0; i < len(valueVars); i++ {
 		valueVars[i] = "$" + fmt.Sprint(i+1)
@@ -64,35 +176,207 @@ func (pg *PgDb) BookCreate(b *v1.Book) (*int, error) {
 		strings.Join(valueVars, " , "),
 	)
 
-	rows, err := pg.SqlDb.Query(
+	rows, err := pg.conn().Query(
 		queryStr,
 		queryValues...,
 	)
 
+	// A work created for the book is rolled back with it. The identity
+	// check above can race another create; the index settles it.
 	if err != nil {
+		if isUniqueViolationOf(err, bookIdentityIndex) {
+			return nil, db.Conflict(bookIdentityConflict)
+		}
+
+		if isUniqueViolation(err) {
+			return nil, db.Conflict("a book with this isbn already exists")
+		}
+
 		return nil, err
 	}
 
-	return ScanReturnedId(rows)
+	id, err := ScanReturnedId(rows)
+
+	if err != nil || id == nil {
+		return id, err
+	}
+
+	return id, pg.insertIdentifiers(*id, identifiers)
+}
+
+// The unique index on a book's identity, see bookIdentityExists, and the
+// conflict reported for a clash
+const (
+	bookIdentityIndex    = "book_identity_un"
+	bookIdentityConflict = "a book with this title, author, edition and publish date already exists"
+)
+
+// Returns true if the owner already has a book with b's identity: title
+// (ignoring case), author, edition and publish date.
+func (pg *PgDb) bookIdentityExists(b *v1.Book, authorId int, ownerId int) (bool, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT b.book_id FROM %s.book b
+		WHERE b.owner_id = $1
+			AND b.author_id = $2
+			AND lower(b.title) = lower($3)
+			AND b.edition IS NOT DISTINCT FROM $4
+			AND b.publish_date IS NOT DISTINCT FROM $5
+			AND b.deleted_ts IS NULL
+		LIMIT 1
+	`, pg.SchemaVersion)
+
+	var publishDate interface{}
+
+	if b.PublishDate != nil {
+		publishDate = b.PublishDate.Format(time.RFC3339)
+	}
+
+	rows, err := pg.conn().Query(queryStr, ownerId, authorId, b.Title, b.Edition, publishDate)
+
+	if err != nil {
+		return false, err
+	}
+
+	id, err := ScanReturnedId(rows)
+
+	return id != nil, err
+}
+
+// Validates identifiers, lower-casing types and trimming values. ISBNs
+// have their own fields and are rejected here.
+func normalizeIdentifiers(identifiers []v1.Identifier) ([]v1.Identifier, error) {
+	normalized := make([]v1.Identifier, 0, len(identifiers))
+
+	for _, i := range identifiers {
+		i.Type = strings.ToLower(strings.TrimSpace(i.Type))
+		i.Value = strings.TrimSpace(i.Value)
+
+		if i.Type == "" || i.Value == "" {
+			return nil, errors.New("identifiers need a type and value")
+		}
+
+		if strings.HasPrefix(i.Type, "isbn") {
+			return nil, errors.New("use the isbn10 or isbn13 fields for isbns")
+		}
+
+		normalized = append(normalized, i)
+	}
+
+	return normalized, nil
 }
 
-// Returns a book from the database based on id.
+func (pg *PgDb) insertIdentifiers(bookId int, identifiers []v1.Identifier) error {
+	if len(identifiers) < 1 {
+		return nil
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.book_identifier (book_id, type, value)
+		VALUES `, pg.SchemaVersion)
+
+	values := make([]string, len(identifiers))
+	varArgs := []interface{}{bookId}
+
+	for i, identifier := range identifiers {
+		values[i] = fmt.Sprintf(" ( $1, $%d, $%d ) ", len(varArgs)+1, len(varArgs)+2)
+		varArgs = append(varArgs, identifier.Type, identifier.Value)
+	}
+
+	queryStr += strings.Join(values, ",") + " ON CONFLICT DO NOTHING "
+
+	rows, err := pg.conn().Query(queryStr, varArgs...)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Scans the books returned by rows and loads their identifiers, series
+// and ratings.
+func (pg *PgDb) scanBooks(rows *sql.Rows) ([]v1.Book, error) {
+	books, err := ScanReturnedBooks(rows)
+
+	if err != nil || len(books) < 1 {
+		return books, err
+	}
+
+	bookIds := make([]int, len(books))
+	index := map[int]int{}
+
+	for i, b := range books {
+		bookIds[i] = b.BookId
+		index[b.BookId] = i
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT i.book_id, i.type, i.value
+		FROM %s.book_identifier i
+		WHERE i.book_id = ANY($1)
+		ORDER BY i.type, i.value
+	`, pg.SchemaVersion)
+
+	idRows, err := pg.conn().Query(queryStr, pq.Array(bookIds))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer idRows.Close()
+
+	for idRows.Next() {
+		var bookId int
+		var identifier v1.Identifier
+
+		err := idRows.Scan(&bookId, &identifier.Type, &identifier.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		book := &books[index[bookId]]
+		book.Identifiers = append(book.Identifiers, identifier)
+	}
+
+	if err := idRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := pg.loadBookSeries(books, index); err != nil {
+		return nil, err
+	}
+
+	return books, pg.loadBookRatings(books, index)
+}
+
+// Returns a book from the database based on id. Members may only read
+// their own books.
 func (pg *PgDb) BookGet(id int) (*v1.Book, error) {
 
 	queryStr := fmt.Sprintf(`
-		SELECT b.book_id, b.created_ts, b.title, b.publish_date, b.edition, b.description, b.genre, a.author_id, a.created_ts, a.first_name, a.last_name
+		SELECT %s
 		FROM %s.book b 
 		INNER JOIN %s.author a ON b.author_id = a.author_id 
-		WHERE b.book_id = $1
-	`, pg.SchemaVersion, pg.SchemaVersion)
+		WHERE b.book_id = $1 AND b.deleted_ts IS NULL
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(queryStr, id)
+	values := []interface{}{id}
+
+	if pg.isScoped() {
+		queryStr += " AND b.owner_id = $2 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr, values...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	books, err := ScanReturnedBooks(rows)
+	books, err := pg.scanBooks(rows)
 
 	if err != nil {
 		return nil, err
@@ -102,54 +386,103 @@ func (pg *PgDb) BookGet(id int) (*v1.Book, error) {
 		return nil, nil
 	}
 
+	books[0].Loan, err = pg.activeLoan(id)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return &books[0], nil
 }
 
-// Removes a book from the database based on ID.
+// Moves a book to the trash. It keeps its collection memberships, copies
+// and history, and can be restored until purged. Members may only remove
+// their own books.
 func (pg *PgDb) BookRemove(id int) error {
-	// the SQL object doesn't return rows adjusted, so we'll check
-	// to see if the book exists and error if not
-	book, err := pg.BookGet(id)
+	return pg.inTx(func(tx *PgDb) error {
+		// the SQL object doesn't return rows adjusted, so we'll check
+		// to see if the book exists (and is visible to the user) and error if not
+		book, err := tx.BookGet(id)
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
 
-	if book == nil {
-		return errors.New("book not found")
-	}
+		if book == nil {
+			return db.NotFound("book not found")
+		}
+
+		queryStr := fmt.Sprintf(`
+			UPDATE %s.book b SET deleted_ts = CURRENT_TIMESTAMP
+			WHERE b.book_id = $1
+		`, tx.SchemaVersion)
+
+		_, err = tx.conn().Exec(queryStr, id)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.auditBook(v1.AuditActionDelete, id, book)
+	})
+}
 
+// Returns true if the owner has a book in the trash with the given ISBN.
+func (pg *PgDb) trashedBookWithIsbn(ownerId int, isbn13 string) (bool, error) {
 	queryStr := fmt.Sprintf(`
-		DELETE FROM %s.book b 
-		WHERE b.book_id = $1
+		SELECT b.book_id FROM %s.book b
+		WHERE b.owner_id = $1 AND b.isbn13 = $2 AND b.deleted_ts IS NOT NULL
+		LIMIT 1
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(queryStr, id)
+	rows, err := pg.conn().Query(queryStr, ownerId, isbn13)
 
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// Close the connection once we're done
-	defer rows.Close()
+	id, err := ScanReturnedId(rows)
 
-	return nil
+	return id != nil, err
 }
 
 // Returns an array of books based on filter. If no filters given,
-// this function returns all books. Title and genre are wildcard searches,
-// edition is equality.
-func (pg *PgDb) BookFilter(title *string, genre *string, edition *int) ([]v1.Book, error) {
+// this function returns all books visible to the user. Title and genre
+// are wildcard searches, edition and ISBN are equality. TitleExact matches
+// the whole title ignoring case, as the book identity does.
+func (pg *PgDb) BookFilter(filter *v1.BookFilter) ([]v1.Book, error) {
+	if filter == nil {
+		filter = &v1.BookFilter{}
+	}
+
+	title, genre, edition := filter.Title, filter.Genre, filter.Edition
+
 	queryStr := fmt.Sprintf(`
-		SELECT b.book_id, b.created_ts, b.title, b.publish_date, b.edition, b.description, b.genre, a.author_id, a.created_ts, a.first_name, a.last_name
+		SELECT %s
 		FROM %s.book b 
 		INNER JOIN %s.author a ON b.author_id = a.author_id 
-	`, pg.SchemaVersion, pg.SchemaVersion)
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	if filter.SeriesId != nil {
+		queryStr += fmt.Sprintf(" INNER JOIN %s.series_entry se ON se.book_id = b.book_id ", pg.SchemaVersion)
+	}
+
+	if filter.Sort != nil {
+		if *filter.Sort != v1.BookSortRating {
+			return nil, errors.New("sort must be rating")
+		}
+
+		queryStr += fmt.Sprintf(` LEFT JOIN (
+			SELECT rv.book_id, avg(rv.rating) AS rating
+			FROM %s.review rv
+			GROUP BY rv.book_id ) ratings ON ratings.book_id = b.book_id `, pg.SchemaVersion)
+	}
 
 	// TODO: Automate this section based on reflection/validation
 	// The next section generates a dynamic where string
 	// (e.g., where x = y and y = z)
-	wheres := make([]string, 0)
+	// Books in the trash are left out
+	wheres := []string{" b.deleted_ts IS NULL "}
 	values := make([]interface{}, 0)
 	idx := 1
 
@@ -160,6 +493,13 @@ func (pg *PgDb) BookFilter(title *string, genre *string, edition *int) ([]v1.Boo
 		idx++
 	}
 
+	// Compared as the book identity index does, so no wildcards
+	if filter.TitleExact != nil {
+		wheres = append(wheres, " lower(b.title) = lower($"+fmt.Sprint(idx)+") ")
+		values = append(values, *filter.TitleExact)
+		idx++
+	}
+
 	// Perform wildcard search on genre if given
 	if genre != nil {
 		wheres = append(wheres, " b.genre LIKE '%' || $"+fmt.Sprint(idx)+" || '%' ")
@@ -174,15 +514,87 @@ func (pg *PgDb) BookFilter(title *string, genre *string, edition *int) ([]v1.Boo
 		idx++
 	}
 
+	// ISBNs are stored in ISBN-13 form, so normalize before comparing
+	if filter.Isbn != nil {
+		isbn13, err := isbn.Normalize(*filter.Isbn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		wheres = append(wheres, " b.isbn13 = $"+fmt.Sprint(idx)+" ")
+		values = append(values, isbn13)
+		idx++
+	}
+
+	// Reading state is per user, so only a user's own status is filtered on
+	if filter.Status != nil {
+		if !v1.ValidReadingStatus(*filter.Status) {
+			return nil, errors.New("status must be one of want-to-read, reading, finished or abandoned")
+		}
+
+		userId, err := pg.ownerId()
+
+		if err != nil {
+			return nil, err
+		}
+
+		wheres = append(wheres, fmt.Sprintf(` EXISTS (
+			SELECT 1 FROM %s.reading_state r
+			WHERE r.book_id = b.book_id AND r.user_id = $%d AND r.status = $%d ) `,
+			pg.SchemaVersion, idx, idx+1))
+		values = append(values, userId, *filter.Status)
+		idx += 2
+	}
+
+	if filter.SeriesId != nil {
+		wheres = append(wheres, " se.series_id = $"+fmt.Sprint(idx)+" ")
+		values = append(values, *filter.SeriesId)
+		idx++
+	}
+
+	if filter.WorkId != nil {
+		wheres = append(wheres, " b.work_id = $"+fmt.Sprint(idx)+" ")
+		values = append(values, *filter.WorkId)
+		idx++
+	}
+
+	if filter.PublishedBefore != nil {
+		wheres = append(wheres, " b.publish_date < $"+fmt.Sprint(idx)+" ")
+		values = append(values, filter.PublishedBefore.Format(time.RFC3339))
+		idx++
+	}
+
+	if filter.PublishedAfter != nil {
+		wheres = append(wheres, " b.publish_date >= $"+fmt.Sprint(idx)+" ")
+		values = append(values, filter.PublishedAfter.Format(time.RFC3339))
+		idx++
+	}
+
+	// Members only see their own shelf
+	if pg.isScoped() {
+		wheres = append(wheres, " b.owner_id = $"+fmt.Sprint(idx)+" ")
+		values = append(values, pg.User.UserId)
+		idx++
+	}
+
 	if len(wheres) > 0 {
 		queryStr += " WHERE " + strings.Join(wheres, " AND ")
 	}
 
-	rows, err := pg.SqlDb.Query(queryStr, values...)
+	if filter.Sort != nil {
+		queryStr += " ORDER BY ratings.rating DESC NULLS LAST, b.book_id "
+	} else if filter.SeriesId != nil {
+		queryStr += " ORDER BY se.position, b.book_id "
+	} else if filter.WorkId != nil {
+		queryStr += " ORDER BY b.publish_date NULLS LAST, b.book_id "
+	}
+
+	rows, err := pg.conn().Query(queryStr, values...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return ScanReturnedBooks(rows)
+	return pg.scanBooks(rows)
 }
@@ -1,9 +1,11 @@
 package postgresql
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/db"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -121,18 +123,293 @@ var _ = Describe("Book Test", func() {
 			})
 
 			It("Should filter a book", func() {
-				book, err := pgDb.BookFilter(&booksToSave[1].Title, nil, nil)
+				book, err := pgDb.BookFilter(&v1.BookFilter{Title: &booksToSave[1].Title})
 				Expect(err).To(BeNil())
 				Expect(book).ToNot(BeNil())
 				Expect(len(book)).To(Equal(1))
 			})
 
+			It("Should track reading progress", func() {
+				page := 42
+				state, err := pgDb.BookProgressUpdate(*bookIds[0], &v1.ProgressUpdate{Page: &page})
+				Expect(err).To(BeNil())
+				Expect(state.Status).To(Equal(v1.ReadingStatusReading))
+				Expect(state.StartedTs).ToNot(BeNil())
+				Expect(state.History).To(HaveLen(1))
+
+				status := v1.ReadingStatusReading
+				books, err := pgDb.BookFilter(&v1.BookFilter{Status: &status})
+				Expect(err).To(BeNil())
+				Expect(books).To(ContainElement(HaveField("BookId", *bookIds[0])))
+			})
+
+			It("Should lend and return a book", func() {
+				due := time.Now().AddDate(0, 0, -1)
+				loanId, err := pgDb.LoanCreate(&v1.Loan{BookId: *bookIds[0], Borrower: "Sam", DueTs: &due})
+				Expect(err).To(BeNil())
+
+				_, err = pgDb.LoanCreate(&v1.Loan{BookId: *bookIds[0], Borrower: "Alex"})
+				Expect(err).ToNot(BeNil())
+
+				book, err := pgDb.BookGet(*bookIds[0])
+				Expect(err).To(BeNil())
+				Expect(book.Loan.LoanId).To(Equal(*loanId))
+
+				overdue, err := pgDb.LoanList(&v1.LoanFilter{Overdue: true})
+				Expect(err).To(BeNil())
+				Expect(overdue).To(ContainElement(HaveField("LoanId", *loanId)))
+
+				Expect(pgDb.LoanReturn(*loanId)).To(Succeed())
+				Expect(pgDb.LoanReturn(*loanId)).ToNot(Succeed())
+
+				book, err = pgDb.BookGet(*bookIds[0])
+				Expect(err).To(BeNil())
+				Expect(book.Loan).To(BeNil())
+			})
+
+			It("Should find copies by shelf and book", func() {
+				roomId, err := pgDb.LocationCreate(&v1.Location{Name: "Library"})
+				Expect(err).To(BeNil())
+				shelfId, err := pgDb.LocationCreate(&v1.Location{Name: "B3", ParentId: roomId})
+				Expect(err).To(BeNil())
+
+				copyId, err := pgDb.CopyCreate(&v1.Copy{BookId: *bookIds[0], LocationId: shelfId})
+				Expect(err).To(BeNil())
+
+				copies, err := pgDb.CopyList(&v1.CopyFilter{LocationId: roomId})
+				Expect(err).To(BeNil())
+				Expect(copies).To(ContainElement(HaveField("CopyId", *copyId)))
+
+				Expect(pgDb.CopyMove(*copyId, nil)).To(Succeed())
+
+				bookCopy, err := pgDb.CopyGet(*copyId)
+				Expect(err).To(BeNil())
+				Expect(bookCopy.LocationId).To(BeNil())
+				Expect(bookCopy.Moves).To(HaveLen(1))
+
+				copies, err = pgDb.CopyList(&v1.CopyFilter{BookId: bookIds[0]})
+				Expect(err).To(BeNil())
+				Expect(copies).To(HaveLen(1))
+
+				Expect(pgDb.CopyRemove(*copyId)).To(Succeed())
+				Expect(pgDb.LocationRemove(*roomId)).ToNot(Succeed())
+				Expect(pgDb.LocationRemove(*shelfId)).To(Succeed())
+				Expect(pgDb.LocationRemove(*roomId)).To(Succeed())
+			})
+
+			It("Should order books by series position", func() {
+				seriesId, err := pgDb.SeriesCreate(&v1.Series{Name: "Series " + fmt.Sprint(time.Now().UnixMicro())})
+				Expect(err).To(BeNil())
+				defer pgDb.SeriesRemove(*seriesId)
+
+				Expect(pgDb.SeriesSetBook(*seriesId, *bookIds[0], 3)).To(Succeed())
+				Expect(pgDb.SeriesSetBook(*seriesId, *bookIds[1], 1)).To(Succeed())
+				Expect(pgDb.SeriesSetBook(*seriesId, *bookIds[2], 2.5)).To(Succeed())
+
+				books, err := pgDb.BookFilter(&v1.BookFilter{SeriesId: seriesId})
+				Expect(err).To(BeNil())
+				Expect(books).To(HaveLen(3))
+				Expect(books[0].BookId).To(Equal(*bookIds[1]))
+				Expect(books[1].Series.Position).To(Equal(2.5))
+
+				finished := v1.ReadingStatusFinished
+				_, err = pgDb.BookProgressUpdate(*bookIds[1], &v1.ProgressUpdate{Status: &finished})
+				Expect(err).To(BeNil())
+
+				next, err := pgDb.SeriesNextUnread(*seriesId)
+				Expect(err).To(BeNil())
+				Expect(next.BookId).To(Equal(*bookIds[2]))
+			})
+
+			It("Should average ratings and sort by them", func() {
+				low, high := 2.0, 4.5
+				_, err := pgDb.ReviewSet(&v1.Review{BookId: *bookIds[0], Rating: &low})
+				Expect(err).To(BeNil())
+
+				body := "Better on a re-read"
+				review, err := pgDb.ReviewSet(&v1.Review{BookId: *bookIds[1], Rating: &high})
+				Expect(err).To(BeNil())
+				review, err = pgDb.ReviewSet(&v1.Review{BookId: *bookIds[1], Body: &body})
+				Expect(err).To(BeNil())
+				Expect(*review.Rating).To(Equal(high))
+
+				book, err := pgDb.BookGet(*bookIds[1])
+				Expect(err).To(BeNil())
+				Expect(book.Rating.Average).To(Equal(high))
+
+				sort := v1.BookSortRating
+				books, err := pgDb.BookFilter(&v1.BookFilter{Sort: &sort})
+				Expect(err).To(BeNil())
+
+				order := []int{}
+				for _, b := range books {
+					if b.BookId == *bookIds[0] || b.BookId == *bookIds[1] {
+						order = append(order, b.BookId)
+					}
+				}
+				Expect(order).To(Equal([]int{*bookIds[1], *bookIds[0]}))
+
+				page := 12
+				noteId, err := pgDb.NoteCreate(&v1.Note{BookId: *bookIds[0], Page: &page, Body: "Foreshadowing"})
+				Expect(err).To(BeNil())
+
+				notes, err := pgDb.NoteList(*bookIds[0])
+				Expect(err).To(BeNil())
+				Expect(notes).To(ContainElement(HaveField("NoteId", *noteId)))
+			})
+
+			It("Should group editions into works", func() {
+				first, err := pgDb.BookGet(*bookIds[0])
+				Expect(err).To(BeNil())
+				second, err := pgDb.BookGet(*bookIds[1])
+				Expect(err).To(BeNil())
+				Expect(first.WorkId).ToNot(Equal(second.WorkId))
+
+				Expect(pgDb.WorkSetBook(first.WorkId, second.BookId)).To(Succeed())
+
+				// The emptied work is removed
+				old, err := pgDb.WorkGet(second.WorkId)
+				Expect(err).To(BeNil())
+				Expect(old).To(BeNil())
+
+				language := "de"
+				translation := BookFactory()
+				translation.WorkId = first.WorkId
+				translation.Language = &language
+				translation.TranslationOf = &first.BookId
+
+				translationId, err := pgDb.BookCreate(translation)
+				Expect(err).To(BeNil())
+				bookIds = append(bookIds, translationId)
+
+				work, err := pgDb.WorkGet(first.WorkId)
+				Expect(err).To(BeNil())
+				Expect(work.Editions).To(HaveLen(3))
+			})
+
+			It("Should merge a duplicate into the kept book", func() {
+				title := "Collection " + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&title, []int{*bookIds[1]})
+				Expect(err).To(BeNil())
+				defer pgDb.CollectionRemove(&title)
+
+				noteId, err := pgDb.NoteCreate(&v1.Note{BookId: *bookIds[1], Body: "Margin note"})
+				Expect(err).To(BeNil())
+
+				loanId, err := pgDb.LoanCreate(&v1.Loan{BookId: *bookIds[1], Borrower: "Sam"})
+				Expect(err).To(BeNil())
+
+				Expect(pgDb.BookMerge(*bookIds[0], *bookIds[1])).To(Succeed())
+
+				dropped, err := pgDb.BookGet(*bookIds[1])
+				Expect(err).To(BeNil())
+				Expect(dropped).To(BeNil())
+				bookIds[1] = nil
+
+				collection, err := pgDb.CollectionGet(&title)
+				Expect(err).To(BeNil())
+				Expect(collection.Books).To(ContainElement(HaveField("BookId", *bookIds[0])))
+
+				note, err := pgDb.NoteGet(*noteId)
+				Expect(err).To(BeNil())
+				Expect(note.BookId).To(Equal(*bookIds[0]))
+
+				loan, err := pgDb.LoanGet(*loanId)
+				Expect(err).To(BeNil())
+				Expect(loan.BookId).To(Equal(*bookIds[0]))
+
+				Expect(pgDb.BookMerge(*bookIds[0], *bookIds[0])).ToNot(Succeed())
+			})
+
+			It("Should keep a merged book in the trash and leave merges out of undo", func() {
+				title := "collTestMergeUndo" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&title, []int{*bookIds[0]})
+				Expect(err).To(BeNil())
+
+				Expect(pgDb.BookMerge(*bookIds[0], *bookIds[1])).To(Succeed())
+				dropped := *bookIds[1]
+				bookIds[1] = nil
+
+				trash, err := pgDb.TrashList()
+				Expect(err).To(BeNil())
+				Expect(trash.Books).To(ContainElement(HaveField("BookId", dropped)))
+
+				// The collection's creation is the last change undo reaches
+				entries, err := pgDb.UndoList(1)
+				Expect(err).To(BeNil())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Entity).To(Equal(v1.AuditEntityCollection))
+				Expect(entries[0].Action).To(Equal(v1.AuditActionCreate))
+
+				_, err = pgDb.Undo([]int{entries[0].AuditId})
+				Expect(err).To(BeNil())
+
+				collection, err := pgDb.CollectionGet(&title)
+				Expect(err).To(BeNil())
+				Expect(collection).To(BeNil())
+			})
+
+			It("Should reject a book identical to an existing one", func() {
+				book, err := pgDb.BookGet(*bookIds[0])
+				Expect(err).To(BeNil())
+
+				_, err = pgDb.BookCreate(book)
+				Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+			})
+
+			It("Should record purges in the audit log", func() {
+				bookId, err := pgDb.BookCreate(BookFactory())
+				Expect(err).To(BeNil())
+				Expect(pgDb.BookRemove(*bookId)).To(Succeed())
+
+				report, err := pgDb.TrashPurge(nil)
+				Expect(err).To(BeNil())
+				Expect(report.Books).To(BeNumerically(">=", 1))
+
+				entity := v1.AuditEntityBook
+				entries, err := pgDb.AuditList(&v1.AuditFilter{Entity: &entity, EntityId: bookId, Limit: 1})
+				Expect(err).To(BeNil())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Action).To(Equal(v1.AuditActionPurge))
+				Expect(*entries[0].ActorId).To(Equal(pgDb.User.UserId))
+				Expect(entries[0].Before).ToNot(BeEmpty())
+
+				// Purges can't be undone, so undo reaches the removal
+				undoable, err := pgDb.UndoList(1)
+				Expect(err).To(BeNil())
+				Expect(undoable[0].Action).ToNot(Equal(v1.AuditActionPurge))
+			})
+
+			It("Should filter a book by either ISBN form", func() {
+				isbn10 := "0441172717"
+				newBook := BookFactory()
+				newBook.Isbn10 = &isbn10
+				newBook.Identifiers = []v1.Identifier{{Type: "LCCN", Value: "65022719"}}
+
+				bookId, err := pgDb.BookCreate(newBook)
+				Expect(err).To(BeNil())
+				bookIds = append(bookIds, bookId)
+
+				isbn13 := "978-0-441-17271-9"
+				books, err := pgDb.BookFilter(&v1.BookFilter{Isbn: &isbn13})
+				Expect(err).To(BeNil())
+				Expect(books).To(HaveLen(1))
+				Expect(*books[0].Isbn10).To(Equal(isbn10))
+				Expect(books[0].Identifiers).To(Equal([]v1.Identifier{{Type: "lccn", Value: "65022719"}}))
+
+				_, err = pgDb.BookCreate(newBook)
+				Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+			})
+
 			AfterEach(func() {
 				for _, bookId := range bookIds {
 					if bookId != nil {
 						pgDb.BookRemove(*bookId)
 					}
 				}
+
+				// Trashed books keep their ISBNs
+				pgDb.TrashPurge(nil)
 			})
 		})
 		// TODO: add more tests
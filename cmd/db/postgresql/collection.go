@@ -2,20 +2,67 @@ package postgresql
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/Max-Clark/goshelf/cmd/db"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// Creates a collection owned by the current user containing bookIds.
+// Members may only add their own books. Returns the collection title.
 func (pg *PgDb) CollectionCreate(title *string, bookIds []int) (*string, error) {
+	var created *string
+
+	err := pg.auditCollection(title, func(tx *PgDb) error {
+		var err error
+		created, err = tx.collectionCreate(title, bookIds)
+		return err
+	})
+
+	return created, err
+}
+
+func (pg *PgDb) collectionCreate(title *string, bookIds []int) (*string, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	if err := v1.ValidateCollectionTitle(*title); err != nil {
+		return nil, err
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.checkBookOwnership(ownerId, bookIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pg.checkCollectionNotTrashed(ownerId, *title); err != nil {
+		return nil, err
+	}
+
+	slug, err := pg.collectionSlug(ownerId, title, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
 	queryStr := fmt.Sprintf(`
-		INSERT INTO %s.collection (title)
-		VALUES ($1)
+		INSERT INTO %s.collection (owner_id, title, slug)
+		VALUES ($1, $2, $3)
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(queryStr, title)
+	rows, err := pg.conn().Query(queryStr, ownerId, title, slug)
 
 	if err != nil {
 		return nil, err
@@ -23,53 +70,709 @@ func (pg *PgDb) CollectionCreate(title *string, bookIds []int) (*string, error)
 
 	rows.Close()
 
-	if len(bookIds) > 0 {
-		queryStr = fmt.Sprintf(`
-		INSERT INTO %s.collection_books (title,book_id)
-		VALUES `, pg.SchemaVersion)
+	err = pg.insertCollectionBooks(ownerId, title, bookIds)
 
-		values := make([]string, len(bookIds))
-		for i := 0; i < len(bookIds); i++ {
-			values[i] = " ( $1, $" + fmt.Sprint(i+2) + " ) " // $1 == title, so index + 2
-		}
+	if err != nil {
+		return nil, err
+	}
+
+	return title, nil
+}
+
+// Creates a smart collection owned by the current user. Its books are
+// the user's books matching filter when the collection is read. Returns
+// the collection title.
+func (pg *PgDb) CollectionCreateSmart(title *string, filter *v1.BookFilter) (*string, error) {
+	var created *string
+
+	err := pg.auditCollection(title, func(tx *PgDb) error {
+		var err error
+		created, err = tx.collectionCreateSmart(title, filter)
+		return err
+	})
+
+	return created, err
+}
+
+func (pg *PgDb) collectionCreateSmart(title *string, filter *v1.BookFilter) (*string, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	if err := v1.ValidateCollectionTitle(*title); err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		return nil, errors.New("filter is required")
+	}
+
+	if filter.Sort != nil && *filter.Sort != v1.BookSortRating {
+		return nil, errors.New("sort must be rating")
+	}
+
+	if filter.Status != nil && !v1.ValidReadingStatus(*filter.Status) {
+		return nil, errors.New("status must be one of want-to-read, reading, finished or abandoned")
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
 
-		queryStr += strings.Join(values, ",")
+	filterJson, err := json.Marshal(filter)
 
-		// Create varargs for query function
-		varArgs := make([]interface{}, len(bookIds)+1)
+	if err != nil {
+		return nil, err
+	}
 
-		varArgs[0] = title
-		for i := 0; i < len(bookIds); i++ {
-			varArgs[i+1] = bookIds[i]
+	if err := pg.checkCollectionNotTrashed(ownerId, *title); err != nil {
+		return nil, err
+	}
+
+	slug, err := pg.collectionSlug(ownerId, title, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.collection (owner_id, title, slug, filter)
+		VALUES ($1, $2, $3, $4)
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, title, slug, string(filterJson))
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	return title, nil
+}
+
+// Renames one of the current user's collections or updates its metadata.
+// The slug follows the title. Returns the updated collection without its
+// books.
+func (pg *PgDb) CollectionUpdate(id int, u *v1.CollectionUpdate) (*v1.Collection, error) {
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := pg.collectionGetById(ownerId, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == nil {
+		return nil, db.NotFound("collection not found")
+	}
+
+	if u == nil {
+		return collection, nil
+	}
+
+	title := collection.Title
+
+	if u.Title != nil && *u.Title != collection.Title {
+		if err := v1.ValidateCollectionTitle(*u.Title); err != nil {
+			return nil, err
 		}
 
-		rows, err := pg.SqlDb.Query(queryStr, varArgs...)
+		slug, err := pg.collectionSlug(ownerId, u.Title, id)
 
 		if err != nil {
 			return nil, err
 		}
 
-		rows.Close()
+		collection.Title, collection.Slug = *u.Title, slug
 	}
 
-	return title, nil
+	// Empty values clear the field
+	for _, field := range []struct {
+		value  *string
+		target **string
+	}{
+		{u.Description, &collection.Description},
+		{u.CoverUrl, &collection.CoverUrl},
+	} {
+		if field.value == nil {
+			continue
+		}
+
+		*field.target = field.value
+
+		if *field.value == "" {
+			*field.target = nil
+		}
+	}
+
+	if u.Public != nil {
+		collection.Public = *u.Public
+	}
+
+	// Memberships, shares and children follow the title through
+	// ON UPDATE CASCADE
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection c
+		SET title = $3, slug = $4, description = $5, cover_url = $6, public = $7
+		WHERE c.owner_id = $1 AND c.collection_id = $2
+	`, pg.SchemaVersion)
+
+	err = pg.auditCollection(&title, func(tx *PgDb) error {
+		_, err := tx.conn().Exec(queryStr, ownerId, id, collection.Title, collection.Slug,
+			collection.Description, collection.CoverUrl, collection.Public)
+
+		return err
+	})
+
+	if isUniqueViolation(err) {
+		return nil, db.Conflict("a collection with this title already exists")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// Returns a conflict if the owner has a collection titled title in the
+// trash, which keeps its title until restored or purged.
+func (pg *PgDb) checkCollectionNotTrashed(ownerId int, title string) error {
+	queryStr := fmt.Sprintf(`
+		SELECT c.collection_id FROM %s.collection c
+		WHERE c.owner_id = $1 AND c.title = $2 AND c.deleted_ts IS NOT NULL
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	trashed, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if trashed != nil {
+		return db.Conflict("a collection with this title is in the trash")
+	}
+
+	return nil
+}
+
+// Returns the owner's collection with the given id, without its books.
+// Returns nil, nil if not found.
+func (pg *PgDb) collectionGetById(ownerId int, id int) (*v1.Collection, error) {
+	return pg.collectionGetWhere(ownerId, "c.collection_id = $2", id)
+}
+
+// Returns the owner's collection with exactly the given title, without its
+// books. Returns nil, nil if not found.
+func (pg *PgDb) collectionGetByTitle(ownerId int, title string) (*v1.Collection, error) {
+	return pg.collectionGetWhere(ownerId, "c.title = $2", title)
+}
+
+func (pg *PgDb) collectionGetWhere(ownerId int, where string, value interface{}) (*v1.Collection, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.collection c
+		WHERE c.owner_id = $1 AND %s AND c.deleted_ts IS NULL
+	`, collectionColumns, pg.SchemaVersion, where)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := ScanReturnedCollections(rows)
+
+	if err != nil || len(collections) < 1 {
+		return nil, err
+	}
+
+	return &collections[0], nil
+}
+
+// Returns a slug for title that no other collection of the owner has,
+// numbering it if needed, e.g. reading-list-2. exceptId is the collection
+// being renamed, or 0.
+func (pg *PgDb) collectionSlug(ownerId int, title *string, exceptId int) (string, error) {
+	base := v1.Slugify(*title)
+
+	queryStr := fmt.Sprintf(`
+		SELECT c.slug FROM %s.collection c
+		WHERE c.owner_id = $1 AND c.collection_id <> $2
+			AND (c.slug = $3 OR c.slug LIKE $3 || '-%%')
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, exceptId, base)
+
+	if err != nil {
+		return "", err
+	}
+
+	taken, err := ScanReturnedStrings(rows)
+
+	if err != nil {
+		return "", err
+	}
+
+	used := map[string]bool{}
+
+	for _, slug := range taken {
+		used[slug] = true
+	}
+
+	slug := base
+
+	for n := 2; used[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	return slug, nil
+}
+
+// Adds books to one of the current user's collections. Books already in
+// the collection are ignored.
+func (pg *PgDb) CollectionAddBooks(title *string, bookIds []int) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionAddBooks(title, bookIds)
+	})
+}
+
+func (pg *PgDb) collectionAddBooks(title *string, bookIds []int) error {
+	if title == nil {
+		return nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	err = pg.checkBookOwnership(ownerId, bookIds)
+
+	if err != nil {
+		return err
+	}
+
+	err = pg.checkManualCollection(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	return pg.insertCollectionBooks(ownerId, title, bookIds)
+}
+
+// Returns an error unless the owner has a manual (not smart) collection
+// with the given title.
+func (pg *PgDb) checkManualCollection(ownerId int, title *string) error {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.collection c
+		WHERE c.owner_id = $1 AND c.title = $2 AND c.deleted_ts IS NULL
+	`, collectionColumns, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, *title)
+
+	if err != nil {
+		return err
+	}
+
+	collections, err := ScanReturnedCollections(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if len(collections) < 1 {
+		return db.NotFound("collection not found")
+	}
+
+	if collections[0].Smart {
+		return errors.New("a smart collection's books can't be changed")
+	}
+
+	return nil
+}
+
+// Returns an error if a member tries to use books they don't own, or
+// anyone uses books in the trash.
+func (pg *PgDb) checkBookOwnership(ownerId int, bookIds []int) error {
+	if len(bookIds) < 1 {
+		return nil
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT count(*) FROM %s.book b
+		WHERE b.book_id = ANY($1)
+			AND (b.deleted_ts IS NOT NULL OR ($3 AND b.owner_id <> $2))
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, pq.Array(bookIds), ownerId, pg.isScoped())
+
+	if err != nil {
+		return err
+	}
+
+	foreign, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if foreign != nil && *foreign > 0 {
+		return errors.New("book not found")
+	}
+
+	return nil
+}
+
+// Appends bookIds to the end of a collection, in the order given. Books
+// already in the collection keep their place.
+func (pg *PgDb) insertCollectionBooks(ownerId int, title *string, bookIds []int) error {
+	if len(bookIds) < 1 {
+		return nil
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %[1]s.collection_books (owner_id, title, book_id, position)
+		SELECT $1, $2, ids.book_id,
+			(SELECT COALESCE(max(cb.position), 0) FROM %[1]s.collection_books cb
+				WHERE cb.owner_id = $1 AND cb.title = $2)
+			+ row_number() OVER (ORDER BY ids.ord)
+		FROM (
+			SELECT DISTINCT ON (u.book_id) u.book_id, u.ord
+			FROM unnest($3::int[]) WITH ORDINALITY AS u(book_id, ord)
+			ORDER BY u.book_id, u.ord
+		) ids
+		WHERE NOT EXISTS (
+			SELECT 1 FROM %[1]s.collection_books cb
+			WHERE cb.owner_id = $1 AND cb.title = $2 AND cb.book_id = ids.book_id )
+		ON CONFLICT DO NOTHING
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, title, pq.Array(bookIds))
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Moves a book to position in one of the current user's collections,
+// shifting the books between. Positions past the end move it to the end.
+func (pg *PgDb) CollectionMoveBook(title *string, bookId int, position int) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionMoveBook(title, bookId, position)
+	})
+}
+
+func (pg *PgDb) collectionMoveBook(title *string, bookId int, position int) error {
+	if title == nil {
+		return nil
+	}
+
+	if position < 1 {
+		return errors.New("position must be at least 1")
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	err = pg.checkManualCollection(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	bookIds, err := pg.collectionBookIds(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	order := make([]int, 0, len(bookIds))
+
+	for _, id := range bookIds {
+		if id != bookId {
+			order = append(order, id)
+		}
+	}
+
+	if len(order) == len(bookIds) {
+		return errors.New("book not in collection")
+	}
+
+	if position > len(bookIds) {
+		position = len(bookIds)
+	}
+
+	order = append(order[:position-1], append([]int{bookId}, order[position-1:]...)...)
+
+	return pg.setCollectionOrder(ownerId, title, order)
+}
+
+// Reorders one of the current user's collections. bookIds must hold
+// every book in the collection exactly once, in the new order.
+func (pg *PgDb) CollectionReorder(title *string, bookIds []int) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionReorder(title, bookIds)
+	})
 }
 
+func (pg *PgDb) collectionReorder(title *string, bookIds []int) error {
+	if title == nil {
+		return nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	err = pg.checkManualCollection(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := pg.collectionBookIds(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	members := map[int]bool{}
+
+	for _, id := range current {
+		members[id] = true
+	}
+
+	for _, id := range bookIds {
+		if !members[id] {
+			return errors.New("bookIds must list every book in the collection once")
+		}
+
+		delete(members, id)
+	}
+
+	if len(members) > 0 || len(bookIds) != len(current) {
+		return errors.New("bookIds must list every book in the collection once")
+	}
+
+	return pg.setCollectionOrder(ownerId, title, bookIds)
+}
+
+// Sets or, with a nil note, clears the note on a book in one of the
+// current user's collections.
+func (pg *PgDb) CollectionSetNote(title *string, bookId int, note *string) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionSetNote(title, bookId, note)
+	})
+}
+
+func (pg *PgDb) collectionSetNote(title *string, bookId int, note *string) error {
+	if title == nil {
+		return nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	err = pg.checkManualCollection(ownerId, title)
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection_books cb SET note = $4
+		WHERE cb.owner_id = $1 AND cb.title = $2 AND cb.book_id = $3
+	`, pg.SchemaVersion)
+
+	result, err := pg.conn().Exec(queryStr, ownerId, *title, bookId, note)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return errors.New("book not in collection")
+	}
+
+	return nil
+}
+
+// Returns the ids of a collection's books in order.
+func (pg *PgDb) collectionBookIds(ownerId int, title *string) ([]int, error) {
+	entries, err := pg.collectionEntries(ownerId, *title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bookIds := make([]int, len(entries))
+
+	for i, e := range entries {
+		bookIds[i] = e.BookId
+	}
+
+	return bookIds, nil
+}
+
+// Returns a collection's entries in order, leaving out books in the trash.
+// Trashed books keep their position and note for when they are restored.
+func (pg *PgDb) collectionEntries(ownerId int, title string) ([]v1.CollectionEntry, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT cb.book_id, cb.position, cb.note
+		FROM %[1]s.collection_books cb
+		INNER JOIN %[1]s.book b ON cb.book_id = b.book_id
+		WHERE cb.owner_id = $1 AND cb.title = $2 AND b.deleted_ts IS NULL
+		ORDER BY cb.position, cb.book_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedCollectionEntries(rows)
+}
+
+// Numbers the collection's books from 1 in the order of bookIds.
+func (pg *PgDb) setCollectionOrder(ownerId int, title *string, bookIds []int) error {
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection_books cb SET position = ids.ord
+		FROM unnest($3::int[]) WITH ORDINALITY AS ids(book_id, ord)
+		WHERE cb.owner_id = $1 AND cb.title = $2 AND cb.book_id = ids.book_id
+	`, pg.SchemaVersion)
+
+	_, err := pg.conn().Exec(queryStr, ownerId, *title, pq.Array(bookIds))
+
+	return err
+}
+
+// Returns the current user's collection with the given title or slug.
+// Unscoped queriers (e.g., anonymous reads) only see public collections,
+// and get a conflict if more than one owner has one with the title.
+// Returns nil, nil if not found.
 func (pg *PgDb) CollectionGet(title *string) (*v1.Collection, error) {
 	if title == nil {
 		return nil, nil
 	}
 
 	queryStr := fmt.Sprintf(`
-		SELECT * FROM %s.collection c WHERE c.title = $1
+		SELECT %s FROM %s.collection c
+		WHERE (c.title = $1 OR c.slug = $1) AND c.deleted_ts IS NULL
+	`, collectionColumns, pg.SchemaVersion)
+
+	values := []interface{}{title}
+
+	if pg.User != nil {
+		queryStr += " AND c.owner_id = $2 "
+		values = append(values, pg.User.UserId)
+	} else {
+		owners, err := pg.publicCollectionOwners(*title)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(owners) > 1 {
+			return nil, db.Conflict("more than one user has a public collection with this title, use /shared/{username}/{title}")
+		}
+
+		queryStr += " AND c.public "
+	}
+
+	// A title match wins over another collection's slug
+	rows, err := pg.conn().Query(queryStr+" ORDER BY c.title = $1 DESC, c.owner_id ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.scanCollectionWithBooks(rows)
+}
+
+// Returns the ids of the users with a public collection with the given
+// title or slug.
+func (pg *PgDb) publicCollectionOwners(title string) ([]int, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT DISTINCT c.owner_id FROM %s.collection c
+		WHERE (c.title = $1 OR c.slug = $1) AND c.deleted_ts IS NULL AND c.public
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(queryStr, title)
+	rows, err := pg.conn().Query(queryStr, title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedIds(rows)
+}
+
+// Returns the current user's collections without their books, optionally
+// filtered by a wildcard search on title.
+func (pg *PgDb) CollectionList(title *string) ([]v1.Collection, error) {
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.collection c WHERE c.owner_id = $1 AND c.deleted_ts IS NULL
+	`, collectionColumns, pg.SchemaVersion)
+
+	values := []interface{}{ownerId}
+
+	if title != nil {
+		queryStr += " AND c.title LIKE '%' || $2 || '%' "
+		values = append(values, *title)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY c.title ", values...)
 
 	if err != nil {
 		return nil, err
 	}
 
+	return ScanReturnedCollections(rows)
+}
+
+// Scans the first collection returned by rows and loads its books, the
+// members of a manual collection or the matches of a smart one. Returns
+// nil, nil for no rows returned.
+func (pg *PgDb) scanCollectionWithBooks(rows *sql.Rows) (*v1.Collection, error) {
 	collections, err := ScanReturnedCollections(rows)
 
 	if err != nil {
@@ -82,22 +785,37 @@ func (pg *PgDb) CollectionGet(title *string) (*v1.Collection, error) {
 
 	collection := &collections[0]
 
-	queryStr = fmt.Sprintf(`
-		SELECT 	b.book_id, b.created_ts, b.title, b.publish_date, b.edition, b.description, 
-				b.genre, a.author_id, a.created_ts, a.first_name, a.last_name
+	// Evaluated as the owner, so shared and public reads see the owner's
+	// matching books and reading statuses
+	if collection.Smart {
+		owner := pg.AsUser(&v1.User{UserId: collection.OwnerId}).(*PgDb)
+		books, err := owner.BookFilter(collection.Filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		collection.Books = books
+
+		return collection, nil
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s
 		FROM %s.collection_books cb
 		INNER JOIN %s.book b ON cb.book_id = b.book_id
 		INNER JOIN %s.author a ON b.author_id = a.author_id 
-		WHERE cb.title = $1
-	`, pg.SchemaVersion, pg.SchemaVersion, pg.SchemaVersion)
+		WHERE cb.owner_id = $1 AND cb.title = $2 AND b.deleted_ts IS NULL
+		ORDER BY cb.position, cb.book_id
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion, pg.SchemaVersion)
 
-	rows, err = pg.SqlDb.Query(queryStr, title)
+	rows, err = pg.conn().Query(queryStr, collection.OwnerId, collection.Title)
 
 	if err != nil {
 		return nil, err
 	}
 
-	books, err := ScanReturnedBooks(rows)
+	books, err := pg.scanBooks(rows)
 
 	if err != nil {
 		return nil, err
@@ -105,29 +823,57 @@ func (pg *PgDb) CollectionGet(title *string) (*v1.Collection, error) {
 
 	collection.Books = books
 
+	collection.Entries, err = pg.collectionEntries(collection.OwnerId, collection.Title)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return collection, nil
 }
 
+// Moves the current user's collection with the given title to the trash.
+// Its child collections move up to its parent.
 func (pg *PgDb) CollectionRemove(title *string) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionRemove(title)
+	})
+}
+
+func (pg *PgDb) collectionRemove(title *string) error {
 	if title == nil {
 		return nil
 	}
 
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	// Children move up to the removed collection's parent
 	queryStr := fmt.Sprintf(`
-		DELETE FROM %s.collection c
-		WHERE c.title = $1
+		UPDATE %[1]s.collection ch SET parent_title = p.parent_title
+		FROM %[1]s.collection p
+		WHERE p.owner_id = $1 AND p.title = $2 AND p.deleted_ts IS NULL
+			AND ch.owner_id = $1 AND ch.parent_title = $2
 	`, pg.SchemaVersion)
 
-	rows, err := pg.SqlDb.Query(queryStr, *title)
+	_, err = pg.conn().Exec(queryStr, ownerId, *title)
 
 	if err != nil {
 		return err
 	}
 
-	// Close the connection once we're done
-	defer rows.Close()
+	// Its memberships and parent are kept for a restore
+	queryStr = fmt.Sprintf(`
+		UPDATE %s.collection c SET deleted_ts = CURRENT_TIMESTAMP
+		WHERE c.owner_id = $1 AND c.title = $2 AND c.deleted_ts IS NULL
+	`, pg.SchemaVersion)
+
+	_, err = pg.conn().Exec(queryStr, ownerId, *title)
 
-	return nil
+	return err
 }
 
 func (pg *PgDb) Connect() error {
@@ -144,6 +890,20 @@ func (pg *PgDb) Connect() error {
 
 	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, dbname, sslmode)
 
+	// Certificate paths are quoted as they may contain spaces
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	sslFiles := [][2]string{
+		{"sslrootcert", pg.Config.SslRootCert},
+		{"sslcert", pg.Config.SslCert},
+		{"sslkey", pg.Config.SslKey},
+	}
+
+	for _, f := range sslFiles {
+		if f[1] != "" {
+			connString += fmt.Sprintf(" %s='%s'", f[0], quote.Replace(f[1]))
+		}
+	}
+
 	db, err := sql.Open("postgres", connString)
 
 	if err != nil {
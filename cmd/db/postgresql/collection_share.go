@@ -0,0 +1,186 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	_ "github.com/lib/pq"
+)
+
+// Creates a share link for one of the current user's collections. Only the
+// hash of the token is stored. Returns the share_id generated.
+func (pg *PgDb) CollectionShareCreate(title *string, prefix string, tokenHash string, expiresTs *time.Time) (*int, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.collection_share (owner_id, title, prefix, token_hash, expires_ts)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING share_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, *title, prefix, tokenHash, expiresTs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns the share links of one of the current user's collections,
+// including revoked and expired links.
+func (pg *PgDb) CollectionShareList(title *string) ([]v1.CollectionShare, error) {
+	if title == nil {
+		return nil, nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT s.share_id, s.created_ts, s.title, s.prefix, s.expires_ts, s.revoked_ts
+		FROM %s.collection_share s
+		WHERE s.owner_id = $1 AND s.title = $2
+		ORDER BY s.share_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, *title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedCollectionShares(rows)
+}
+
+// Revokes one of the current user's share links by id.
+func (pg *PgDb) CollectionShareRevoke(id int) error {
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection_share
+		SET revoked_ts = CURRENT_TIMESTAMP
+		WHERE share_id = $1 AND owner_id = $2 AND revoked_ts IS NULL
+		RETURNING share_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id, ownerId)
+
+	if err != nil {
+		return err
+	}
+
+	revokedId, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if revokedId == nil {
+		return db.NotFound("share not found")
+	}
+
+	return nil
+}
+
+// Returns the collection for an active (not revoked or expired) share
+// token hash. Returns nil, nil if the token is not valid.
+func (pg *PgDb) CollectionGetByShareToken(tokenHash string) (*v1.Collection, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.collection_share s
+		INNER JOIN %s.collection c ON s.owner_id = c.owner_id AND s.title = c.title
+		WHERE s.token_hash = $1 AND s.revoked_ts IS NULL AND c.deleted_ts IS NULL
+		AND (s.expires_ts IS NULL OR s.expires_ts > CURRENT_TIMESTAMP)
+	`, collectionColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, tokenHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.scanCollectionWithBooks(rows)
+}
+
+// Marks one of the current user's collections as public or private.
+func (pg *PgDb) CollectionSetPublic(title *string, public bool) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionSetPublic(title, public)
+	})
+}
+
+func (pg *PgDb) collectionSetPublic(title *string, public bool) error {
+	if title == nil {
+		return nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection
+		SET public = $1
+		WHERE owner_id = $2 AND title = $3 AND deleted_ts IS NULL
+		RETURNING owner_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, public, ownerId, *title)
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if updated == nil {
+		return db.NotFound("collection not found")
+	}
+
+	return nil
+}
+
+// Returns a user's public collection by username and title or slug. Returns
+// nil, nil if the collection does not exist or is not public.
+func (pg *PgDb) CollectionGetPublic(username string, title string) (*v1.Collection, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.collection c
+		INNER JOIN %s.app_user u ON c.owner_id = u.user_id
+		WHERE u.username = $1 AND (c.title = $2 OR c.slug = $2) AND c.public
+			AND c.deleted_ts IS NULL
+		ORDER BY c.title = $2 DESC
+	`, collectionColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, username, title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.scanCollectionWithBooks(rows)
+}
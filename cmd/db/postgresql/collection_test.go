@@ -1,9 +1,12 @@
 package postgresql
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/db"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -57,12 +60,276 @@ var _ = Describe("Collection Test", func() {
 				Expect(collection).ToNot(BeNil())
 			})
 
+			It("Should list collections", func() {
+				colTitle = "collTestList" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&colTitle, bookIds)
+				Expect(err).To(BeNil())
+
+				collections, err := pgDb.CollectionList(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collections).To(HaveLen(1))
+				Expect(collections[0].Title).To(Equal(colTitle))
+			})
+
+			It("Should keep books in their collection order", func() {
+				colTitle = "collTestOrder" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&colTitle, []int{bookIds[2], bookIds[0], bookIds[1]})
+				Expect(err).To(BeNil())
+
+				Expect(pgDb.CollectionMoveBook(&colTitle, bookIds[1], 1)).To(Succeed())
+				Expect(pgDb.CollectionAddBooks(&colTitle, []int{bookIds[4], bookIds[3]})).To(Succeed())
+
+				note := "Week 1"
+				Expect(pgDb.CollectionSetNote(&colTitle, bookIds[1], &note)).To(Succeed())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+
+				order := []int{}
+				for _, b := range collection.Books {
+					order = append(order, b.BookId)
+				}
+				Expect(order).To(Equal([]int{bookIds[1], bookIds[2], bookIds[0], bookIds[4], bookIds[3]}))
+				Expect(collection.Entries[0].Position).To(Equal(1))
+				Expect(*collection.Entries[0].Note).To(Equal(note))
+
+				Expect(pgDb.CollectionReorder(&colTitle, bookIds[:4])).ToNot(Succeed())
+				Expect(pgDb.CollectionReorder(&colTitle, bookIds)).To(Succeed())
+
+				collection, err = pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Books[0].BookId).To(Equal(bookIds[0]))
+				Expect(collection.Entries[4].Position).To(Equal(5))
+			})
+
+			It("Should nest collections without cycles", func() {
+				colTitle = "collTestTree" + fmt.Sprint(time.Now().UnixMicro())
+				child, grandchild := colTitle+"_child", colTitle+"_grandchild"
+
+				_, err := pgDb.CollectionCreate(&colTitle, []int{bookIds[0]})
+				Expect(err).To(BeNil())
+				_, err = pgDb.CollectionCreate(&child, []int{bookIds[1], bookIds[0]})
+				Expect(err).To(BeNil())
+				_, err = pgDb.CollectionCreate(&grandchild, []int{bookIds[2]})
+				Expect(err).To(BeNil())
+				defer pgDb.CollectionRemove(&child)
+				defer pgDb.CollectionRemove(&grandchild)
+
+				Expect(pgDb.CollectionSetParent(&child, &colTitle)).To(Succeed())
+				Expect(pgDb.CollectionSetParent(&grandchild, &child)).To(Succeed())
+				Expect(pgDb.CollectionSetParent(&colTitle, &grandchild)).ToNot(Succeed())
+				Expect(pgDb.CollectionSetParent(&colTitle, &colTitle)).ToNot(Succeed())
+
+				tree, err := pgDb.CollectionTree()
+				Expect(err).To(BeNil())
+				Expect(tree).To(ContainElement(SatisfyAll(
+					HaveField("Title", colTitle),
+					HaveField("Children", ConsistOf(HaveField("Children", ConsistOf(HaveField("Title", grandchild))))),
+				)))
+
+				all, err := pgDb.CollectionGetRecursive(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(all.Books).To(HaveLen(3))
+				Expect(all.Books[2].BookId).To(Equal(bookIds[2]))
+
+				// The grandchild moves up to the removed child's parent
+				Expect(pgDb.CollectionRemove(&child)).To(Succeed())
+				moved, err := pgDb.CollectionGet(&grandchild)
+				Expect(err).To(BeNil())
+				Expect(*moved.Parent).To(Equal(colTitle))
+			})
+
+			It("Should rename a collection and keep its books", func() {
+				colTitle = "collTestRename" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&colTitle, bookIds)
+				Expect(err).To(BeNil())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Slug).To(Equal(v1.Slugify(colTitle)))
+
+				newTitle := "Lectures & Notes " + fmt.Sprint(time.Now().UnixMicro())
+				description := "Week by week"
+				updated, err := pgDb.CollectionUpdate(collection.CollectionId, &v1.CollectionUpdate{
+					Title:       &newTitle,
+					Description: &description,
+				})
+				Expect(err).To(BeNil())
+				Expect(updated.Slug).To(Equal(v1.Slugify(newTitle)))
+				Expect(*updated.Description).To(Equal(description))
+
+				// Found by title or slug, with its books
+				renamed, err := pgDb.CollectionGet(&updated.Slug)
+				Expect(err).To(BeNil())
+				Expect(renamed.CollectionId).To(Equal(collection.CollectionId))
+				Expect(renamed.Books).To(HaveLen(bookCardinality))
+
+				old, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(old).To(BeNil())
+
+				// Titles that slugify alike get numbered slugs
+				sameSlug := strings.ToUpper(newTitle)
+				_, err = pgDb.CollectionCreate(&sameSlug, nil)
+				Expect(err).To(BeNil())
+				defer pgDb.CollectionRemove(&sameSlug)
+
+				other, err := pgDb.CollectionGet(&sameSlug)
+				Expect(err).To(BeNil())
+				Expect(other.Slug).To(Equal(updated.Slug + "-2"))
+
+				_, err = pgDb.CollectionUpdate(other.CollectionId, &v1.CollectionUpdate{Title: &newTitle})
+				Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+			})
+
+			It("Should audit collection and book changes", func() {
+				colTitle = "collTestAudit" + fmt.Sprint(time.Now().UnixMicro())
+				start := time.Now().Add(-time.Minute)
+
+				_, err := pgDb.CollectionCreate(&colTitle, bookIds[:1])
+				Expect(err).To(BeNil())
+				Expect(pgDb.CollectionAddBooks(&colTitle, bookIds[1:2])).To(Succeed())
+				// Adding a book already in the collection changes nothing
+				Expect(pgDb.CollectionAddBooks(&colTitle, bookIds[1:2])).To(Succeed())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+
+				entity := v1.AuditEntityCollection
+				entries, err := pgDb.AuditList(&v1.AuditFilter{Entity: &entity, EntityId: &collection.CollectionId, Since: &start})
+				Expect(err).To(BeNil())
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[0].Action).To(Equal(v1.AuditActionUpdate))
+				Expect(*entries[0].Actor).To(Equal("admin"))
+				Expect(entries[0].ChangedFields()).To(Equal([]string{"entries"}))
+				Expect(entries[1].Action).To(Equal(v1.AuditActionCreate))
+				Expect(entries[1].Before).To(BeEmpty())
+
+				Expect(pgDb.BookRemove(bookIds[4])).To(Succeed())
+
+				entity = v1.AuditEntityBook
+				entries, err = pgDb.AuditList(&v1.AuditFilter{Entity: &entity, EntityId: &bookIds[4], Limit: 1})
+				Expect(err).To(BeNil())
+				Expect(entries[0].Action).To(Equal(v1.AuditActionDelete))
+				Expect(string(entries[0].Before)).To(ContainSubstring(booksToSave[4].Title))
+				Expect(entries[0].After).To(BeEmpty())
+			})
+
+			It("Should restore trashed books and collections", func() {
+				colTitle = "collTestTrash" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&colTitle, bookIds[:3])
+				Expect(err).To(BeNil())
+
+				Expect(pgDb.BookRemove(bookIds[1])).To(Succeed())
+
+				books, err := pgDb.BookFilter(&v1.BookFilter{Genre: booksToSave[1].Genre})
+				Expect(err).To(BeNil())
+				Expect(books).To(BeEmpty())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Books).To(HaveLen(2))
+
+				Expect(pgDb.CollectionRemove(&colTitle)).To(Succeed())
+
+				collection, err = pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection).To(BeNil())
+
+				_, err = pgDb.CollectionCreate(&colTitle, nil)
+				Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+
+				trash, err := pgDb.TrashList()
+				Expect(err).To(BeNil())
+				Expect(trash.Collections[0].Title).To(Equal(colTitle))
+
+				Expect(pgDb.TrashRestoreCollection(trash.Collections[0].CollectionId)).To(Succeed())
+				Expect(pgDb.TrashRestoreBook(bookIds[1])).To(Succeed())
+				Expect(pgDb.TrashRestoreBook(bookIds[1])).ToNot(Succeed())
+
+				entity := v1.AuditEntityBook
+				entries, err := pgDb.AuditList(&v1.AuditFilter{Entity: &entity, EntityId: &bookIds[1], Limit: 1})
+				Expect(err).To(BeNil())
+				Expect(entries[0].Action).To(Equal(v1.AuditActionRestore))
+
+				changed, err := entries[0].ChangedFields()
+				Expect(err).To(BeNil())
+				Expect(changed).To(Equal([]string{"deletedTs"}))
+
+				collection, err = pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Books).To(HaveLen(3))
+				Expect(collection.Books[1].BookId).To(Equal(bookIds[1]))
+			})
+
+			It("Should undo the last changes", func() {
+				colTitle = "collTestUndo" + fmt.Sprint(time.Now().UnixMicro())
+				_, err := pgDb.CollectionCreate(&colTitle, bookIds[:1])
+				Expect(err).To(BeNil())
+				Expect(pgDb.CollectionAddBooks(&colTitle, bookIds[1:2])).To(Succeed())
+				Expect(pgDb.BookRemove(bookIds[1])).To(Succeed())
+
+				entries, err := pgDb.UndoList(2)
+				Expect(err).To(BeNil())
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[0].Entity).To(Equal(v1.AuditEntityBook))
+				Expect(entries[1].Action).To(Equal(v1.AuditActionUpdate))
+
+				_, err = pgDb.Undo([]int{entries[1].AuditId, entries[0].AuditId})
+				Expect(errors.Is(err, db.ErrConflict)).To(BeTrue())
+
+				undone, err := pgDb.Undo([]int{entries[0].AuditId, entries[1].AuditId})
+				Expect(err).To(BeNil())
+				Expect(undone).To(Equal(entries))
+
+				book, err := pgDb.BookGet(bookIds[1])
+				Expect(err).To(BeNil())
+				Expect(book).ToNot(BeNil())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Books).To(HaveLen(1))
+				Expect(collection.Books[0].BookId).To(Equal(bookIds[0]))
+
+				// Undos aren't undone themselves, the collection's creation is next
+				entries, err = pgDb.UndoList(1)
+				Expect(err).To(BeNil())
+				Expect(entries[0].Action).To(Equal(v1.AuditActionCreate))
+				Expect(entries[0].EntityId).To(Equal(collection.CollectionId))
+
+				_, err = pgDb.Undo([]int{entries[0].AuditId})
+				Expect(err).To(BeNil())
+
+				collection, err = pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection).To(BeNil())
+			})
+
+			It("Should read a smart collection's books through its filter", func() {
+				colTitle = "collTestSmart" + fmt.Sprint(time.Now().UnixMicro())
+				tomorrow := time.Now().AddDate(0, 0, 1)
+				filter := &v1.BookFilter{Genre: booksToSave[2].Genre, PublishedBefore: &tomorrow}
+
+				_, err := pgDb.CollectionCreateSmart(&colTitle, filter)
+				Expect(err).To(BeNil())
+
+				collection, err := pgDb.CollectionGet(&colTitle)
+				Expect(err).To(BeNil())
+				Expect(collection.Smart).To(BeTrue())
+				Expect(*collection.Filter.Genre).To(Equal(*booksToSave[2].Genre))
+				Expect(collection.Books).To(HaveLen(1))
+				Expect(collection.Books[0].BookId).To(Equal(bookIds[2]))
+
+				Expect(pgDb.CollectionAddBooks(&colTitle, bookIds)).ToNot(Succeed())
+			})
+
 			AfterEach(func() {
 				for _, bookId := range bookIds {
 					pgDb.BookRemove(bookId)
 				}
 
 				pgDb.CollectionRemove(&colTitle)
+				pgDb.TrashPurge(nil)
 			})
 		})
 
@@ -0,0 +1,192 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Moves one of the current user's collections, with everything nested
+// under it, under parent. A nil parent makes it a root collection. Moving
+// a collection under itself or one of its descendants is an error.
+func (pg *PgDb) CollectionSetParent(title *string, parent *string) error {
+	return pg.auditCollection(title, func(tx *PgDb) error {
+		return tx.collectionSetParent(title, parent)
+	})
+}
+
+func (pg *PgDb) collectionSetParent(title *string, parent *string) error {
+	if title == nil {
+		return nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	if parent != nil {
+		// The new parent and its ancestors, which must not include title
+		queryStr := fmt.Sprintf(`
+			WITH RECURSIVE ancestors (title, parent_title) AS (
+				SELECT c.title, c.parent_title FROM %[1]s.collection c
+				WHERE c.owner_id = $1 AND c.title = $2 AND c.deleted_ts IS NULL
+				UNION ALL
+				SELECT c.title, c.parent_title FROM %[1]s.collection c
+				INNER JOIN ancestors a ON c.title = a.parent_title
+				WHERE c.owner_id = $1
+			)
+			SELECT a.title FROM ancestors a
+		`, pg.SchemaVersion)
+
+		rows, err := pg.conn().Query(queryStr, ownerId, *parent)
+
+		if err != nil {
+			return err
+		}
+
+		ancestors, err := ScanReturnedStrings(rows)
+
+		if err != nil {
+			return err
+		}
+
+		if len(ancestors) < 1 {
+			return errors.New("parent collection not found")
+		}
+
+		for _, ancestor := range ancestors {
+			if ancestor == *title {
+				return errors.New("a collection can't be moved under itself or its descendants")
+			}
+		}
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection c SET parent_title = $3
+		WHERE c.owner_id = $1 AND c.title = $2 AND c.deleted_ts IS NULL
+	`, pg.SchemaVersion)
+
+	result, err := pg.conn().Exec(queryStr, ownerId, *title, parent)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return db.NotFound("collection not found")
+	}
+
+	return nil
+}
+
+// Returns the current user's root collections, without their books, with
+// the collections nested under them in Children. Siblings are sorted by
+// title.
+func (pg *PgDb) CollectionTree() ([]v1.Collection, error) {
+	collections, err := pg.CollectionList(nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return collectionTree(collections, nil), nil
+}
+
+// Returns the collections under parent, with their own children set.
+// collections is sorted by title, so siblings are too.
+func collectionTree(collections []v1.Collection, parent *string) []v1.Collection {
+	nodes := make([]v1.Collection, 0)
+
+	for _, c := range collections {
+		if (parent == nil && c.Parent == nil) || (parent != nil && c.Parent != nil && *c.Parent == *parent) {
+			title := c.Title
+			c.Children = collectionTree(collections, &title)
+			nodes = append(nodes, c)
+		}
+	}
+
+	return nodes
+}
+
+// Returns the current user's collection with the given title, its Books
+// being every book in it and the collections nested under it. Books are
+// in tree order, each once: the collection's own, then each child's in
+// title order. Returns nil, nil if not found.
+func (pg *PgDb) CollectionGetRecursive(title *string) (*v1.Collection, error) {
+	collection, err := pg.CollectionGet(title)
+
+	if err != nil || collection == nil {
+		return collection, err
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		WITH RECURSIVE descendants (title, path) AS (
+			SELECT c.title, ARRAY[c.title] FROM %[1]s.collection c
+			WHERE c.owner_id = $1 AND c.parent_title = $2 AND c.deleted_ts IS NULL
+			UNION ALL
+			SELECT c.title, d.path || c.title FROM %[1]s.collection c
+			INNER JOIN descendants d ON c.parent_title = d.title
+			WHERE c.owner_id = $1 AND c.deleted_ts IS NULL
+		)
+		SELECT d.title FROM descendants d ORDER BY d.path
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, *title)
+
+	if err != nil {
+		return nil, err
+	}
+
+	descendants, err := ScanReturnedStrings(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int]bool{}
+
+	for _, b := range collection.Books {
+		seen[b.BookId] = true
+	}
+
+	for _, descendant := range descendants {
+		child, err := pg.CollectionGet(&descendant)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if child == nil {
+			// Removed while reading
+			continue
+		}
+
+		for _, b := range child.Books {
+			if !seen[b.BookId] {
+				seen[b.BookId] = true
+				collection.Books = append(collection.Books, b)
+			}
+		}
+	}
+
+	// Entries are the collection's own; positions don't apply to the rest
+	collection.Entries = nil
+
+	return collection, nil
+}
@@ -0,0 +1,237 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
+)
+
+// The copy columns read by ScanReturnedCopies. Expects the book_copy table
+// aliased as c.
+const copyColumns = `c.copy_id, c.book_id, c.owner_id, c.created_ts, c.condition, c.acquired_ts, c.price, c.location_id`
+
+// Adds a copy of a book visible to the user. The copy belongs to the
+// book's owner. Returns the copy_id generated.
+func (pg *PgDb) CopyCreate(c *v1.Copy) (*int, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	book, err := pg.BookGet(c.BookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if book == nil {
+		return nil, errors.New("book not found")
+	}
+
+	if c.LocationId != nil {
+		if _, err := pg.locationGet(*c.LocationId); err != nil {
+			return nil, err
+		}
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.book_copy (book_id, owner_id, condition, acquired_ts, price, location_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING copy_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, c.BookId, book.OwnerId, c.Condition, c.AcquiredTs, c.Price, c.LocationId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns a copy with its move history, or nil, nil if not found.
+// Members may only read their own copies.
+func (pg *PgDb) CopyGet(id int) (*v1.Copy, error) {
+	copies, err := pg.copyQuery([]string{" c.copy_id = $1 "}, []interface{}{id})
+
+	if err != nil || len(copies) < 1 {
+		return nil, err
+	}
+
+	bookCopy := &copies[0]
+
+	queryStr := fmt.Sprintf(`
+		SELECT m.move_id, m.moved_ts, m.from_location_id, m.to_location_id
+		FROM %s.book_copy_move m
+		WHERE m.copy_id = $1
+		ORDER BY m.move_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bookCopy.Moves, err = ScanReturnedCopyMoves(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bookCopy, nil
+}
+
+// Returns copies matching filter. Filtering on a location includes the
+// locations inside it, e.g. every copy in a room.
+func (pg *PgDb) CopyList(filter *v1.CopyFilter) ([]v1.Copy, error) {
+	if filter == nil {
+		filter = &v1.CopyFilter{}
+	}
+
+	wheres := make([]string, 0)
+	values := make([]interface{}, 0)
+
+	if filter.BookId != nil {
+		values = append(values, *filter.BookId)
+		wheres = append(wheres, " c.book_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if filter.LocationId != nil {
+		locs, err := pg.LocationList()
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, pq.Array(v1.LocationDescendants(locs, *filter.LocationId)))
+		wheres = append(wheres, " c.location_id = ANY($"+fmt.Sprint(len(values))+") ")
+	}
+
+	return pg.copyQuery(wheres, values)
+}
+
+// Moves a copy to a location, or takes it off the shelves for a nil
+// locationId. The move is recorded in the copy's history.
+func (pg *PgDb) CopyMove(id int, locationId *int) error {
+	bookCopy, err := pg.CopyGet(id)
+
+	if err != nil {
+		return err
+	}
+
+	if bookCopy == nil {
+		return db.NotFound("copy not found")
+	}
+
+	if locationId != nil {
+		if _, err := pg.locationGet(*locationId); err != nil {
+			return err
+		}
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.book_copy SET location_id = $2 WHERE copy_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id, locationId)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	queryStr = fmt.Sprintf(`
+		INSERT INTO %s.book_copy_move (copy_id, from_location_id, to_location_id)
+		VALUES ($1, $2, $3)
+	`, pg.SchemaVersion)
+
+	rows, err = pg.conn().Query(queryStr, id, bookCopy.LocationId, locationId)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Removes a copy, e.g. one given away.
+func (pg *PgDb) CopyRemove(id int) error {
+	bookCopy, err := pg.CopyGet(id)
+
+	if err != nil {
+		return err
+	}
+
+	if bookCopy == nil {
+		return db.NotFound("copy not found")
+	}
+
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.book_copy WHERE copy_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Selects copies matching wheres, adding the member scope, and sets their
+// location paths.
+func (pg *PgDb) copyQuery(wheres []string, values []interface{}) ([]v1.Copy, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.book_copy c
+	`, copyColumns, pg.SchemaVersion)
+
+	if pg.isScoped() {
+		values = append(values, pg.User.UserId)
+		wheres = append(wheres, " c.owner_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if len(wheres) > 0 {
+		queryStr += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY c.copy_id ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copies, err := ScanReturnedCopies(rows)
+
+	if err != nil || len(copies) < 1 {
+		return copies, err
+	}
+
+	locs, err := pg.LocationList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[int]string{}
+	for _, l := range locs {
+		paths[l.LocationId] = l.Path
+	}
+
+	for i := range copies {
+		if copies[i].LocationId != nil {
+			copies[i].LocationPath = paths[*copies[i].LocationId]
+		}
+	}
+
+	return copies, nil
+}
@@ -0,0 +1,162 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The loan columns read by ScanReturnedLoans. Expects the loan table
+// aliased as l.
+const loanColumns = `l.loan_id, l.book_id, l.owner_id, l.borrower, l.loaned_ts, l.due_ts, l.returned_ts, l.note`
+
+// Lends a book visible to the current user. The loan belongs to the
+// book's owner. Returns the loan_id generated.
+func (pg *PgDb) LoanCreate(l *v1.Loan) (*int, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	if strings.TrimSpace(l.Borrower) == "" {
+		return nil, errors.New("borrower is required")
+	}
+
+	book, err := pg.BookGet(l.BookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if book == nil {
+		return nil, errors.New("book not found")
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.loan (book_id, owner_id, borrower, due_ts, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING loan_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, l.BookId, book.OwnerId, strings.TrimSpace(l.Borrower), l.DueTs, l.Note)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("book is already on loan")
+		}
+
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns a loan by id. Members may only read loans of their own books.
+// Returns nil, nil if not found.
+func (pg *PgDb) LoanGet(id int) (*v1.Loan, error) {
+	loans, err := pg.loanQuery([]string{" l.loan_id = $1 "}, []interface{}{id})
+
+	if err != nil || len(loans) < 1 {
+		return nil, err
+	}
+
+	return &loans[0], nil
+}
+
+// Returns loans matching filter, newest first. Members only see loans of
+// their own books.
+func (pg *PgDb) LoanList(filter *v1.LoanFilter) ([]v1.Loan, error) {
+	if filter == nil {
+		filter = &v1.LoanFilter{}
+	}
+
+	wheres := make([]string, 0)
+	values := make([]interface{}, 0)
+
+	if filter.BookId != nil {
+		values = append(values, *filter.BookId)
+		wheres = append(wheres, " l.book_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if filter.Active || filter.Overdue {
+		wheres = append(wheres, " l.returned_ts IS NULL ")
+	}
+
+	if filter.Overdue {
+		wheres = append(wheres, " l.due_ts < CURRENT_TIMESTAMP ")
+	}
+
+	return pg.loanQuery(wheres, values)
+}
+
+// Checks a loan back in. Returns an error if the loan is not active or
+// not visible to the user.
+func (pg *PgDb) LoanReturn(id int) error {
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.loan l
+		SET returned_ts = CURRENT_TIMESTAMP
+		WHERE l.loan_id = $1 AND l.returned_ts IS NULL
+	`, pg.SchemaVersion)
+
+	values := []interface{}{id}
+
+	if pg.isScoped() {
+		queryStr += " AND l.owner_id = $2 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" RETURNING l.loan_id ", values...)
+
+	if err != nil {
+		return err
+	}
+
+	returned, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if returned == nil {
+		return db.NotFound("loan not found")
+	}
+
+	return nil
+}
+
+// Returns the active loan of a book, or nil if it isn't lent out.
+func (pg *PgDb) activeLoan(bookId int) (*v1.Loan, error) {
+	loans, err := pg.LoanList(&v1.LoanFilter{BookId: &bookId, Active: true})
+
+	if err != nil || len(loans) < 1 {
+		return nil, err
+	}
+
+	return &loans[0], nil
+}
+
+// Selects loans matching wheres, adding the member scope.
+func (pg *PgDb) loanQuery(wheres []string, values []interface{}) ([]v1.Loan, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.loan l
+	`, loanColumns, pg.SchemaVersion)
+
+	if pg.isScoped() {
+		values = append(values, pg.User.UserId)
+		wheres = append(wheres, " l.owner_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if len(wheres) > 0 {
+		queryStr += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY l.loaned_ts DESC, l.loan_id DESC ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedLoans(rows)
+}
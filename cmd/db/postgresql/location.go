@@ -0,0 +1,147 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
+)
+
+// Creates a location. Locations inside a parent belong to the parent's
+// owner, and their kind defaults to the kind below the parent's. Returns
+// the location_id generated.
+func (pg *PgDb) LocationCreate(l *v1.Location) (*int, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(l.Name)
+
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	parentKind := ""
+
+	if l.ParentId != nil {
+		parent, err := pg.locationGet(*l.ParentId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ownerId = parent.OwnerId
+		parentKind = parent.Kind
+	}
+
+	kind := l.Kind
+
+	if kind == "" {
+		kind = v1.ChildLocationKind(parentKind)
+	}
+
+	if !v1.ValidLocationKind(kind) {
+		return nil, errors.New("kind must be one of building, room, shelf or position")
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.location (parent_id, owner_id, name, kind)
+		VALUES ($1, $2, $3, $4)
+		RETURNING location_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, l.ParentId, ownerId, name, kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns the locations visible to the user with their paths, sorted by
+// path. Members only see their own locations.
+func (pg *PgDb) LocationList() ([]v1.Location, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT l.location_id, l.parent_id, l.owner_id, l.created_ts, l.name, l.kind
+		FROM %s.location l
+	`, pg.SchemaVersion)
+
+	values := []interface{}{}
+
+	if pg.isScoped() {
+		queryStr += " WHERE l.owner_id = $1 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr, values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	locs, err := ScanReturnedLocations(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v1.SetLocationPaths(locs)
+
+	return locs, nil
+}
+
+// Removes an empty location. Copies in it are left without a location.
+func (pg *PgDb) LocationRemove(id int) error {
+	if _, err := pg.locationGet(id); err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.location l
+		WHERE l.location_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		var pqErr *pq.Error
+
+		// Foreign key violation from a child location
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return errors.New("location has locations inside it")
+		}
+
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Returns a location visible to the user, or an error if not found.
+func (pg *PgDb) locationGet(id int) (*v1.Location, error) {
+	locs, err := pg.LocationList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range locs {
+		if locs[i].LocationId == id {
+			return &locs[i], nil
+		}
+	}
+
+	return nil, db.NotFound("location not found")
+}
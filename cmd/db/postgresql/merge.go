@@ -0,0 +1,112 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Merges the book drop into keep and moves drop to the trash. Collection
+// memberships, identifiers, notes, loans, reviews, reading progress,
+// copies and series entries move to keep; where keep already has its own
+// (e.g. a review by the same user), keep's is kept. Fields keep is missing
+// are filled in from drop. Both books must belong to the same owner. Both
+// books get a merge audit entry, which Undo skips; drop can be restored
+// from the trash instead.
+func (pg *PgDb) BookMerge(keep int, drop int) error {
+	if keep == drop {
+		return errors.New("cannot merge a book into itself")
+	}
+
+	keepBook, err := pg.BookGet(keep)
+
+	if err != nil {
+		return err
+	}
+
+	dropBook, err := pg.BookGet(drop)
+
+	if err != nil {
+		return err
+	}
+
+	if keepBook == nil || dropBook == nil {
+		return db.NotFound("book not found")
+	}
+
+	if keepBook.OwnerId != dropBook.OwnerId {
+		return errors.New("books have different owners")
+	}
+
+	// Fails if both books have an active loan
+	loanStatement := `UPDATE %[1]s.loan SET book_id = $1 WHERE book_id = $2`
+
+	// Each statement takes keep as $1 and drop as $2
+	statements := []string{
+		`INSERT INTO %[1]s.collection_books (owner_id, title, book_id, position, note)
+			SELECT cb.owner_id, cb.title, $1, cb.position, cb.note FROM %[1]s.collection_books cb WHERE cb.book_id = $2
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO %[1]s.book_identifier (book_id, type, value)
+			SELECT $1, i.type, i.value FROM %[1]s.book_identifier i WHERE i.book_id = $2
+			ON CONFLICT DO NOTHING`,
+		`UPDATE %[1]s.note SET book_id = $1 WHERE book_id = $2`,
+		loanStatement,
+		`INSERT INTO %[1]s.review (user_id, book_id, rating, body, created_ts, updated_ts)
+			SELECT rv.user_id, $1, rv.rating, rv.body, rv.created_ts, rv.updated_ts
+			FROM %[1]s.review rv WHERE rv.book_id = $2
+			ON CONFLICT DO NOTHING`,
+		// Progress history moves to keep's state, which must exist first
+		`INSERT INTO %[1]s.reading_state (user_id, book_id, status, started_ts, finished_ts, page, percent, updated_ts)
+			SELECT r.user_id, $1, r.status, r.started_ts, r.finished_ts, r.page, r.percent, r.updated_ts
+			FROM %[1]s.reading_state r WHERE r.book_id = $2
+			ON CONFLICT DO NOTHING`,
+		`UPDATE %[1]s.reading_progress SET book_id = $1 WHERE book_id = $2`,
+		`UPDATE %[1]s.book_copy SET book_id = $1 WHERE book_id = $2`,
+		`INSERT INTO %[1]s.series_entry (book_id, series_id, position)
+			SELECT $1, se.series_id, se.position FROM %[1]s.series_entry se WHERE se.book_id = $2
+			ON CONFLICT DO NOTHING`,
+		`UPDATE %[1]s.book SET translation_of = $1 WHERE translation_of = $2`,
+		// The ISBN index covers the trash, so drop gives up its ISBN if
+		// keep takes it
+		`UPDATE %[1]s.book d SET deleted_ts = CURRENT_TIMESTAMP,
+			isbn13 = CASE WHEN k.isbn13 IS NULL THEN NULL ELSE d.isbn13 END
+			FROM %[1]s.book k
+			WHERE d.book_id = $2 AND k.book_id = $1`,
+		// After the soft delete, so drop's ISBN is free to move
+		`UPDATE %[1]s.book b SET
+			isbn13 = COALESCE(b.isbn13, d.isbn13),
+			description = COALESCE(b.description, d.description),
+			genre = COALESCE(b.genre, d.genre),
+			language = COALESCE(b.language, d.language)
+			FROM (SELECT $3::text AS isbn13, $4::text AS description, $5::text AS genre, $6::text AS language) d
+			WHERE b.book_id = $1`,
+	}
+
+	return pg.inTx(func(tx *PgDb) error {
+		for i, statement := range statements {
+			values := []interface{}{keep, drop}
+
+			if i == len(statements)-1 {
+				values = append(values, dropBook.Isbn13, dropBook.Description, dropBook.Genre, dropBook.Language)
+			}
+
+			_, err := tx.conn().Exec(fmt.Sprintf(statement, tx.SchemaVersion), values...)
+
+			if err != nil {
+				if statement == loanStatement && isUniqueViolation(err) {
+					return errors.New("both books are on loan")
+				}
+
+				return err
+			}
+		}
+
+		if err := tx.auditBook(v1.AuditActionMerge, drop, dropBook); err != nil {
+			return err
+		}
+
+		return tx.auditBook(v1.AuditActionMerge, keep, keepBook)
+	})
+}
@@ -21,6 +21,8 @@ var pgDb = PgDb{
 		DbName:   "postgres",
 		SslMode:  "disable",
 	},
+	// The admin seeded by migration 000003
+	User: &v1.User{UserId: 1, Username: "admin", Role: v1.UserRoleAdmin},
 }
 
 func TestPostgres(t *testing.T) {
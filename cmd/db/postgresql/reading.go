@@ -0,0 +1,164 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Returns the current user's reading state of a book with its history,
+// or nil, nil if the user hasn't recorded any progress.
+func (pg *PgDb) BookProgressGet(bookId int) (*v1.ReadingState, error) {
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.checkBookVisible(bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := pg.readingStateGet(userId, bookId)
+
+	if err != nil || state == nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT p.progress_id, p.created_ts, p.status, p.page, p.percent
+		FROM %s.reading_progress p
+		WHERE p.user_id = $1 AND p.book_id = $2
+		ORDER BY p.progress_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state.History, err = ScanReturnedProgressUpdates(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Records a progress update for the current user and returns the new
+// reading state. See v1.ReadingState.Apply for how updates are applied.
+func (pg *PgDb) BookProgressUpdate(bookId int, u *v1.ProgressUpdate) (*v1.ReadingState, error) {
+	if u == nil {
+		return nil, errors.New("no progress given")
+	}
+
+	err := u.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.checkBookVisible(bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := pg.readingStateGet(userId, bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		state = &v1.ReadingState{BookId: bookId, UserId: userId}
+	}
+
+	state.Apply(u, time.Now().UTC())
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.reading_state (user_id, book_id, status, started_ts, finished_ts, page, percent, updated_ts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, book_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			started_ts = EXCLUDED.started_ts,
+			finished_ts = EXCLUDED.finished_ts,
+			page = EXCLUDED.page,
+			percent = EXCLUDED.percent,
+			updated_ts = EXCLUDED.updated_ts
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, bookId, state.Status, state.StartedTs,
+		state.FinishedTs, state.Page, state.Percent, state.UpdatedTs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	queryStr = fmt.Sprintf(`
+		INSERT INTO %s.reading_progress (user_id, book_id, status, page, percent)
+		VALUES ($1, $2, $3, $4, $5)
+	`, pg.SchemaVersion)
+
+	rows, err = pg.conn().Query(queryStr, userId, bookId, state.Status, u.Page, u.Percent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	return pg.BookProgressGet(bookId)
+}
+
+// Returns an error if the book doesn't exist or isn't visible to the user.
+func (pg *PgDb) checkBookVisible(bookId int) error {
+	book, err := pg.BookGet(bookId)
+
+	if err != nil {
+		return err
+	}
+
+	if book == nil {
+		return db.NotFound("book not found")
+	}
+
+	return nil
+}
+
+func (pg *PgDb) readingStateGet(userId int, bookId int) (*v1.ReadingState, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT r.book_id, r.user_id, r.status, r.started_ts, r.finished_ts, r.page, r.percent, r.updated_ts
+		FROM %s.reading_state r
+		WHERE r.user_id = $1 AND r.book_id = $2
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := ScanReturnedReadingStates(rows)
+
+	if err != nil || len(states) < 1 {
+		return nil, err
+	}
+
+	return &states[0], nil
+}
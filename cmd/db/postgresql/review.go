@@ -0,0 +1,321 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
+)
+
+// The review columns read by ScanReturnedReviews. Expects the review
+// table aliased as rv and its user as u.
+const reviewColumns = `rv.book_id, rv.user_id, u.username, rv.rating, rv.body, rv.created_ts, rv.updated_ts`
+
+// The note columns read by ScanReturnedNotes. Expects the note table
+// aliased as n.
+const noteColumns = `n.note_id, n.book_id, n.user_id, n.page, n.highlight, n.body, n.created_ts, n.updated_ts`
+
+// Returns every user's review of a book visible to the current user,
+// newest first.
+func (pg *PgDb) ReviewList(bookId int) ([]v1.Review, error) {
+	err := pg.checkBookVisible(bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.review rv
+		INNER JOIN %s.app_user u ON u.user_id = rv.user_id
+		WHERE rv.book_id = $1
+		ORDER BY rv.updated_ts DESC
+	`, reviewColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, bookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedReviews(rows)
+}
+
+// Creates or updates the current user's review of a book. Fields left
+// out of an update are unchanged. Returns the saved review.
+func (pg *PgDb) ReviewSet(r *v1.Review) (*v1.Review, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.checkBookVisible(r.BookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.review AS rv (user_id, book_id, rating, body)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, book_id) DO UPDATE SET
+			rating = COALESCE(EXCLUDED.rating, rv.rating),
+			body = COALESCE(EXCLUDED.body, rv.body),
+			updated_ts = CURRENT_TIMESTAMP
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, r.BookId, r.Rating, r.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	reviews, err := pg.ReviewList(r.BookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range reviews {
+		if reviews[i].UserId == userId {
+			return &reviews[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Removes the current user's review of a book.
+func (pg *PgDb) ReviewRemove(bookId int) error {
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.review rv
+		WHERE rv.user_id = $1 AND rv.book_id = $2
+		RETURNING rv.book_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, bookId)
+
+	if err != nil {
+		return err
+	}
+
+	removed, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if removed == nil {
+		return db.NotFound("review not found")
+	}
+
+	return nil
+}
+
+// Creates a note on a book visible to the current user. Returns the
+// note_id generated.
+func (pg *PgDb) NoteCreate(n *v1.Note) (*int, error) {
+	if n == nil {
+		return nil, nil
+	}
+
+	if strings.TrimSpace(n.Body) == "" && n.Highlight == nil {
+		return nil, errors.New("a note needs a body or highlight")
+	}
+
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.checkBookVisible(n.BookId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.note (user_id, book_id, page, highlight, body)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING note_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, n.BookId, n.Page, n.Highlight, n.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns one of the current user's notes, or nil, nil if not found.
+func (pg *PgDb) NoteGet(id int) (*v1.Note, error) {
+	notes, err := pg.noteQuery(" n.note_id = $2 ", id)
+
+	if err != nil || len(notes) < 1 {
+		return nil, err
+	}
+
+	return &notes[0], nil
+}
+
+// Returns the current user's notes on a book, by page.
+func (pg *PgDb) NoteList(bookId int) ([]v1.Note, error) {
+	return pg.noteQuery(" n.book_id = $2 ", bookId)
+}
+
+// Replaces the page, highlight and body of one of the current user's
+// notes.
+func (pg *PgDb) NoteUpdate(n *v1.Note) error {
+	if n == nil {
+		return nil
+	}
+
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.note n
+		SET page = $3, highlight = $4, body = $5, updated_ts = CURRENT_TIMESTAMP
+		WHERE n.user_id = $1 AND n.note_id = $2
+		RETURNING n.note_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, n.NoteId, n.Page, n.Highlight, n.Body)
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if updated == nil {
+		return db.NotFound("note not found")
+	}
+
+	return nil
+}
+
+// Removes one of the current user's notes.
+func (pg *PgDb) NoteRemove(id int) error {
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.note n
+		WHERE n.user_id = $1 AND n.note_id = $2
+		RETURNING n.note_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, userId, id)
+
+	if err != nil {
+		return err
+	}
+
+	removed, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if removed == nil {
+		return db.NotFound("note not found")
+	}
+
+	return nil
+}
+
+// Selects the current user's notes matching where, which refers to value
+// as $2. Notes are private, so admins don't see other users' notes either.
+func (pg *PgDb) noteQuery(where string, value interface{}) ([]v1.Note, error) {
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.note n
+		WHERE n.user_id = $1 AND %s
+		ORDER BY n.page NULLS FIRST, n.created_ts
+	`, noteColumns, pg.SchemaVersion, where)
+
+	rows, err := pg.conn().Query(queryStr, userId, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedNotes(rows)
+}
+
+// Sets the average rating of books. Expects index to map book ids to
+// their index in books.
+func (pg *PgDb) loadBookRatings(books []v1.Book, index map[int]int) error {
+	bookIds := make([]int, 0, len(books))
+	for _, b := range books {
+		bookIds = append(bookIds, b.BookId)
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT rv.book_id, avg(rv.rating), count(rv.rating)
+		FROM %s.review rv
+		WHERE rv.book_id = ANY($1) AND rv.rating IS NOT NULL
+		GROUP BY rv.book_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, pq.Array(bookIds))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookId int
+		rating := &v1.BookRating{}
+
+		err := rows.Scan(&bookId, &rating.Average, &rating.Count)
+
+		if err != nil {
+			return err
+		}
+
+		books[index[bookId]].Rating = rating
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,325 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
+)
+
+// The series columns read by ScanReturnedSeries. Expects the series table
+// aliased as s.
+const seriesColumns = `s.series_id, s.owner_id, s.created_ts, s.name, s.description`
+
+// Creates a series owned by the current user. Returns the series_id
+// generated.
+func (pg *PgDb) SeriesCreate(s *v1.Series) (*int, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(s.Name)
+
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.series (owner_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING series_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, name, s.Description)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.New("a series with this name already exists")
+		}
+
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns a series with its books in series order. Members may only read
+// their own series. Returns nil, nil if not found.
+func (pg *PgDb) SeriesGet(id int) (*v1.Series, error) {
+	series, err := pg.seriesQuery([]string{" s.series_id = $1 "}, []interface{}{id})
+
+	if err != nil || len(series) < 1 {
+		return nil, err
+	}
+
+	s := &series[0]
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.book b
+		INNER JOIN %s.author a ON b.author_id = a.author_id
+		INNER JOIN %s.series_entry se ON se.book_id = b.book_id
+		WHERE se.series_id = $1 AND b.deleted_ts IS NULL
+		ORDER BY se.position, b.book_id
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := pg.scanBooks(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.Entries = make([]v1.SeriesEntry, len(books))
+
+	for i, b := range books {
+		s.Entries[i] = v1.SeriesEntry{Book: b}
+
+		if b.Series != nil {
+			s.Entries[i].Position = b.Series.Position
+		}
+	}
+
+	return s, nil
+}
+
+// Returns the series visible to the user, sorted by name. Entries are not
+// included.
+func (pg *PgDb) SeriesList() ([]v1.Series, error) {
+	return pg.seriesQuery(nil, nil)
+}
+
+// Removes a series. Its books are kept.
+func (pg *PgDb) SeriesRemove(id int) error {
+	s, err := pg.SeriesGet(id)
+
+	if err != nil {
+		return err
+	}
+
+	if s == nil {
+		return db.NotFound("series not found")
+	}
+
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.series s
+		WHERE s.series_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Puts a book at position in a series. A book is in at most one series,
+// so this moves it from any other series.
+func (pg *PgDb) SeriesSetBook(seriesId int, bookId int, position float64) error {
+	series, err := pg.seriesQuery([]string{" s.series_id = $1 "}, []interface{}{seriesId})
+
+	if err != nil {
+		return err
+	}
+
+	if len(series) < 1 {
+		return db.NotFound("series not found")
+	}
+
+	book, err := pg.BookGet(bookId)
+
+	if err != nil {
+		return err
+	}
+
+	if book == nil {
+		return db.NotFound("book not found")
+	}
+
+	if book.OwnerId != series[0].OwnerId {
+		return errors.New("book and series have different owners")
+	}
+
+	if position < 0 {
+		return errors.New("position must not be negative")
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.series_entry (book_id, series_id, position)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (book_id) DO UPDATE SET
+			series_id = EXCLUDED.series_id,
+			position = EXCLUDED.position
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, bookId, seriesId, position)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Takes a book out of a series.
+func (pg *PgDb) SeriesRemoveBook(seriesId int, bookId int) error {
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.series_entry se
+		USING %s.series s
+		WHERE se.series_id = s.series_id AND se.series_id = $1 AND se.book_id = $2
+	`, pg.SchemaVersion, pg.SchemaVersion)
+
+	values := []interface{}{seriesId, bookId}
+
+	if pg.isScoped() {
+		queryStr += " AND s.owner_id = $3 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" RETURNING se.book_id ", values...)
+
+	if err != nil {
+		return err
+	}
+
+	removed, err := ScanReturnedId(rows)
+
+	if err != nil {
+		return err
+	}
+
+	if removed == nil {
+		return errors.New("book is not in the series")
+	}
+
+	return nil
+}
+
+// Returns the first book in series order the current user hasn't finished
+// or abandoned, or nil if there is none.
+func (pg *PgDb) SeriesNextUnread(id int) (*v1.Book, error) {
+	series, err := pg.seriesQuery([]string{" s.series_id = $1 "}, []interface{}{id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(series) < 1 {
+		return nil, db.NotFound("series not found")
+	}
+
+	userId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.book b
+		INNER JOIN %s.author a ON b.author_id = a.author_id
+		INNER JOIN %s.series_entry se ON se.book_id = b.book_id
+		LEFT JOIN %s.reading_state r ON r.book_id = b.book_id AND r.user_id = $2
+		WHERE se.series_id = $1 AND b.deleted_ts IS NULL
+			AND (r.status IS NULL OR r.status NOT IN ('finished', 'abandoned'))
+		ORDER BY se.position, b.book_id
+		LIMIT 1
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := pg.scanBooks(rows)
+
+	if err != nil || len(books) < 1 {
+		return nil, err
+	}
+
+	return &books[0], nil
+}
+
+// Sets the series block of books. Expects index to map book ids to their
+// index in books.
+func (pg *PgDb) loadBookSeries(books []v1.Book, index map[int]int) error {
+	bookIds := make([]int, 0, len(books))
+	for _, b := range books {
+		bookIds = append(bookIds, b.BookId)
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT se.book_id, s.series_id, s.name, se.position
+		FROM %s.series_entry se
+		INNER JOIN %s.series s ON s.series_id = se.series_id
+		WHERE se.book_id = ANY($1)
+	`, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, pq.Array(bookIds))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookId int
+		series := &v1.BookSeries{}
+
+		err := rows.Scan(&bookId, &series.SeriesId, &series.Name, &series.Position)
+
+		if err != nil {
+			return err
+		}
+
+		books[index[bookId]].Series = series
+	}
+
+	return rows.Err()
+}
+
+// Selects series matching wheres, adding the member scope.
+func (pg *PgDb) seriesQuery(wheres []string, values []interface{}) ([]v1.Series, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.series s
+	`, seriesColumns, pg.SchemaVersion)
+
+	if pg.isScoped() {
+		values = append(values, pg.User.UserId)
+		wheres = append(wheres, " s.owner_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if len(wheres) > 0 {
+		queryStr += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY s.name ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedSeries(rows)
+}
@@ -0,0 +1,376 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Returns the current user's books and collections in the trash, newest
+// first. Admins see only their own too, as TrashPurge purges only theirs.
+func (pg *PgDb) TrashList() (*v1.Trash, error) {
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.book b
+		INNER JOIN %s.author a ON b.author_id = a.author_id
+		WHERE b.owner_id = $1 AND b.deleted_ts IS NOT NULL
+		ORDER BY b.deleted_ts DESC, b.book_id DESC
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := pg.scanBooks(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr = fmt.Sprintf(`
+		SELECT %s FROM %s.collection c
+		WHERE c.owner_id = $1 AND c.deleted_ts IS NOT NULL
+		ORDER BY c.deleted_ts DESC, c.title
+	`, collectionColumns, pg.SchemaVersion)
+
+	rows, err = pg.conn().Query(queryStr, ownerId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := ScanReturnedCollections(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	trash := &v1.Trash{Books: books, Collections: collections}
+
+	if trash.Books == nil {
+		trash.Books = []v1.Book{}
+	}
+
+	if trash.Collections == nil {
+		trash.Collections = []v1.Collection{}
+	}
+
+	return trash, nil
+}
+
+// Takes a book out of the trash, back into the collections it was in.
+// Members may only restore their own books.
+func (pg *PgDb) TrashRestoreBook(id int) error {
+	return pg.inTx(func(tx *PgDb) error {
+		book, err := tx.trashedBookGet(id)
+
+		if err != nil {
+			return err
+		}
+
+		if book == nil {
+			return db.NotFound("book not found in the trash")
+		}
+
+		queryStr := fmt.Sprintf(`
+			UPDATE %s.book b SET deleted_ts = NULL
+			WHERE b.book_id = $1
+		`, tx.SchemaVersion)
+
+		_, err = tx.conn().Exec(queryStr, id)
+
+		if isUniqueViolationOf(err, bookIdentityIndex) {
+			return db.Conflict(bookIdentityConflict)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return tx.auditBook(v1.AuditActionRestore, id, book)
+	})
+}
+
+// Returns the book in the trash with the given id, or nil if there is
+// none. Members may only read their own books.
+func (pg *PgDb) trashedBookGet(id int) (*v1.Book, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s
+		FROM %s.book b
+		INNER JOIN %s.author a ON b.author_id = a.author_id
+		WHERE b.book_id = $1 AND b.deleted_ts IS NOT NULL
+	`, bookColumns, pg.SchemaVersion, pg.SchemaVersion)
+
+	values := []interface{}{id}
+
+	if pg.isScoped() {
+		queryStr += " AND b.owner_id = $2 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr, values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := pg.scanBooks(rows)
+
+	if err != nil || len(books) < 1 {
+		return nil, err
+	}
+
+	// As BookGet reads it, so a restore only changes deletedTs
+	books[0].Loan, err = pg.activeLoan(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &books[0], nil
+}
+
+// Takes one of the current user's collections out of the trash with its
+// books. It goes back under its parent if the parent is still there, and
+// becomes a root collection otherwise.
+func (pg *PgDb) TrashRestoreCollection(id int) error {
+	ownerId, err := pg.ownerId()
+
+	if err != nil {
+		return err
+	}
+
+	return pg.inTx(func(tx *PgDb) error {
+		before, err := tx.collectionSnapshot(ownerId, func() (*v1.Collection, error) {
+			return tx.trashedCollectionGet(ownerId, id)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if before == nil {
+			return db.NotFound("collection not found in the trash")
+		}
+
+		queryStr := fmt.Sprintf(`
+			UPDATE %[1]s.collection c
+			SET deleted_ts = NULL,
+				parent_title = CASE WHEN EXISTS (
+					SELECT 1 FROM %[1]s.collection p
+					WHERE p.owner_id = c.owner_id AND p.title = c.parent_title
+						AND p.deleted_ts IS NULL
+				) THEN c.parent_title END
+			WHERE c.owner_id = $1 AND c.collection_id = $2 AND c.deleted_ts IS NOT NULL
+		`, tx.SchemaVersion)
+
+		_, err = tx.conn().Exec(queryStr, ownerId, id)
+
+		if err != nil {
+			return err
+		}
+
+		after, err := tx.collectionSnapshot(ownerId, func() (*v1.Collection, error) {
+			return tx.collectionGetById(ownerId, id)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(v1.AuditEntityCollection, id, &ownerId, v1.AuditActionRestore, before, after)
+	})
+}
+
+// Returns the owner's collection in the trash with the given id, without
+// its books. Returns nil, nil if not found.
+func (pg *PgDb) trashedCollectionGet(ownerId int, id int) (*v1.Collection, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.collection c
+		WHERE c.owner_id = $1 AND c.collection_id = $2 AND c.deleted_ts IS NOT NULL
+	`, collectionColumns, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := ScanReturnedCollections(rows)
+
+	if err != nil || len(collections) < 1 {
+		return nil, err
+	}
+
+	return &collections[0], nil
+}
+
+// Deletes for good the books and collections trashed before the given
+// time, or everything in the trash if before is nil. Users, admins
+// included, purge their own trash, as listed by TrashList; only unscoped
+// queriers, e.g. the background purge, purge everyone's. Each purged book
+// and collection gets a purge audit entry with its last state, made by no
+// one for unscoped queriers.
+func (pg *PgDb) TrashPurge(before *time.Time) (*v1.TrashPurgeReport, error) {
+	report := &v1.TrashPurgeReport{}
+
+	err := pg.inTx(func(tx *PgDb) error {
+		where := " WHERE t.deleted_ts IS NOT NULL "
+		values := []interface{}{}
+
+		if before != nil {
+			values = append(values, *before)
+			where += fmt.Sprintf(" AND t.deleted_ts < $%d ", len(values))
+		}
+
+		if tx.User != nil {
+			values = append(values, tx.User.UserId)
+			where += fmt.Sprintf(" AND t.owner_id = $%d ", len(values))
+		}
+
+		collections, books, err := tx.trashSnapshot(where, values)
+
+		if err != nil {
+			return err
+		}
+
+		// Collections left under a purged one become root collections
+		queryStr := fmt.Sprintf(`
+			UPDATE %[1]s.collection c SET parent_title = NULL
+			FROM %[1]s.collection t
+		`, tx.SchemaVersion) + where + `
+			AND c.owner_id = t.owner_id AND c.parent_title = t.title
+		`
+
+		_, err = tx.conn().Exec(queryStr, values...)
+
+		if err != nil {
+			return err
+		}
+
+		queryStr = fmt.Sprintf(`
+			DELETE FROM %s.collection t
+		`, tx.SchemaVersion) + where + " RETURNING t.collection_id "
+
+		rows, err := tx.conn().Query(queryStr, values...)
+
+		if err != nil {
+			return err
+		}
+
+		collectionIds, err := ScanReturnedIds(rows)
+
+		if err != nil {
+			return err
+		}
+
+		report.Collections = len(collectionIds)
+
+		queryStr = fmt.Sprintf(`
+			DELETE FROM %s.book t
+		`, tx.SchemaVersion) + where + " RETURNING t.work_id "
+
+		rows, err = tx.conn().Query(queryStr, values...)
+
+		if err != nil {
+			return err
+		}
+
+		workIds, err := ScanReturnedIds(rows)
+
+		if err != nil {
+			return err
+		}
+
+		report.Books = len(workIds)
+
+		for _, workId := range workIds {
+			if err := tx.workRemoveIfEmpty(workId); err != nil {
+				return err
+			}
+		}
+
+		for i := range collections {
+			c := &collections[i]
+
+			if err := tx.audit(v1.AuditEntityCollection, c.CollectionId, &c.OwnerId, v1.AuditActionPurge, c, nil); err != nil {
+				return err
+			}
+		}
+
+		for i := range books {
+			b := &books[i]
+
+			if err := tx.audit(v1.AuditEntityBook, b.BookId, &b.OwnerId, v1.AuditActionPurge, b, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Returns the trashed collections, with their entries, and books that a
+// purge with the given where clause on t deletes, for the audit log.
+func (pg *PgDb) trashSnapshot(where string, values []interface{}) ([]v1.Collection, []v1.Book, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %[2]s FROM %[1]s.collection c
+		WHERE c.collection_id IN (SELECT t.collection_id FROM %[1]s.collection t `, pg.SchemaVersion, collectionColumns) + where + ")"
+
+	rows, err := pg.conn().Query(queryStr, values...)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collections, err := ScanReturnedCollections(rows)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range collections {
+		c := &collections[i]
+
+		if c.Smart {
+			continue
+		}
+
+		c.Entries, err = pg.collectionEntries(c.OwnerId, c.Title)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	queryStr = fmt.Sprintf(`
+		SELECT %[2]s FROM %[1]s.book b
+		INNER JOIN %[1]s.author a ON b.author_id = a.author_id
+		WHERE b.book_id IN (SELECT t.book_id FROM %[1]s.book t `, pg.SchemaVersion, bookColumns) + where + ")"
+
+	rows, err = pg.conn().Query(queryStr, values...)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	books, err := pg.scanBooks(rows)
+
+	return collections, books, err
+}
@@ -0,0 +1,255 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
+)
+
+// Returns the current user's last count changes to books and collections,
+// newest first, as Undo would reverse them. Changes already undone, those
+// made by an undo, merges and purges are left out.
+func (pg *PgDb) UndoList(count int) ([]v1.AuditEntry, error) {
+	if count < 1 {
+		return nil, errors.New("count must be a positive integer")
+	}
+
+	actorId, err := pg.ownerId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT a.audit_id, a.created_ts, a.actor_id, a.actor, a.owner_id,
+			a.entity, a.entity_id, a.action, a.before, a.after, a.undo_of
+		FROM %[1]s.audit_log a
+		WHERE a.actor_id = $1 AND a.entity IN ($2, $3) AND a.undo_of IS NULL
+			AND a.action NOT IN ($4, $5)
+			AND NOT EXISTS (SELECT 1 FROM %[1]s.audit_log u WHERE u.undo_of = a.audit_id)
+		ORDER BY a.created_ts DESC, a.audit_id DESC
+		LIMIT $6
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, actorId, v1.AuditEntityBook, v1.AuditEntityCollection,
+		v1.AuditActionMerge, v1.AuditActionPurge, count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedAuditEntries(rows)
+}
+
+// Reverses the changes with the given audit ids, which must be the current
+// user's last changes to books and collections as UndoList lists them,
+// newest first. If they no longer are, e.g. because a change was made
+// since they were listed, nothing is undone and a conflict is returned.
+// The changes are undone in one transaction: either all are or none are.
+// Removals are restored from the trash, and creates and restores moved to
+// it; collection updates are set back to their earlier state. Book
+// updates, and books or collections purged since, can't be undone. Merges
+// aren't listed; the merged away book is restored from the trash instead. Returns
+// the entries undone.
+func (pg *PgDb) Undo(auditIds []int) ([]v1.AuditEntry, error) {
+	if len(auditIds) < 1 {
+		return nil, errors.New("auditIds are required")
+	}
+
+	var entries []v1.AuditEntry
+
+	err := pg.inTx(func(tx *PgDb) error {
+		var err error
+		entries, err = tx.UndoList(len(auditIds))
+
+		if err != nil {
+			return err
+		}
+
+		if len(entries) != len(auditIds) {
+			return db.Conflict("the changes to undo have changed, list them again")
+		}
+
+		for i := range entries {
+			if entries[i].AuditId != auditIds[i] {
+				return db.Conflict("the changes to undo have changed, list them again")
+			}
+		}
+
+		for i := range entries {
+			e := &entries[i]
+
+			undo := *tx
+			undo.undoOf = &e.AuditId
+
+			if err := undo.undoEntry(e); err != nil {
+				return fmt.Errorf("can't undo %s of %s %d: %w", e.Action, e.Entity, e.EntityId, err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Reverses one audit log entry, recording the reversal against it.
+func (pg *PgDb) undoEntry(e *v1.AuditEntry) error {
+	switch e.Entity {
+	case v1.AuditEntityBook:
+		switch e.Action {
+		case v1.AuditActionCreate, v1.AuditActionRestore:
+			return pg.BookRemove(e.EntityId)
+		case v1.AuditActionDelete:
+			return pg.TrashRestoreBook(e.EntityId)
+		}
+
+		return errors.New("book updates can't be undone")
+	case v1.AuditEntityCollection:
+		if e.Action == v1.AuditActionDelete {
+			return pg.TrashRestoreCollection(e.EntityId)
+		}
+
+		ownerId, err := pg.ownerId()
+
+		if err != nil {
+			return err
+		}
+
+		current, err := pg.collectionGetById(ownerId, e.EntityId)
+
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			return db.NotFound("collection not found")
+		}
+
+		if e.Action == v1.AuditActionCreate || e.Action == v1.AuditActionRestore {
+			return pg.CollectionRemove(&current.Title)
+		}
+
+		before := &v1.Collection{}
+
+		if err := json.Unmarshal(e.Before, before); err != nil {
+			return err
+		}
+
+		return pg.auditCollection(&current.Title, func(tx *PgDb) error {
+			return tx.collectionRevert(ownerId, e.EntityId, before)
+		})
+	}
+
+	return errors.New("only book and collection changes can be undone")
+}
+
+// Sets the owner's collection with the given id back to an earlier
+// snapshot: its title, metadata, parent and, for manual collections,
+// entries. Books purged since are left out and books in the trash keep
+// their place. A parent that is gone makes it a root collection.
+func (pg *PgDb) collectionRevert(ownerId int, id int, to *v1.Collection) error {
+	slug, err := pg.collectionSlug(ownerId, &to.Title, id)
+
+	if err != nil {
+		return err
+	}
+
+	var filter *string
+
+	if to.Filter != nil {
+		filterJson, err := json.Marshal(to.Filter)
+
+		if err != nil {
+			return err
+		}
+
+		filterStr := string(filterJson)
+		filter = &filterStr
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.collection c
+		SET title = $3, slug = $4, description = $5, cover_url = $6, public = $7, filter = $8
+		WHERE c.owner_id = $1 AND c.collection_id = $2 AND c.deleted_ts IS NULL
+	`, pg.SchemaVersion)
+
+	_, err = pg.conn().Exec(queryStr, ownerId, id, to.Title, slug, to.Description, to.CoverUrl, to.Public, filter)
+
+	if isUniqueViolation(err) {
+		return db.Conflict("a collection with this title already exists")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	parent := to.Parent
+
+	if parent != nil {
+		live, err := pg.collectionGetByTitle(ownerId, *parent)
+
+		if err != nil {
+			return err
+		}
+
+		if live == nil {
+			parent = nil
+		}
+	}
+
+	if err := pg.collectionSetParent(&to.Title, parent); err != nil {
+		return err
+	}
+
+	if to.Smart {
+		return nil
+	}
+
+	queryStr = fmt.Sprintf(`
+		DELETE FROM %[1]s.collection_books cb
+		USING %[1]s.book b
+		WHERE cb.book_id = b.book_id AND cb.owner_id = $1 AND cb.title = $2
+			AND b.deleted_ts IS NULL
+	`, pg.SchemaVersion)
+
+	_, err = pg.conn().Exec(queryStr, ownerId, to.Title)
+
+	if err != nil {
+		return err
+	}
+
+	bookIds := make([]int, len(to.Entries))
+	positions := make([]int, len(to.Entries))
+	notes := make([]sql.NullString, len(to.Entries))
+
+	for i, entry := range to.Entries {
+		bookIds[i], positions[i] = entry.BookId, entry.Position
+
+		if entry.Note != nil {
+			notes[i] = sql.NullString{String: *entry.Note, Valid: true}
+		}
+	}
+
+	queryStr = fmt.Sprintf(`
+		INSERT INTO %[1]s.collection_books (owner_id, title, book_id, position, note)
+		SELECT $1, $2, e.book_id, e.position, e.note
+		FROM unnest($3::int[], $4::int[], $5::text[]) AS e(book_id, position, note)
+		INNER JOIN %[1]s.book b ON b.book_id = e.book_id
+		WHERE b.deleted_ts IS NULL
+		ON CONFLICT DO NOTHING
+	`, pg.SchemaVersion)
+
+	_, err = pg.conn().Exec(queryStr, ownerId, to.Title, pq.Array(bookIds), pq.Array(positions), pq.Array(notes))
+
+	return err
+}
@@ -0,0 +1,108 @@
+package postgresql
+
+import (
+	"fmt"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	_ "github.com/lib/pq"
+)
+
+// Creates a new user. Only admins (or unscoped queriers) may create users.
+// Returns the user_id generated.
+func (pg *PgDb) UserCreate(u *v1.User) (*int, error) {
+	if u == nil {
+		return nil, nil
+	}
+
+	if err := pg.requireAdmin(); err != nil {
+		return nil, err
+	}
+
+	role := u.Role
+	if role == "" {
+		role = v1.UserRoleMember
+	}
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.app_user (username, role)
+		VALUES ($1, $2)
+		RETURNING user_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, u.Username, role)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Returns a user by id. Returns nil, nil if no user found.
+func (pg *PgDb) UserGet(id int) (*v1.User, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT u.user_id, u.created_ts, u.username, u.role
+		FROM %s.app_user u
+		WHERE u.user_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return firstUser(ScanReturnedUsers(rows))
+}
+
+// Returns a user by username. Returns nil, nil if no user found.
+func (pg *PgDb) UserGetByName(username string) (*v1.User, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT u.user_id, u.created_ts, u.username, u.role
+		FROM %s.app_user u
+		WHERE u.username = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return firstUser(ScanReturnedUsers(rows))
+}
+
+// Returns all users. Members only see themselves.
+func (pg *PgDb) UserList() ([]v1.User, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT u.user_id, u.created_ts, u.username, u.role
+		FROM %s.app_user u
+	`, pg.SchemaVersion)
+
+	values := make([]interface{}, 0)
+
+	if pg.isScoped() {
+		queryStr += " WHERE u.user_id = $1 "
+		values = append(values, pg.User.UserId)
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY u.user_id ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedUsers(rows)
+}
+
+func firstUser(users []v1.User, err error) (*v1.User, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) < 1 {
+		return nil, nil
+	}
+
+	return &users[0], nil
+}
@@ -2,16 +2,109 @@ package postgresql
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 
 	db "github.com/Max-Clark/goshelf/cmd/db"
+	"github.com/Max-Clark/goshelf/cmd/isbn"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/lib/pq"
 )
 
+// The book and author columns read by ScanReturnedBooks. Expects the book
+// table aliased as b and the author table aliased as a.
+const bookColumns = `b.book_id, b.created_ts, b.owner_id, b.title, b.publish_date, b.edition, b.description,
+		b.genre, b.isbn13, b.work_id, b.language, b.translation_of, b.deleted_ts,
+		a.author_id, a.created_ts, a.first_name, a.last_name`
+
+// The collection columns read by ScanReturnedCollections. Expects the
+// collection table aliased as c.
+const collectionColumns = `c.collection_id, c.owner_id, c.title, c.slug, c.created_ts, c.public,
+		c.description, c.cover_url, c.filter, c.parent_title, c.deleted_ts`
+
 // The struct for PgDb that
 type PgDb struct {
 	SqlDb         *sql.DB
 	SchemaVersion string // Used for migrations
 	Config        db.ConnectionConfig
+	User          *v1.User // Set by AsUser, nil for unscoped (e.g., system) access
+	tx            *sql.Tx  // Set by inTx, nil outside a transaction
+	undoOf        *int     // Set by Undo, the audit entry being reversed
+}
+
+// The queries shared by *sql.DB and *sql.Tx.
+type sqlConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Returns the transaction pg is running in, or the connection pool.
+func (pg *PgDb) conn() sqlConn {
+	if pg.tx != nil {
+		return pg.tx
+	}
+
+	return pg.SqlDb
+}
+
+// Runs fn with a copy of pg whose queries all go through one transaction,
+// committed if fn returns nil and rolled back otherwise. Inside a
+// transaction, fn joins it instead. Rows must be closed before the next
+// query as they share the one connection.
+func (pg *PgDb) inTx(fn func(tx *PgDb) error) error {
+	if pg.tx != nil {
+		return fn(pg)
+	}
+
+	tx, err := pg.SqlDb.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	// Does nothing once committed
+	defer tx.Rollback()
+
+	inTx := *pg
+	inTx.tx = tx
+
+	if err := fn(&inTx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns a copy of pg acting as the given user. The copy shares the
+// connection pool, so it is cheap to create per request.
+func (pg *PgDb) AsUser(u *v1.User) db.GoshelfQuerier {
+	scoped := *pg
+	scoped.User = u
+	return &scoped
+}
+
+// Returns true if queries should be restricted to rows owned by pg.User.
+// Unscoped and admin queriers see all rows.
+func (pg *PgDb) isScoped() bool {
+	return pg.User != nil && !pg.User.IsAdmin()
+}
+
+// Returns an error unless the querier is unscoped or acting as an admin.
+func (pg *PgDb) requireAdmin() error {
+	if pg.isScoped() {
+		return errors.New("admin role required")
+	}
+
+	return nil
+}
+
+// Returns the id of the user new rows should belong to.
+func (pg *PgDb) ownerId() (int, error) {
+	if pg.User == nil {
+		return 0, errors.New("no user set")
+	}
+
+	return pg.User.UserId, nil
 }
 
 // Scans rows for one row expecting one integer parameter.
@@ -26,25 +119,113 @@ func ScanReturnedCollections(rows *sql.Rows) ([]v1.Collection, error) {
 	// Close the connection once we're done
 	defer rows.Close()
 
-	collection := &v1.Collection{}
-
 	for rows.Next() {
+		collection := &v1.Collection{}
+		var filter []byte
 
 		err := rows.Scan(
+			&collection.CollectionId,
+			&collection.OwnerId,
 			&collection.Title,
+			&collection.Slug,
 			&collection.CreatedTs,
+			&collection.Public,
+			&collection.Description,
+			&collection.CoverUrl,
+			&filter,
+			&collection.Parent,
+			&collection.DeletedTs,
 		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		// Smart collections have a filter in place of members
+		if filter != nil {
+			collection.Smart = true
+			collection.Filter = &v1.BookFilter{}
+
+			if err := json.Unmarshal(filter, collection.Filter); err != nil {
+				return nil, err
+			}
+		}
+
 		collections = append(collections, *collection)
 	}
 
 	return collections, nil
 }
 
+// Scans rows of collection entries (book_id, position, note).
+// Returns nil, nil for nil rows pointer.
+func ScanReturnedCollectionEntries(rows *sql.Rows) ([]v1.CollectionEntry, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	entries := make([]v1.CollectionEntry, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := v1.CollectionEntry{}
+
+		err := rows.Scan(&entry.BookId, &entry.Position, &entry.Note)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Returns the audit log entries returned by rows. Returns an empty array if
+// no rows returned.
+func ScanReturnedAuditEntries(rows *sql.Rows) ([]v1.AuditEntry, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	entries := make([]v1.AuditEntry, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := v1.AuditEntry{}
+		var before, after []byte
+
+		err := rows.Scan(
+			&entry.AuditId,
+			&entry.CreatedTs,
+			&entry.ActorId,
+			&entry.Actor,
+			&entry.OwnerId,
+			&entry.Entity,
+			&entry.EntityId,
+			&entry.Action,
+			&before,
+			&after,
+			&entry.UndoOf,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Before, entry.After = before, after
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
 // Scans rows for one row expecting one integer parameter.
 // Returns nil, nil for no rows returned or nil rows pointer.
 func ScanReturnedId(rows *sql.Rows) (*int, error) {
@@ -70,6 +251,56 @@ func ScanReturnedId(rows *sql.Rows) (*int, error) {
 	return &id, nil
 }
 
+// Scans rows expecting one text column per row.
+// Returns nil, nil for nil rows pointer.
+func ScanReturnedStrings(rows *sql.Rows) ([]string, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	values := make([]string, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+		value := ""
+
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// Scans rows expecting one integer column per row.
+// Returns nil, nil for nil rows pointer.
+func ScanReturnedIds(rows *sql.Rows) ([]int, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	values := make([]int, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+		value := 0
+
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
 // Returns a series of books returned by rows. Returns an empty array
 // if no rows returned.
 func ScanReturnedBooks(rows *sql.Rows) ([]v1.Book, error) {
@@ -88,11 +319,17 @@ func ScanReturnedBooks(rows *sql.Rows) ([]v1.Book, error) {
 		err := rows.Scan(
 			&book.BookId,
 			&book.CreatedTs,
+			&book.OwnerId,
 			&book.Title,
 			&book.PublishDate,
 			&book.Edition,
 			&book.Description,
 			&book.Genre,
+			&book.Isbn13,
+			&book.WorkId,
+			&book.Language,
+			&book.TranslationOf,
+			&book.DeletedTs,
 			&book.Author.AuthorId,
 			&book.Author.CreatedTs,
 			&book.Author.FirstName,
@@ -103,8 +340,474 @@ func ScanReturnedBooks(rows *sql.Rows) ([]v1.Book, error) {
 			return nil, err
 		}
 
+		if book.Isbn13 != nil {
+			if isbn10, ok := isbn.To10(*book.Isbn13); ok {
+				book.Isbn10 = &isbn10
+			}
+		}
+
 		books = append(books, *book)
 	}
 
 	return books, nil
 }
+
+// Returns a series of API keys returned by rows. Returns an empty array
+// if no rows returned.
+func ScanReturnedApiKeys(rows *sql.Rows) ([]v1.ApiKey, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	keys := make([]v1.ApiKey, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		key := &v1.ApiKey{}
+		err := rows.Scan(
+			&key.ApiKeyId,
+			&key.UserId,
+			&key.CreatedTs,
+			&key.Name,
+			&key.Prefix,
+			&key.Scope,
+			&key.RevokedTs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+// Returns a series of users returned by rows. Returns an empty array
+// if no rows returned.
+func ScanReturnedUsers(rows *sql.Rows) ([]v1.User, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	users := make([]v1.User, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		user := &v1.User{}
+		err := rows.Scan(
+			&user.UserId,
+			&user.CreatedTs,
+			&user.Username,
+			&user.Role,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *user)
+	}
+
+	return users, nil
+}
+
+// Returns a series of collection shares returned by rows. Returns an empty
+// array if no rows returned.
+func ScanReturnedCollectionShares(rows *sql.Rows) ([]v1.CollectionShare, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	shares := make([]v1.CollectionShare, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		share := &v1.CollectionShare{}
+		err := rows.Scan(
+			&share.ShareId,
+			&share.CreatedTs,
+			&share.Title,
+			&share.Prefix,
+			&share.ExpiresTs,
+			&share.RevokedTs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shares = append(shares, *share)
+	}
+
+	return shares, nil
+}
+
+// Returns true if err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Returns true if err is a violation of the named unique constraint or index.
+func isUniqueViolationOf(err error, constraint string) bool {
+	var pqErr *pq.Error
+
+	return isUniqueViolation(err) && errors.As(err, &pqErr) && pqErr.Constraint == constraint
+}
+
+// Returns a series of reading states returned by rows, without history.
+// Returns an empty array if no rows returned.
+func ScanReturnedReadingStates(rows *sql.Rows) ([]v1.ReadingState, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	states := make([]v1.ReadingState, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		state := &v1.ReadingState{History: make([]v1.ProgressUpdate, 0)}
+		err := rows.Scan(
+			&state.BookId,
+			&state.UserId,
+			&state.Status,
+			&state.StartedTs,
+			&state.FinishedTs,
+			&state.Page,
+			&state.Percent,
+			&state.UpdatedTs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, *state)
+	}
+
+	return states, nil
+}
+
+// Returns a series of progress updates returned by rows. Returns an empty
+// array if no rows returned.
+func ScanReturnedProgressUpdates(rows *sql.Rows) ([]v1.ProgressUpdate, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	updates := make([]v1.ProgressUpdate, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		update := &v1.ProgressUpdate{}
+		err := rows.Scan(
+			&update.ProgressId,
+			&update.CreatedTs,
+			&update.Status,
+			&update.Page,
+			&update.Percent,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		updates = append(updates, *update)
+	}
+
+	return updates, nil
+}
+
+// Returns a series of loans returned by rows. Returns an empty array if
+// no rows returned.
+func ScanReturnedLoans(rows *sql.Rows) ([]v1.Loan, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	loans := make([]v1.Loan, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		loan := &v1.Loan{}
+		err := rows.Scan(
+			&loan.LoanId,
+			&loan.BookId,
+			&loan.OwnerId,
+			&loan.Borrower,
+			&loan.LoanedTs,
+			&loan.DueTs,
+			&loan.ReturnedTs,
+			&loan.Note,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		loans = append(loans, *loan)
+	}
+
+	return loans, nil
+}
+
+// Returns a series of locations returned by rows, without paths. Returns
+// an empty array if no rows returned.
+func ScanReturnedLocations(rows *sql.Rows) ([]v1.Location, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	locs := make([]v1.Location, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		loc := &v1.Location{}
+		err := rows.Scan(
+			&loc.LocationId,
+			&loc.ParentId,
+			&loc.OwnerId,
+			&loc.CreatedTs,
+			&loc.Name,
+			&loc.Kind,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		locs = append(locs, *loc)
+	}
+
+	return locs, nil
+}
+
+// Returns a series of copies returned by rows, without location paths.
+// Returns an empty array if no rows returned.
+func ScanReturnedCopies(rows *sql.Rows) ([]v1.Copy, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	copies := make([]v1.Copy, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		bookCopy := &v1.Copy{}
+		err := rows.Scan(
+			&bookCopy.CopyId,
+			&bookCopy.BookId,
+			&bookCopy.OwnerId,
+			&bookCopy.CreatedTs,
+			&bookCopy.Condition,
+			&bookCopy.AcquiredTs,
+			&bookCopy.Price,
+			&bookCopy.LocationId,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, *bookCopy)
+	}
+
+	return copies, nil
+}
+
+// Returns a series of copy moves returned by rows. Returns an empty array
+// if no rows returned.
+func ScanReturnedCopyMoves(rows *sql.Rows) ([]v1.CopyMove, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	moves := make([]v1.CopyMove, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		move := &v1.CopyMove{}
+		err := rows.Scan(
+			&move.MoveId,
+			&move.MovedTs,
+			&move.FromLocationId,
+			&move.ToLocationId,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		moves = append(moves, *move)
+	}
+
+	return moves, nil
+}
+
+// Returns a series of series returned by rows, without entries. Returns an
+// empty array if no rows returned.
+func ScanReturnedSeries(rows *sql.Rows) ([]v1.Series, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	series := make([]v1.Series, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		s := &v1.Series{}
+		err := rows.Scan(
+			&s.SeriesId,
+			&s.OwnerId,
+			&s.CreatedTs,
+			&s.Name,
+			&s.Description,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		series = append(series, *s)
+	}
+
+	return series, nil
+}
+
+// Returns a series of reviews returned by rows. Returns an empty array if
+// no rows returned.
+func ScanReturnedReviews(rows *sql.Rows) ([]v1.Review, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	reviews := make([]v1.Review, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		review := &v1.Review{}
+		err := rows.Scan(
+			&review.BookId,
+			&review.UserId,
+			&review.Username,
+			&review.Rating,
+			&review.Body,
+			&review.CreatedTs,
+			&review.UpdatedTs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, *review)
+	}
+
+	return reviews, nil
+}
+
+// Returns a series of notes returned by rows. Returns an empty array if
+// no rows returned.
+func ScanReturnedNotes(rows *sql.Rows) ([]v1.Note, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	notes := make([]v1.Note, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		note := &v1.Note{}
+		err := rows.Scan(
+			&note.NoteId,
+			&note.BookId,
+			&note.UserId,
+			&note.Page,
+			&note.Highlight,
+			&note.Body,
+			&note.CreatedTs,
+			&note.UpdatedTs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, *note)
+	}
+
+	return notes, nil
+}
+
+// Returns a series of works returned by rows, without editions. Returns
+// an empty array if no rows returned.
+func ScanReturnedWorks(rows *sql.Rows) ([]v1.Work, error) {
+	if rows == nil {
+		return nil, nil
+	}
+
+	works := make([]v1.Work, 0)
+
+	// Close the connection once we're done
+	defer rows.Close()
+
+	for rows.Next() {
+
+		work := &v1.Work{}
+		err := rows.Scan(
+			&work.WorkId,
+			&work.OwnerId,
+			&work.CreatedTs,
+			&work.Title,
+			&work.OriginalLanguage,
+			&work.FirstPublished,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		works = append(works, *work)
+	}
+
+	return works, nil
+}
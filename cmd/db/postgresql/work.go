@@ -0,0 +1,202 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The work columns read by ScanReturnedWorks. Expects the work table
+// aliased as w.
+const workColumns = `w.work_id, w.owner_id, w.created_ts, w.title, w.original_language, w.first_published`
+
+// Returns a work with its editions, oldest first. Members may only read
+// their own works. Returns nil, nil if not found.
+func (pg *PgDb) WorkGet(id int) (*v1.Work, error) {
+	works, err := pg.workQuery([]string{" w.work_id = $1 "}, []interface{}{id})
+
+	if err != nil || len(works) < 1 {
+		return nil, err
+	}
+
+	work := &works[0]
+
+	work.Editions, err = pg.BookFilter(&v1.BookFilter{WorkId: &id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return work, nil
+}
+
+// Returns the works visible to the user, sorted by title. Editions are
+// not included.
+func (pg *PgDb) WorkList() ([]v1.Work, error) {
+	return pg.workQuery(nil, nil)
+}
+
+// Updates a work's title, original language and first publication date.
+func (pg *PgDb) WorkUpdate(w *v1.Work) error {
+	if w == nil {
+		return nil
+	}
+
+	title := strings.TrimSpace(w.Title)
+
+	if title == "" {
+		return errors.New("title is required")
+	}
+
+	if _, err := pg.workGet(w.WorkId); err != nil {
+		return err
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.work w
+		SET title = $2, original_language = $3, first_published = $4
+		WHERE w.work_id = $1
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, w.WorkId, title, w.OriginalLanguage, w.FirstPublished)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Makes a book an edition of a work. The book's previous work is removed
+// if it has no editions left.
+func (pg *PgDb) WorkSetBook(workId int, bookId int) error {
+	work, err := pg.workGet(workId)
+
+	if err != nil {
+		return err
+	}
+
+	book, err := pg.BookGet(bookId)
+
+	if err != nil {
+		return err
+	}
+
+	if book == nil {
+		return db.NotFound("book not found")
+	}
+
+	if book.OwnerId != work.OwnerId {
+		return errors.New("book and work have different owners")
+	}
+
+	if book.WorkId == workId {
+		return nil
+	}
+
+	queryStr := fmt.Sprintf(`
+		UPDATE %s.book b
+		SET work_id = $2
+		WHERE b.book_id = $1
+	`, pg.SchemaVersion)
+
+	return pg.inTx(func(tx *PgDb) error {
+		rows, err := tx.conn().Query(queryStr, bookId, workId)
+
+		if err != nil {
+			return err
+		}
+
+		rows.Close()
+
+		if err := tx.workRemoveIfEmpty(book.WorkId); err != nil {
+			return err
+		}
+
+		return tx.auditBook(v1.AuditActionUpdate, bookId, book)
+	})
+}
+
+// Creates the work for a new book without one, taking its title, language
+// and publish date from the book.
+func (pg *PgDb) workCreateFor(b *v1.Book, ownerId int) (*int, error) {
+	title, _, _ := strings.Cut(b.Title, ":")
+
+	queryStr := fmt.Sprintf(`
+		INSERT INTO %s.work (owner_id, title, original_language, first_published)
+		VALUES ($1, $2, $3, $4)
+		RETURNING work_id
+	`, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, ownerId, strings.TrimSpace(title), b.Language, b.PublishDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedId(rows)
+}
+
+// Removes a work once its last edition is gone.
+func (pg *PgDb) workRemoveIfEmpty(id int) error {
+	queryStr := fmt.Sprintf(`
+		DELETE FROM %s.work w
+		WHERE w.work_id = $1
+			AND NOT EXISTS (SELECT 1 FROM %s.book b WHERE b.work_id = w.work_id)
+	`, pg.SchemaVersion, pg.SchemaVersion)
+
+	rows, err := pg.conn().Query(queryStr, id)
+
+	if err != nil {
+		return err
+	}
+
+	rows.Close()
+
+	return nil
+}
+
+// Returns a work visible to the user without editions, or an error if not
+// found.
+func (pg *PgDb) workGet(id int) (*v1.Work, error) {
+	works, err := pg.workQuery([]string{" w.work_id = $1 "}, []interface{}{id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(works) < 1 {
+		return nil, db.NotFound("work not found")
+	}
+
+	return &works[0], nil
+}
+
+// Selects works matching wheres, adding the member scope.
+func (pg *PgDb) workQuery(wheres []string, values []interface{}) ([]v1.Work, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT %s FROM %s.work w
+	`, workColumns, pg.SchemaVersion)
+
+	if pg.isScoped() {
+		values = append(values, pg.User.UserId)
+		wheres = append(wheres, " w.owner_id = $"+fmt.Sprint(len(values))+" ")
+	}
+
+	if len(wheres) > 0 {
+		queryStr += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	rows, err := pg.conn().Query(queryStr+" ORDER BY w.title, w.work_id ", values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanReturnedWorks(rows)
+}
@@ -0,0 +1,221 @@
+// Package dedupe finds books that are likely duplicates of each other.
+//
+// Books are compared within the same owner and author. A pair is a likely duplicate
+// when the books share an ISBN, or their normalized titles are similar
+// enough and nothing tells them apart (a different ISBN, edition or
+// publication year).
+package dedupe
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// The title similarity at or above which books are reported
+const DefaultThreshold = 0.85
+
+// Why a pair was reported
+const (
+	ReasonIsbn  = "isbn"
+	ReasonTitle = "title"
+)
+
+// A likely duplicate. Keep is the older record, which a merge keeps.
+type Pair struct {
+	Keep       v1.Book `json:"keep"`
+	Drop       v1.Book `json:"drop"`
+	Similarity float64 `json:"similarity"` // Title similarity, 0 to 1
+	Reason     string  `json:"reason"`
+}
+
+// Returns the likely duplicates in books, most similar first. threshold
+// is the minimum title similarity, e.g. DefaultThreshold. Only books of
+// the same owner are paired, since only those can be merged.
+func Find(books []v1.Book, threshold float64) []Pair {
+	byOwner := map[int][]v1.Book{}
+
+	for _, b := range books {
+		byOwner[b.OwnerId] = append(byOwner[b.OwnerId], b)
+	}
+
+	pairs := []Pair{}
+	seen := map[[2]int]bool{}
+
+	add := func(a, b v1.Book, similarity float64, reason string) {
+		if a.BookId > b.BookId {
+			a, b = b, a
+		}
+
+		key := [2]int{a.BookId, b.BookId}
+
+		if seen[key] {
+			return
+		}
+
+		seen[key] = true
+		pairs = append(pairs, Pair{Keep: a, Drop: b, Similarity: similarity, Reason: reason})
+	}
+
+	for _, owned := range byOwner {
+		// The same ISBN is a duplicate whatever the author is recorded as
+		byIsbn := map[string]v1.Book{}
+
+		for _, b := range owned {
+			if b.Isbn13 == nil {
+				continue
+			}
+
+			if other, ok := byIsbn[*b.Isbn13]; ok {
+				add(other, b, Similarity(normalizeTitle(other.Title), normalizeTitle(b.Title)), ReasonIsbn)
+				continue
+			}
+
+			byIsbn[*b.Isbn13] = b
+		}
+
+		byAuthor := map[string][]v1.Book{}
+
+		for _, b := range owned {
+			key := normalize(b.Author.LastName)
+			byAuthor[key] = append(byAuthor[key], b)
+		}
+
+		for _, group := range byAuthor {
+			for i := range group {
+				for j := i + 1; j < len(group); j++ {
+					a, b := group[i], group[j]
+
+					if !sameAuthor(a.Author, b.Author) || distinct(&a, &b) {
+						continue
+					}
+
+					similarity := Similarity(normalizeTitle(a.Title), normalizeTitle(b.Title))
+
+					if similarity >= threshold {
+						add(a, b, similarity, ReasonTitle)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Similarity != pairs[j].Similarity {
+			return pairs[i].Similarity > pairs[j].Similarity
+		}
+
+		return pairs[i].Keep.BookId < pairs[j].Keep.BookId
+	})
+
+	return pairs
+}
+
+// Returns the similarity of a and b from 0 (nothing in common) to 1
+// (equal), based on their edit distance.
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
+
+// Returns true if a and b are known to be different books: different
+// ISBNs, editions or publication years.
+func distinct(a, b *v1.Book) bool {
+	if a.Isbn13 != nil && b.Isbn13 != nil && *a.Isbn13 != *b.Isbn13 {
+		return true
+	}
+
+	if a.Edition != nil && b.Edition != nil && *a.Edition != *b.Edition {
+		return true
+	}
+
+	if a.PublishDate != nil && b.PublishDate != nil && a.PublishDate.Year() != b.PublishDate.Year() {
+		return true
+	}
+
+	return false
+}
+
+// Returns true if the authors' last names match and their first names
+// match, or one is an initial of the other or missing.
+func sameAuthor(a, b v1.Author) bool {
+	if normalize(a.LastName) != normalize(b.LastName) {
+		return false
+	}
+
+	first, second := normalize(a.FirstName), normalize(b.FirstName)
+
+	if first == "" || second == "" || first == second {
+		return true
+	}
+
+	// "F" or "F H" matches "Frank"
+	return (len([]rune(first)) <= 3 || len([]rune(second)) <= 3) && []rune(first)[0] == []rune(second)[0]
+}
+
+// Lower-cases s and reduces it to words of letters and digits.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+
+		return ' '
+	}, s)
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Normalizes a title, dropping a leading article.
+func normalizeTitle(title string) string {
+	return v1.TrimArticle(normalize(title))
+}
@@ -0,0 +1,85 @@
+package dedupe
+
+import (
+	"time"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func book(id int, title string, first string, last string) v1.Book {
+	return v1.Book{BookId: id, Title: title, Author: v1.Author{FirstName: first, LastName: last}}
+}
+
+var _ = Describe("Dedupe", func() {
+	DescribeTable("Similarity",
+		func(a string, b string, expected float64) {
+			Expect(Similarity(a, b)).To(BeNumerically("~", expected, 0.01))
+		},
+		Entry("equal", "dune", "dune", 1.0),
+		Entry("one typo", "dune messiah", "dune mesiah", 0.92),
+		Entry("nothing in common", "abc", "xyz", 0.0),
+		Entry("both empty", "", "", 1.0),
+	)
+
+	Context("Find", func() {
+		It("should pair near-identical titles by the same author", func() {
+			pairs := Find([]v1.Book{
+				book(9, "The Left Hand of Darkness", "Ursula", "Le Guin"),
+				book(3, "Left Hand of Darkness", "U", "le guin"),
+				book(4, "The Dispossessed", "Ursula", "Le Guin"),
+			}, DefaultThreshold)
+
+			Expect(pairs).To(HaveLen(1))
+			Expect(pairs[0].Keep.BookId).To(Equal(3))
+			Expect(pairs[0].Drop.BookId).To(Equal(9))
+			Expect(pairs[0].Reason).To(Equal(ReasonTitle))
+		})
+
+		It("should not pair different authors or editions", func() {
+			first, second := 1, 2
+
+			a := book(1, "Collected Poems", "Sylvia", "Plath")
+			b := book(2, "Collected Poems", "Philip", "Larkin")
+			c := book(3, "Collected Poems", "Sylvia", "Plath")
+			a.Edition, c.Edition = &first, &second
+
+			Expect(Find([]v1.Book{a, b, c}, DefaultThreshold)).To(BeEmpty())
+		})
+
+		It("should not pair books published in different years", func() {
+			before := time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC)
+			after := time.Date(1984, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			a := book(1, "Dune", "Frank", "Herbert")
+			b := book(2, "Dune", "Frank", "Herbert")
+			a.PublishDate, b.PublishDate = &before, &after
+
+			Expect(Find([]v1.Book{a, b}, DefaultThreshold)).To(BeEmpty())
+		})
+
+		It("should pair books with the same ISBN whatever the title", func() {
+			isbn13 := "9780441172719"
+
+			a := book(1, "Dune", "Frank", "Herbert")
+			b := book(2, "Dune (Deluxe Edition)", "", "Herbert, Frank")
+			a.Isbn13, b.Isbn13 = &isbn13, &isbn13
+
+			pairs := Find([]v1.Book{a, b}, DefaultThreshold)
+			Expect(pairs).To(HaveLen(1))
+			Expect(pairs[0].Reason).To(Equal(ReasonIsbn))
+		})
+
+		It("should not pair books of different owners", func() {
+			isbn13 := "9780441172719"
+
+			a := book(1, "Dune", "Frank", "Herbert")
+			b := book(2, "Dune", "Frank", "Herbert")
+			a.Isbn13, b.Isbn13 = &isbn13, &isbn13
+			a.OwnerId, b.OwnerId = 1, 2
+
+			Expect(Find([]v1.Book{a, b}, DefaultThreshold)).To(BeEmpty())
+		})
+	})
+})
@@ -7,7 +7,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/bookcsv"
+	"github.com/Max-Clark/goshelf/cmd/dedupe"
+	"github.com/Max-Clark/goshelf/cmd/metadata"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 	"github.com/gorilla/mux"
 )
 
@@ -19,25 +25,48 @@ type PathFunction struct {
 const PathPrefix = `/api/` + SchemaVersion + "/"
 const BookPath = PathPrefix + `book/`
 const CollectionPath = PathPrefix + `collection/`
+const SharedPath = PathPrefix + `shared/`
+const UserPath = PathPrefix + `user/`
+const ApiKeyPath = PathPrefix + `apikey/`
+const LoanPath = PathPrefix + `loan/`
+const CopyPath = PathPrefix + `copy/`
+const LocationPath = PathPrefix + `location/`
+const SeriesPath = PathPrefix + `series/`
+const NotePath = PathPrefix + `note/`
+const WorkPath = PathPrefix + `work/`
+const ImportPath = PathPrefix + `import`
+const ExportPath = PathPrefix + `export`
+const AuditPath = PathPrefix + `audit`
+const TrashPath = PathPrefix + `trash`
+const UndoPath = PathPrefix + `undo`
+
+// Titles may be any URL-encoded text without a slash
+const collectionTitlePattern = "{title:[^/]+}"
 
 const applicationJsonContentType = "application/json"
+const textCsvContentType = "text/csv"
 
 const StatusFailure = "Failure"
 const StatusSuccess = "Success"
 const CodeFailure int = 400
 const CodeSuccess int = 200
+const CodeUnauthorized int = 401
+const CodeForbidden int = 403
+const CodeNotFound int = 404
+const CodeConflict int = 409
 
 type CollectionCreateApiStruct struct {
-	Title   string `json:"title"`
-	BookIds []int  `json:"bookIds"`
+	Title   string         `json:"title"`
+	BookIds []int          `json:"bookIds"`
+	Filter  *v1.BookFilter `json:"filter"` // Set for a smart collection
+	Parent  *string        `json:"parent"`
 }
 
 func ApiCollectionCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	err := checkContentType(applicationJsonContentType, r)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -46,8 +75,7 @@ func ApiCollectionCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Requ
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -57,36 +85,237 @@ func ApiCollectionCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Requ
 	err = json.Unmarshal(body, &col)
 
 	if err != nil {
-		errMsg := err.Error()
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if col.Filter != nil && len(col.BookIds) > 0 {
+		errMsg := "a smart collection can't have bookIds"
 		returnGoshelfErrorWithMessage(&errMsg, w, r)
 		return
 	}
 
-	_, err = cfg.Goshelf.CollectionCreate(&col.Title, col.BookIds)
+	if col.Filter != nil {
+		_, err = querier(cfg, r).CollectionCreateSmart(&col.Title, col.Filter)
+	} else {
+		_, err = querier(cfg, r).CollectionCreate(&col.Title, col.BookIds)
+	}
+
+	if err == nil && col.Parent != nil {
+		err = querier(cfg, r).CollectionSetParent(&col.Title, col.Parent)
+	}
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+type CollectionAddBooksApiStruct struct {
+	BookIds []int `json:"bookIds"`
+}
+
+func ApiCollectionAddBooks(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+	req := CollectionAddBooksApiStruct{}
+
+	err := readJsonBody(r, &req)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	err = querier(cfg, r).CollectionAddBooks(&title, req.BookIds)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Reorders a collection, e.g. {"bookIds": [3, 1, 2]}, listing every book
+// in the collection once.
+func ApiCollectionReorder(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+	req := CollectionAddBooksApiStruct{}
+
+	err := readJsonBody(r, &req)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	err = querier(cfg, r).CollectionReorder(&title, req.BookIds)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+type CollectionBookApiStruct struct {
+	Position *int `json:"position"`
+	// Raw so that a null note, which clears it, can be told from no note
+	Note json.RawMessage `json:"note"`
+}
+
+// Updates a book's membership of a collection, e.g. {"position": 2}
+// and/or {"note": "Read chapters 1-3"}. A null note clears it.
+func ApiCollectionUpdateBook(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+
+	// Should be guaranteed by the regex, but just in case
+	bookIdInt64, err := strconv.ParseInt(mux.Vars(r)["bookId"], 10, 32)
+	PanicErrorHandler(err)
+	bookId := int(bookIdInt64)
+
+	req := CollectionBookApiStruct{}
+
+	err = readJsonBody(r, &req)
 
 	if err != nil {
-		errMsg := err.Error()
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if req.Position == nil && req.Note == nil {
+		errMsg := "position or note is required"
 		returnGoshelfErrorWithMessage(&errMsg, w, r)
 		return
 	}
 
+	q := querier(cfg, r)
+
+	if req.Note != nil {
+		var note *string
+
+		if err := json.Unmarshal(req.Note, &note); err != nil {
+			errMsg := "note must be a string or null"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		err = q.CollectionSetNote(&title, bookId, note)
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+	}
+
+	if req.Position != nil {
+		err = q.CollectionMoveBook(&title, bookId, *req.Position)
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+	}
+
 	returnGoshelfSuccessWithNoObject(w, r)
 }
 
 func ApiCollectionGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 
 	title := mux.Vars(r)["title"]
-	col, err := cfg.Goshelf.CollectionGet(&title)
+
+	var col *v1.Collection
+	var err error
+
+	// Recursive reads include the books of nested collections
+	if r.URL.Query().Get("recursive") == "true" {
+		col, err = querier(cfg, r).CollectionGetRecursive(&title)
+	} else {
+		col, err = querier(cfg, r).CollectionGet(&title)
+	}
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
 	if col == nil {
 		errMsg := "not found"
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"collection": col,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists the user's collections without their books. The title query value
+// is a wildcard search. With tree=true, root collections are returned with
+// the collections under them nested in children.
+func ApiCollectionList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("tree") == "true" {
+		cols, err := querier(cfg, r).CollectionTree()
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+
+		ret := map[string]interface{}{
+			"collections": cols,
+		}
+
+		returnGoshelfSuccessWithObject(&ret, w, r)
+		return
+	}
+
+	var title *string
+
+	if titleQ := r.URL.Query().Get("title"); titleQ != "" {
+		title = &titleQ
+	}
+
+	cols, err := querier(cfg, r).CollectionList(title)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"collections": cols,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Renames a collection or updates its metadata, e.g.
+// {"title": "Sci-Fi", "description": "Space operas"}. The collection is
+// addressed by its id; omitted fields are left as they are.
+func ApiCollectionUpdate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	update := v1.CollectionUpdate{}
+
+	err = readJsonBody(r, &update)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	col, err := querier(cfg, r).CollectionUpdate(int(id), &update)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -100,11 +329,10 @@ func ApiCollectionGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request
 func ApiCollectionDelete(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	title := mux.Vars(r)["title"]
 
-	err := cfg.Goshelf.CollectionRemove(&title)
+	err := querier(cfg, r).CollectionRemove(&title)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -113,6 +341,49 @@ func ApiCollectionDelete(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Requ
 	returnGoshelfSuccessWithObject(&bookRet, w, r)
 }
 
+// Creates a book. With enrich=true, the book is instead returned with
+// missing fields filled in by the metadata provider, for the caller to
+// confirm and post again.
+func ApiBookCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	book := v1.Book{}
+
+	err := readJsonBody(r, &book)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if r.URL.Query().Get("enrich") == "true" {
+		err = metadata.Enrich(metadataProvider(cfg), &book)
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+
+		ret := map[string]interface{}{
+			"book": book,
+		}
+
+		returnGoshelfSuccessWithObject(&ret, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).BookCreate(&book)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"bookId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
 func ApiBookRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
@@ -121,11 +392,10 @@ func ApiBookRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	PanicErrorHandler(err)
 	id := int(idInt64)
 
-	err = cfg.Goshelf.BookRemove(id)
+	err = querier(cfg, r).BookRemove(id)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -142,11 +412,10 @@ func ApiBookGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	PanicErrorHandler(err)
 	id := int(idInt64)
 
-	book, err := cfg.Goshelf.BookGet(id)
+	book, err := querier(cfg, r).BookGet(id)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
@@ -157,66 +426,1703 @@ func ApiBookGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
 	returnGoshelfSuccessWithObject(&bookRet, w, r)
 }
 
-func ApiBookFilter(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
-	queries := r.URL.Query()
+type BookMergeApiStruct struct {
+	BookId *int `json:"bookId"`
+}
 
-	titleQ := queries.Get("title")
-	genreQ := queries.Get("genre")
-	editionQ := queries.Get("edition")
+// Merges the book in the body, e.g. {"bookId": 12}, into the book in the
+// path. The book in the body is removed.
+func ApiBookMerge(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
 
-	var title *string
-	var genre *string
-	var edition *int
+	merge := BookMergeApiStruct{}
 
-	if titleQ != "" {
-		title = &titleQ
+	err = readJsonBody(r, &merge)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
 	}
 
-	if genreQ != "" {
-		genre = &genreQ
+	if merge.BookId == nil {
+		errMsg := "bookId is required"
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		return
 	}
 
-	if editionQ != "" {
-		edInt64, err := strconv.ParseInt(editionQ, 10, 32)
+	err = querier(cfg, r).BookMerge(int(idInt64), *merge.BookId)
 
-		if err != nil {
-			errMsg := "edition is not an integer"
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Returns pairs of the user's books that are likely duplicates. The
+// optional threshold query sets the minimum title similarity, 0 to 1.
+func ApiBookDuplicates(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	threshold := dedupe.DefaultThreshold
+
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+
+		if err != nil || parsed < 0 || parsed > 1 {
+			errMsg := "threshold must be a number from 0 to 1"
 			returnGoshelfErrorWithMessage(&errMsg, w, r)
 			return
 		}
 
-		edInt := int(edInt64)
-		edition = &edInt
+		threshold = parsed
 	}
 
-	books, err := cfg.Goshelf.BookFilter(title, genre, edition)
+	books, err := querier(cfg, r).BookFilter(nil)
 
 	if err != nil {
-		errMsg := err.Error()
-		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		returnGoshelfError(err, w, r)
 		return
 	}
 
-	bookRet := map[string]interface{}{
-		"books": books,
+	ret := map[string]interface{}{
+		"duplicates": dedupe.Find(books, threshold),
 	}
 
-	returnGoshelfSuccessWithObject(&bookRet, w, r)
+	returnGoshelfSuccessWithObject(&ret, w, r)
 }
 
-func StartServer(cfg GoshelfConfig) {
-	r := mux.NewRouter()
+// Returns the user's reading state of a book with its history. Progress
+// is null if none has been recorded.
+func ApiBookProgressGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
 
-	for _, v := range getPathFunctions(&cfg) {
-		log.Println("Handling " + v.Path)
-		r.HandleFunc(v.Path, v.Function)
+	state, err := querier(cfg, r).BookProgressGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"progress": state,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Records a progress update, e.g. {"status": "reading", "page": 42}, and
+// returns the new reading state.
+func ApiBookProgressUpdate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	update := v1.ProgressUpdate{}
+
+	err = readJsonBody(r, &update)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	state, err := querier(cfg, r).BookProgressUpdate(int(idInt64), &update)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"progress": state,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Returns every user's review of a book.
+func ApiReviewList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	reviews, err := querier(cfg, r).ReviewList(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"reviews": reviews,
 	}
 
-	address := cfg.Host + ":" + fmt.Sprint(cfg.Port)
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Sets the user's review of a book, e.g. {"rating": 4.5, "body": "..."}.
+// Returns the saved review.
+func ApiReviewSet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	review := v1.Review{}
 
-	log.Println("Starting server on " + address)
+	err = readJsonBody(r, &review)
 
-	err := http.ListenAndServe(address, r)
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	review.BookId = int(idInt64)
+
+	saved, err := querier(cfg, r).ReviewSet(&review)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"review": saved,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiReviewRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).ReviewRemove(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Adds a note to a book, e.g. {"page": 12, "highlight": "...", "body": "..."}.
+func ApiNoteCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	note := v1.Note{}
+
+	err = readJsonBody(r, &note)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	note.BookId = int(idInt64)
+
+	id, err := querier(cfg, r).NoteCreate(&note)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"noteId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Returns the user's notes on a book.
+func ApiNoteList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	notes, err := querier(cfg, r).NoteList(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"notes": notes,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiNoteGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	note, err := querier(cfg, r).NoteGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if note == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"note": note,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Replaces a note's page, highlight and body.
+func ApiNoteUpdate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	note := v1.Note{}
+
+	err = readJsonBody(r, &note)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	note.NoteId = int(idInt64)
+
+	err = querier(cfg, r).NoteUpdate(&note)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+func ApiNoteRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).NoteRemove(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Returns the user's book with the ISBN-10 or ISBN-13 in the path.
+func ApiBookGetByIsbn(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	isbn := mux.Vars(r)["isbn"]
+
+	books, err := querier(cfg, r).BookFilter(&v1.BookFilter{Isbn: &isbn})
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if len(books) < 1 {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	bookRet := map[string]interface{}{
+		"book": books[0],
+	}
+
+	returnGoshelfSuccessWithObject(&bookRet, w, r)
+}
+
+func ApiBookFilter(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+
+	titleQ := queries.Get("title")
+	genreQ := queries.Get("genre")
+	editionQ := queries.Get("edition")
+
+	var title *string
+	var genre *string
+	var edition *int
+
+	if titleQ != "" {
+		title = &titleQ
+	}
+
+	if genreQ != "" {
+		genre = &genreQ
+	}
+
+	if editionQ != "" {
+		edInt64, err := strconv.ParseInt(editionQ, 10, 32)
+
+		if err != nil {
+			errMsg := "edition is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		edInt := int(edInt64)
+		edition = &edInt
+	}
+
+	filter := &v1.BookFilter{
+		Title:   title,
+		Genre:   genre,
+		Edition: edition,
+	}
+
+	if titleExactQ := queries.Get("titleExact"); titleExactQ != "" {
+		filter.TitleExact = &titleExactQ
+	}
+
+	if isbnQ := queries.Get("isbn"); isbnQ != "" {
+		filter.Isbn = &isbnQ
+	}
+
+	if statusQ := queries.Get("status"); statusQ != "" {
+		filter.Status = &statusQ
+	}
+
+	if workQ := queries.Get("workId"); workQ != "" {
+		workId, err := strconv.Atoi(workQ)
+
+		if err != nil {
+			errMsg := "workId is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		filter.WorkId = &workId
+	}
+
+	if sortQ := queries.Get("sort"); sortQ != "" {
+		filter.Sort = &sortQ
+	}
+
+	for key, field := range map[string]**time.Time{
+		"publishedBefore": &filter.PublishedBefore,
+		"publishedAfter":  &filter.PublishedAfter,
+	} {
+		dateQ := queries.Get(key)
+
+		if dateQ == "" {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", dateQ)
+
+		if err != nil {
+			errMsg := key + " must match YYYY-MM-dd"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		*field = &date
+	}
+
+	if seriesQ := queries.Get("seriesId"); seriesQ != "" {
+		seriesId, err := strconv.Atoi(seriesQ)
+
+		if err != nil {
+			errMsg := "seriesId is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		filter.SeriesId = &seriesId
+	}
+
+	books, err := querier(cfg, r).BookFilter(filter)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	bookRet := map[string]interface{}{
+		"books": books,
+	}
+
+	returnGoshelfSuccessWithObject(&bookRet, w, r)
+}
+
+type CollectionShareCreateApiStruct struct {
+	ExpiresTs *time.Time `json:"expiresTs,omitempty"`
+	// Set by clients that generate their own token; the token itself is
+	// never sent. When empty the server generates the token.
+	Prefix    string `json:"prefix,omitempty"`
+	TokenHash string `json:"tokenHash,omitempty"`
+}
+
+type ApiKeyCreateApiStruct struct {
+	Name   string `json:"name"`
+	Scope  string `json:"scope"`
+	UserId int    `json:"userId,omitempty"`
+	// Set by clients that generate their own key; the key itself is never
+	// sent. When empty the server generates the key.
+	Prefix  string `json:"prefix,omitempty"`
+	KeyHash string `json:"keyHash,omitempty"`
+}
+
+type CollectionSetPublicApiStruct struct {
+	Public bool `json:"public"`
+}
+
+func ApiCollectionShareCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+	share := CollectionShareCreateApiStruct{}
+
+	// The body is optional, an empty body creates a link without expiry
+	if r.ContentLength != 0 {
+		err := readJsonBody(r, &share)
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+	}
+
+	token, prefix, tokenHash := "", share.Prefix, share.TokenHash
+
+	if tokenHash == "" {
+		var err error
+		token, prefix, tokenHash, err = GenerateShareToken()
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+	}
+
+	id, err := querier(cfg, r).CollectionShareCreate(&title, prefix, tokenHash, share.ExpiresTs)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"shareId": id,
+	}
+
+	if token != "" {
+		ret["token"] = token
+		ret["url"] = ShareUrl(cfg, token)
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiCollectionShareList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+
+	shares, err := querier(cfg, r).CollectionShareList(&title)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"shares": shares,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiCollectionShareRevoke(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(vars["id"], 10, 32)
+	PanicErrorHandler(err)
+	id := int(idInt64)
+
+	err = querier(cfg, r).CollectionShareRevoke(id)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+type CollectionSetParentApiStruct struct {
+	Parent *string `json:"parent"`
+}
+
+// Moves a collection and everything under it, e.g. {"parent": "courses"}.
+// A null parent makes it a root collection.
+func ApiCollectionSetParent(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+	req := CollectionSetParentApiStruct{}
+
+	err := readJsonBody(r, &req)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	err = querier(cfg, r).CollectionSetParent(&title, req.Parent)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+func ApiCollectionSetPublic(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	title := mux.Vars(r)["title"]
+	public := CollectionSetPublicApiStruct{}
+
+	err := readJsonBody(r, &public)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	err = querier(cfg, r).CollectionSetPublic(&title, public.Public)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Serves the read-only view of a collection shared by token. Does not
+// require authentication.
+func ApiSharedGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	col, err := cfg.Goshelf.CollectionGetByShareToken(HashApiKey(token))
+
+	returnSharedCollection(col, err, w, r)
+}
+
+// Serves the read-only view of a public collection. Does not require
+// authentication.
+func ApiSharedPublicGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	col, err := cfg.Goshelf.CollectionGetPublic(vars["username"], vars["title"])
+
+	returnSharedCollection(col, err, w, r)
+}
+
+func returnSharedCollection(col *v1.Collection, err error, w http.ResponseWriter, r *http.Request) {
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if col == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"collection": v1.NewSharedCollection(col),
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiUserCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	user := v1.User{}
+
+	err := readJsonBody(r, &user)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).UserCreate(&user)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"userId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists users, or returns the user matching the username query value.
+func ApiUserList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+
+	var users []v1.User
+	var err error
+
+	if username != "" {
+		var user *v1.User
+		user, err = querier(cfg, r).UserGetByName(username)
+
+		users = []v1.User{}
+		if user != nil {
+			users = append(users, *user)
+		}
+	} else {
+		users, err = querier(cfg, r).UserList()
+	}
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"users": users,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiUserGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(vars["id"], 10, 32)
+	PanicErrorHandler(err)
+	id := int(idInt64)
+
+	user, err := querier(cfg, r).UserGet(id)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"user": user,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Returns the user making the request.
+func ApiUserMe(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+
+	if user == nil {
+		errMsg := "not authenticated"
+		returnGoshelfErrorWithCode(CodeUnauthorized, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"user": user,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiApiKeyCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	req := ApiKeyCreateApiStruct{}
+
+	err := readJsonBody(r, &req)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if req.Scope != v1.ApiKeyScopeRead && req.Scope != v1.ApiKeyScopeReadWrite {
+		errMsg := "invalid scope (must be " + v1.ApiKeyScopeRead + " or " + v1.ApiKeyScopeReadWrite + ")"
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		return
+	}
+
+	secret, prefix, keyHash := "", req.Prefix, req.KeyHash
+
+	if keyHash == "" {
+		secret, prefix, keyHash, err = GenerateApiKey()
+
+		if err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+	}
+
+	key := v1.ApiKey{
+		UserId: req.UserId,
+		Name:   req.Name,
+		Prefix: prefix,
+		Scope:  req.Scope,
+	}
+
+	id, err := querier(cfg, r).ApiKeyCreate(&key, keyHash)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"apiKeyId": id,
+	}
+
+	if secret != "" {
+		ret["key"] = secret
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiApiKeyList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	keys, err := querier(cfg, r).ApiKeyList()
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"apiKeys": keys,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiApiKeyRevoke(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(vars["id"], 10, 32)
+	PanicErrorHandler(err)
+	id := int(idInt64)
+
+	err = querier(cfg, r).ApiKeyRevoke(id)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Lends a book, e.g. {"bookId": 42, "borrower": "Sam", "dueTs": "<RFC3339>"}.
+func ApiLoanCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	loan := v1.Loan{}
+
+	err := readJsonBody(r, &loan)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).LoanCreate(&loan)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"loanId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiLoanGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	loan, err := querier(cfg, r).LoanGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if loan == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"loan": loan,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists loans, newest first. Query values: bookId, active=true for loans
+// not yet returned and overdue=true for active loans past their due date.
+func ApiLoanList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+
+	filter := &v1.LoanFilter{
+		Active:  queries.Get("active") == "true",
+		Overdue: queries.Get("overdue") == "true",
+	}
+
+	if bookIdQ := queries.Get("bookId"); bookIdQ != "" {
+		bookId, err := strconv.Atoi(bookIdQ)
+
+		if err != nil {
+			errMsg := "bookId is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		filter.BookId = &bookId
+	}
+
+	loans, err := querier(cfg, r).LoanList(filter)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"loans": loans,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Checks a loan back in.
+func ApiLoanReturn(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).LoanReturn(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Adds a copy of a book, e.g. {"bookId": 42, "condition": "good",
+// "locationId": 3}.
+func ApiCopyCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	bookCopy := v1.Copy{}
+
+	err := readJsonBody(r, &bookCopy)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).CopyCreate(&bookCopy)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"copyId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiCopyGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	bookCopy, err := querier(cfg, r).CopyGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if bookCopy == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"copy": bookCopy,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists copies. Query values: bookId for where a book's copies are, and
+// locationId for the copies in a location (including locations inside it).
+func ApiCopyList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+	filter := &v1.CopyFilter{}
+
+	for name, field := range map[string]**int{"bookId": &filter.BookId, "locationId": &filter.LocationId} {
+		if q := queries.Get(name); q != "" {
+			id, err := strconv.Atoi(q)
+
+			if err != nil {
+				errMsg := name + " is not an integer"
+				returnGoshelfErrorWithMessage(&errMsg, w, r)
+				return
+			}
+
+			*field = &id
+		}
+	}
+
+	copies, err := querier(cfg, r).CopyList(filter)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"copies": copies,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+type CopyMoveApiStruct struct {
+	LocationId *int `json:"locationId"` // null takes the copy off the shelves
+}
+
+func ApiCopyMove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	move := CopyMoveApiStruct{}
+
+	err = readJsonBody(r, &move)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	err = querier(cfg, r).CopyMove(int(idInt64), move.LocationId)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+func ApiCopyRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).CopyRemove(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Creates a location, e.g. {"name": "B3", "parentId": 2}. The kind
+// defaults to the kind below the parent's.
+func ApiLocationCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	loc := v1.Location{}
+
+	err := readJsonBody(r, &loc)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).LocationCreate(&loc)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"locationId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiLocationList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	locs, err := querier(cfg, r).LocationList()
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"locations": locs,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiLocationRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).LocationRemove(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Creates a series, e.g. {"name": "Dune Chronicles"}.
+func ApiSeriesCreate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	series := v1.Series{}
+
+	err := readJsonBody(r, &series)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	id, err := querier(cfg, r).SeriesCreate(&series)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"seriesId": id,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiSeriesGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	series, err := querier(cfg, r).SeriesGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if series == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"series": series,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiSeriesList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	series, err := querier(cfg, r).SeriesList()
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"series": series,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiSeriesRemove(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).SeriesRemove(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+type SeriesBookApiStruct struct {
+	Position *float64 `json:"position"`
+}
+
+// Puts a book in a series, e.g. {"position": 2.5}.
+func ApiSeriesSetBook(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+	bookIdInt64, err := strconv.ParseInt(mux.Vars(r)["bookId"], 10, 32)
+	PanicErrorHandler(err)
+
+	entry := SeriesBookApiStruct{}
+
+	err = readJsonBody(r, &entry)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if entry.Position == nil {
+		errMsg := "position is required"
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		return
+	}
+
+	err = querier(cfg, r).SeriesSetBook(int(idInt64), int(bookIdInt64), *entry.Position)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+func ApiSeriesRemoveBook(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+	bookIdInt64, err := strconv.ParseInt(mux.Vars(r)["bookId"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).SeriesRemoveBook(int(idInt64), int(bookIdInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Returns the next book in the series the user hasn't read, or null.
+func ApiSeriesNextUnread(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	book, err := querier(cfg, r).SeriesNextUnread(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"book": book,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Returns a work with its editions.
+func ApiWorkGet(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	work, err := querier(cfg, r).WorkGet(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	if work == nil {
+		errMsg := "not found"
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"work": work,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+func ApiWorkList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	works, err := querier(cfg, r).WorkList()
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"works": works,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Updates a work, e.g. {"title": "Dune", "originalLanguage": "en"}.
+func ApiWorkUpdate(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	work := v1.Work{}
+
+	err = readJsonBody(r, &work)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	work.WorkId = int(idInt64)
+
+	err = querier(cfg, r).WorkUpdate(&work)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Lists the editions of a work, oldest first.
+func ApiWorkEditionList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	workId := int(idInt64)
+
+	books, err := querier(cfg, r).BookFilter(&v1.BookFilter{WorkId: &workId})
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"books": books,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Makes a book an edition of the work.
+func ApiWorkSetBook(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+	bookIdInt64, err := strconv.ParseInt(mux.Vars(r)["bookId"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).WorkSetBook(int(idInt64), int(bookIdInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Imports books from the request body. The format query value selects
+// csv (the default), goodreads or storygraph and dryRun=true reports what
+// would be imported without creating books.
+func ApiImport(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+
+	format := queries.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	err := checkContentType(textCsvContentType, r)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	defer r.Body.Close()
+
+	report, err := importBooks(querier(cfg, r), format, r.Body, queries.Get("dryRun") == "true")
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"report": report,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Exports all books visible to the user. Returns the file itself rather
+// than the standard result object.
+func ApiExport(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	if format := r.URL.Query().Get("format"); format != "csv" {
+		errMsg := "unsupported format " + format + " (must be csv)"
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		return
+	}
+
+	books, err := querier(cfg, r).BookFilter(nil)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", textCsvContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="goshelf.csv"`)
+	w.WriteHeader(CodeSuccess)
+
+	err = bookcsv.Write(w, books)
+
+	if err != nil {
+		log.Println("Failed to write export: " + err.Error())
+	}
+}
+
+// Lists audit log entries, newest first. Query values filter by entity
+// (book, author or collection), entityId, actorId and a since/until time
+// range, as RFC 3339 times or YYYY-MM-DD dates. limit caps the entries
+// returned.
+func ApiAuditList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()
+	filter := &v1.AuditFilter{}
+
+	if entityQ := queries.Get("entity"); entityQ != "" {
+		if err := v1.ValidateAuditEntity(entityQ); err != nil {
+			returnGoshelfError(err, w, r)
+			return
+		}
+
+		filter.Entity = &entityQ
+	}
+
+	for key, field := range map[string]**int{
+		"entityId": &filter.EntityId,
+		"actorId":  &filter.ActorId,
+	} {
+		idQ := queries.Get(key)
+
+		if idQ == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(idQ)
+
+		if err != nil {
+			errMsg := key + " is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		*field = &id
+	}
+
+	for key, field := range map[string]**time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		timeQ := queries.Get(key)
+
+		if timeQ == "" {
+			continue
+		}
+
+		t, err := v1.ParseAuditTime(timeQ)
+
+		if err != nil {
+			errMsg := key + ": " + err.Error()
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		*field = &t
+	}
+
+	if limitQ := queries.Get("limit"); limitQ != "" {
+		limit, err := strconv.Atoi(limitQ)
+
+		if err != nil || limit < 1 {
+			errMsg := "limit must be a positive integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		filter.Limit = limit
+	}
+
+	entries, err := querier(cfg, r).AuditList(filter)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"entries": entries,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists the removed books and collections in the trash, newest first.
+func ApiTrashList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	trash, err := querier(cfg, r).TrashList()
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"trash": trash,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Restores a book from the trash, back into its collections.
+func ApiTrashRestoreBook(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).TrashRestoreBook(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Restores a collection, by id, from the trash.
+func ApiTrashRestoreCollection(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	// Should be guaranteed by the regex, but just in case
+	idInt64, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	PanicErrorHandler(err)
+
+	err = querier(cfg, r).TrashRestoreCollection(int(idInt64))
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	returnGoshelfSuccessWithNoObject(w, r)
+}
+
+// Deletes for good what was trashed before the before query value, an
+// RFC 3339 time or YYYY-MM-DD date, or the whole trash with all=true.
+func ApiTrashPurge(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	var before *time.Time
+
+	if beforeQ := r.URL.Query().Get("before"); beforeQ != "" {
+		t, err := v1.ParseAuditTime(beforeQ)
+
+		if err != nil {
+			errMsg := "before: " + err.Error()
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+
+		before = &t
+	} else if r.URL.Query().Get("all") != "true" {
+		// Purging everything has to be asked for
+		errMsg := "before or all=true is required"
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+		return
+	}
+
+	report, err := querier(cfg, r).TrashPurge(before)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"report": report,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Lists the user's last changes an undo would reverse, newest first. The
+// count query value sets how many, default 1.
+func ApiUndoList(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	count := 1
+
+	if countQ := r.URL.Query().Get("count"); countQ != "" {
+		var err error
+		count, err = strconv.Atoi(countQ)
+
+		if err != nil {
+			errMsg := "count is not an integer"
+			returnGoshelfErrorWithMessage(&errMsg, w, r)
+			return
+		}
+	}
+
+	entries, err := querier(cfg, r).UndoList(count)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"entries": entries,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Reverses the user's last changes as listed by ApiUndoList, given by
+// their audit ids, e.g. {"auditIds": [12, 11]}, and returns the entries
+// undone. Returns a conflict if they are no longer the last changes.
+func ApiUndo(cfg *GoshelfConfig, w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		AuditIds []int `json:"auditIds"`
+	}{}
+
+	err := readJsonBody(r, &body)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	entries, err := querier(cfg, r).Undo(body.AuditIds)
+
+	if err != nil {
+		returnGoshelfError(err, w, r)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"entries": entries,
+	}
+
+	returnGoshelfSuccessWithObject(&ret, w, r)
+}
+
+// Returns the public URL of a share token (or username/title path for
+// public collections). Uses cfg.BaseUrl when set, otherwise the server's
+// own address.
+func ShareUrl(cfg *GoshelfConfig, token string) string {
+	base := cfg.BaseUrl
+
+	if base == "" {
+		scheme := "http://"
+		if cfg.TlsCert != "" {
+			scheme = "https://"
+		}
+
+		base = scheme + cfg.Host + ":" + fmt.Sprint(cfg.Port)
+	}
+
+	return strings.TrimSuffix(base, "/") + SharedPath + token
+}
+
+func StartServer(cfg GoshelfConfig) {
+	r := mux.NewRouter()
+	r.Use(AuthMiddleware(&cfg))
+
+	for _, v := range getPathFunctions(&cfg) {
+		log.Println("Handling " + v.Path)
+		r.HandleFunc(v.Path, v.Function)
+	}
+
+	ln, err := Listen(&cfg)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	tlsCfg, reloader, err := TlsConfig(&cfg)
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	server := &http.Server{
+		Handler:   r,
+		TLSConfig: tlsCfg,
+	}
+
+	log.Println("Starting server on " + ln.Addr().String())
+
+	if tlsCfg != nil {
+		reloader.watchSignals()
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		err = server.Serve(ln)
+	}
 
 	if err != nil {
 		log.Fatal(err.Error())
@@ -3,8 +3,11 @@ package goshelf
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/db"
 )
 
 func getPathFunctions(cfg *GoshelfConfig) []PathFunction {
@@ -16,7 +19,7 @@ func getPathFunctions(cfg *GoshelfConfig) []PathFunction {
 				case http.MethodGet:
 					ApiBookFilter(cfg, w, r)
 				case http.MethodPost:
-					// ApiBookCreate(cfg, w, r)
+					ApiBookCreate(cfg, w, r)
 				default:
 					errMsg := "unsupported HTTP method"
 					returnGoshelfErrorWithMessage(&errMsg, w, r)
@@ -37,10 +40,62 @@ func getPathFunctions(cfg *GoshelfConfig) []PathFunction {
 				}
 			},
 		},
+		{
+			Path: BookPath + "{id:[0-9]+}/progress",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiBookProgressGet(cfg, w, r)
+				case http.MethodPost:
+					ApiBookProgressUpdate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: BookPath + "isbn/{isbn:[0-9Xx-]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiBookGetByIsbn(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: BookPath + "duplicates",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiBookDuplicates(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: BookPath + "{id:[0-9]+}/merge",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiBookMerge(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
 		{
 			Path: CollectionPath,
 			Function: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
+				case http.MethodGet:
+					ApiCollectionList(cfg, w, r)
 				case http.MethodPost:
 					ApiCollectionCreate(cfg, w, r)
 				default:
@@ -50,7 +105,133 @@ func getPathFunctions(cfg *GoshelfConfig) []PathFunction {
 			},
 		},
 		{
-			Path: CollectionPath + "{title:[a-zA-Z0-9_-]+}",
+			Path: CollectionPath + collectionTitlePattern + "/share",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiCollectionShareList(cfg, w, r)
+				case http.MethodPost:
+					ApiCollectionShareCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			// Share ids are unique, so links may also be revoked without the title
+			Path: CollectionPath + "share/{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					ApiCollectionShareRevoke(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern + "/share/{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					ApiCollectionShareRevoke(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern + "/book",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiCollectionAddBooks(cfg, w, r)
+				case http.MethodPut:
+					ApiCollectionReorder(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern + "/book/{bookId:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiCollectionUpdateBook(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern + "/parent",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiCollectionSetParent(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern + "/public",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiCollectionSetPublic(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SharedPath + "{token:gss_[a-zA-Z0-9_-]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiSharedGet(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SharedPath + "{username}/" + collectionTitlePattern,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiSharedPublicGet(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			// Updates address collections by id, so they can be renamed
+			Path: CollectionPath + "id/{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiCollectionUpdate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CollectionPath + collectionTitlePattern,
 			Function: func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case http.MethodGet:
@@ -63,6 +244,412 @@ func getPathFunctions(cfg *GoshelfConfig) []PathFunction {
 				}
 			},
 		},
+		{
+			Path: UserPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiUserList(cfg, w, r)
+				case http.MethodPost:
+					ApiUserCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: UserPath + "me",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiUserMe(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: UserPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiUserGet(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: ApiKeyPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiApiKeyList(cfg, w, r)
+				case http.MethodPost:
+					ApiApiKeyCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: ApiKeyPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					ApiApiKeyRevoke(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: BookPath + "{id:[0-9]+}/review",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiReviewList(cfg, w, r)
+				case http.MethodPut:
+					ApiReviewSet(cfg, w, r)
+				case http.MethodDelete:
+					ApiReviewRemove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: BookPath + "{id:[0-9]+}/note",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiNoteList(cfg, w, r)
+				case http.MethodPost:
+					ApiNoteCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: NotePath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiNoteGet(cfg, w, r)
+				case http.MethodPut:
+					ApiNoteUpdate(cfg, w, r)
+				case http.MethodDelete:
+					ApiNoteRemove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: LoanPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiLoanList(cfg, w, r)
+				case http.MethodPost:
+					ApiLoanCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: LoanPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiLoanGet(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: LoanPath + "{id:[0-9]+}/return",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiLoanReturn(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CopyPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiCopyList(cfg, w, r)
+				case http.MethodPost:
+					ApiCopyCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CopyPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiCopyGet(cfg, w, r)
+				case http.MethodDelete:
+					ApiCopyRemove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: CopyPath + "{id:[0-9]+}/move",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiCopyMove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: LocationPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiLocationList(cfg, w, r)
+				case http.MethodPost:
+					ApiLocationCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: LocationPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					ApiLocationRemove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SeriesPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiSeriesList(cfg, w, r)
+				case http.MethodPost:
+					ApiSeriesCreate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SeriesPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiSeriesGet(cfg, w, r)
+				case http.MethodDelete:
+					ApiSeriesRemove(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SeriesPath + "{id:[0-9]+}/book/{bookId:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiSeriesSetBook(cfg, w, r)
+				case http.MethodDelete:
+					ApiSeriesRemoveBook(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: SeriesPath + "{id:[0-9]+}/next",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiSeriesNextUnread(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: WorkPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiWorkList(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: WorkPath + "{id:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiWorkGet(cfg, w, r)
+				case http.MethodPut:
+					ApiWorkUpdate(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: WorkPath + "{id:[0-9]+}/edition",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiWorkEditionList(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: WorkPath + "{id:[0-9]+}/edition/{bookId:[0-9]+}",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					ApiWorkSetBook(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: ImportPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiImport(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: ExportPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiExport(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: AuditPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiAuditList(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: TrashPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiTrashList(cfg, w, r)
+				case http.MethodDelete:
+					ApiTrashPurge(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: TrashPath + "/book/{id:[0-9]+}/restore",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiTrashRestoreBook(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: TrashPath + "/collection/{id:[0-9]+}/restore",
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPost:
+					ApiTrashRestoreCollection(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
+		{
+			Path: UndoPath,
+			Function: func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					ApiUndoList(cfg, w, r)
+				case http.MethodPost:
+					ApiUndo(cfg, w, r)
+				default:
+					errMsg := "unsupported HTTP method"
+					returnGoshelfErrorWithMessage(&errMsg, w, r)
+				}
+			},
+		},
 	}
 }
 
@@ -82,6 +669,25 @@ func checkContentType(contentTypeExpected string, r *http.Request) error {
 	return nil
 }
 
+// Reads a JSON request body into v. Requires a JSON content type.
+func readJsonBody(r *http.Request, v interface{}) error {
+	err := checkContentType(applicationJsonContentType, r)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
 func createResponseObject(status string, code int, metadata *map[string]interface{}) map[string]interface{} {
 	return map[string]interface{}{
 		"type":        "sync",
@@ -92,11 +698,30 @@ func createResponseObject(status string, code int, metadata *map[string]interfac
 }
 
 func returnGoshelfErrorWithMessage(msg *string, w http.ResponseWriter, r *http.Request) {
+	returnGoshelfErrorWithCode(CodeFailure, msg, w, r)
+}
+
+// Returns err as a failure, 404 if it matches db.ErrNotFound, 409 if it
+// matches db.ErrConflict and 400 otherwise.
+func returnGoshelfError(err error, w http.ResponseWriter, r *http.Request) {
+	errMsg := err.Error()
+
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		returnGoshelfErrorWithCode(CodeNotFound, &errMsg, w, r)
+	case errors.Is(err, db.ErrConflict):
+		returnGoshelfErrorWithCode(CodeConflict, &errMsg, w, r)
+	default:
+		returnGoshelfErrorWithMessage(&errMsg, w, r)
+	}
+}
+
+func returnGoshelfErrorWithCode(code int, msg *string, w http.ResponseWriter, r *http.Request) {
 	metadata := map[string]interface{}{
 		"message": *msg,
 	}
 
-	returnGoshelfResponse(StatusFailure, CodeFailure, &metadata, w, r)
+	returnGoshelfResponse(StatusFailure, code, &metadata, w, r)
 }
 
 func returnGoshelfSuccessWithNoObject(w http.ResponseWriter, r *http.Request) {
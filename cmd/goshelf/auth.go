@@ -0,0 +1,167 @@
+package goshelf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	"github.com/gorilla/mux"
+)
+
+const ApiKeyPrefix = "gs_"
+const ShareTokenPrefix = "gss_"
+const secretBytes = 32
+const secretDisplayLength = 8 // characters shown after the prefix
+
+type apiKeyContextKey struct{}
+type querierContextKey struct{}
+type userContextKey struct{}
+
+// Generates a new random API key. Returns the secret to hand to the user,
+// a short prefix safe to display when listing keys, and the hash to store.
+func GenerateApiKey() (secret string, prefix string, keyHash string, err error) {
+	return generateSecret(ApiKeyPrefix)
+}
+
+// Generates a new unguessable collection share token, see GenerateApiKey.
+func GenerateShareToken() (token string, prefix string, tokenHash string, err error) {
+	return generateSecret(ShareTokenPrefix)
+}
+
+func generateSecret(secretPrefix string) (string, string, string, error) {
+	buf := make([]byte, secretBytes)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	return secret, secret[:len(secretPrefix)+secretDisplayLength], HashApiKey(secret), nil
+}
+
+// Hashes an API key or share token for storage and lookup. Secrets are long
+// random strings, so a fast hash is sufficient (no salt or stretching needed).
+func HashApiKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the API key that authenticated the request, or nil for
+// anonymous requests.
+func ApiKeyFromRequest(r *http.Request) *v1.ApiKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*v1.ApiKey)
+	return key
+}
+
+// Returns the user that authenticated the request, or nil for anonymous
+// requests.
+func UserFromRequest(r *http.Request) *v1.User {
+	user, _ := r.Context().Value(userContextKey{}).(*v1.User)
+	return user
+}
+
+// Returns the querier to use for a request, acting as the user that owns
+// the request's API key. Anonymous requests use the unscoped querier.
+func querier(cfg *GoshelfConfig, r *http.Request) GoshelfQuerier {
+	if q, ok := r.Context().Value(querierContextKey{}).(GoshelfQuerier); ok {
+		return q
+	}
+
+	return cfg.Goshelf
+}
+
+// Returns the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(auth, " ")
+
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Returns middleware requiring a valid API key on every request. Read-only
+// requests may skip authentication when cfg.AnonymousRead is set; all other
+// requests need a key with the read-write scope. Authenticated requests act
+// as the key's user, see querier.
+func AuthMiddleware(cfg *GoshelfConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			readOnly := isReadOnlyMethod(r.Method)
+
+			// Shared collections are public, the share token is the credential
+			if readOnly && strings.HasPrefix(r.URL.Path, SharedPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(r)
+
+			if !ok {
+				if readOnly && cfg.AnonymousRead {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				errMsg := "missing bearer token"
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				returnGoshelfErrorWithCode(CodeUnauthorized, &errMsg, w, r)
+				return
+			}
+
+			key, err := cfg.Goshelf.ApiKeyGetByHash(HashApiKey(token))
+
+			if err != nil {
+				errMsg := err.Error()
+				returnGoshelfErrorWithMessage(&errMsg, w, r)
+				return
+			}
+
+			if key == nil {
+				errMsg := "invalid api key"
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				returnGoshelfErrorWithCode(CodeUnauthorized, &errMsg, w, r)
+				return
+			}
+
+			if !readOnly && !key.CanWrite() {
+				errMsg := "api key scope does not permit writes"
+				returnGoshelfErrorWithCode(CodeForbidden, &errMsg, w, r)
+				return
+			}
+
+			user, err := cfg.Goshelf.UserGet(key.UserId)
+
+			if err != nil {
+				errMsg := err.Error()
+				returnGoshelfErrorWithMessage(&errMsg, w, r)
+				return
+			}
+
+			if user == nil {
+				errMsg := "invalid api key"
+				returnGoshelfErrorWithCode(CodeUnauthorized, &errMsg, w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyContextKey{}, key)
+			ctx = context.WithValue(ctx, userContextKey{}, user)
+			ctx = context.WithValue(ctx, querierContextKey{}, cfg.Goshelf.AsUser(user))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package goshelf
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Mock querier holding API keys by hash. Unimplemented methods panic
+// through the nil embedded interface.
+type mockKeyQuerier struct {
+	GoshelfQuerier
+	keys map[string]*v1.ApiKey
+	user *v1.User
+}
+
+func (m *mockKeyQuerier) ApiKeyGetByHash(keyHash string) (*v1.ApiKey, error) {
+	return m.keys[keyHash], nil
+}
+
+func (m *mockKeyQuerier) UserGet(id int) (*v1.User, error) {
+	return &v1.User{UserId: id, Role: v1.UserRoleMember}, nil
+}
+
+func (m *mockKeyQuerier) AsUser(u *v1.User) GoshelfQuerier {
+	return &mockKeyQuerier{keys: m.keys, user: u}
+}
+
+var _ = Describe("Auth", func() {
+	var cfg *GoshelfConfig
+	var handler http.Handler
+	var readKey, writeKey string
+	var requestUser *v1.User
+
+	BeforeEach(func() {
+		var readHash, writeHash string
+		var err error
+
+		readKey, _, readHash, err = GenerateApiKey()
+		Expect(err).To(BeNil())
+		writeKey, _, writeHash, err = GenerateApiKey()
+		Expect(err).To(BeNil())
+
+		cfg = &GoshelfConfig{
+			Goshelf: &mockKeyQuerier{keys: map[string]*v1.ApiKey{
+				readHash:  {ApiKeyId: 1, UserId: 1, Scope: v1.ApiKeyScopeRead},
+				writeHash: {ApiKeyId: 2, UserId: 1, Scope: v1.ApiKeyScopeReadWrite},
+			}},
+		}
+
+		requestUser = nil
+		handler = AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestUser = querier(cfg, r).(*mockKeyQuerier).user
+			w.WriteHeader(CodeSuccess)
+		}))
+	})
+
+	serveMethodPath := func(method string, path string, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	serve := func(method string, token string) int {
+		return serveMethodPath(method, BookPath, token)
+	}
+
+	Context("generating keys", func() {
+		It("should return a prefixed secret and matching hash", func() {
+			secret, prefix, keyHash, err := GenerateApiKey()
+			Expect(err).To(BeNil())
+			Expect(secret).To(HavePrefix(ApiKeyPrefix))
+			Expect(secret).To(HavePrefix(prefix))
+			Expect(keyHash).To(Equal(HashApiKey(secret)))
+			Expect(keyHash).ToNot(ContainSubstring(secret))
+		})
+	})
+
+	Context("generating share tokens", func() {
+		It("should return a URL safe token", func() {
+			token, _, tokenHash, err := GenerateShareToken()
+			Expect(err).To(BeNil())
+			Expect(token).To(MatchRegexp("^gss_[a-zA-Z0-9_-]+$"))
+			Expect(tokenHash).To(Equal(HashApiKey(token)))
+		})
+
+		It("should build share URLs from the base URL", func() {
+			cfg.BaseUrl = "https://shelf.example/"
+			Expect(ShareUrl(cfg, "gss_abc")).To(Equal("https://shelf.example" + SharedPath + "gss_abc"))
+		})
+	})
+
+	Context("middleware", func() {
+		It("should reject requests without a token", func() {
+			Expect(serve(http.MethodGet, "")).To(Equal(CodeUnauthorized))
+		})
+
+		It("should reject unknown tokens", func() {
+			Expect(serve(http.MethodGet, "gs_unknown")).To(Equal(CodeUnauthorized))
+		})
+
+		It("should allow reads with a read key", func() {
+			Expect(serve(http.MethodGet, readKey)).To(Equal(CodeSuccess))
+		})
+
+		It("should forbid writes with a read key", func() {
+			Expect(serve(http.MethodDelete, readKey)).To(Equal(CodeForbidden))
+		})
+
+		It("should allow writes with a read-write key", func() {
+			Expect(serve(http.MethodPost, writeKey)).To(Equal(CodeSuccess))
+		})
+
+		It("should allow anonymous reads only when configured", func() {
+			cfg.AnonymousRead = true
+			Expect(serve(http.MethodGet, "")).To(Equal(CodeSuccess))
+			Expect(requestUser).To(BeNil())
+			Expect(serve(http.MethodDelete, "")).To(Equal(CodeUnauthorized))
+		})
+
+		It("should allow reading shared collections without a token", func() {
+			Expect(serveMethodPath(http.MethodGet, SharedPath+"gss_token", "")).To(Equal(CodeSuccess))
+			Expect(serveMethodPath(http.MethodDelete, SharedPath+"gss_token", "")).To(Equal(CodeUnauthorized))
+		})
+
+		It("should act as the key's user", func() {
+			Expect(serve(http.MethodGet, readKey)).To(Equal(CodeSuccess))
+			Expect(requestUser).ToNot(BeNil())
+			Expect(requestUser.UserId).To(Equal(1))
+		})
+	})
+})
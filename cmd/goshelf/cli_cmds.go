@@ -2,13 +2,24 @@ package goshelf
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/backup"
+	"github.com/Max-Clark/goshelf/cmd/bookcsv"
 	"github.com/Max-Clark/goshelf/cmd/cli"
+	"github.com/Max-Clark/goshelf/cmd/dedupe"
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	"github.com/Max-Clark/goshelf/cmd/metadata"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 )
 
@@ -17,15 +28,85 @@ var cliFuncMap = map[string]func(*GoshelfConfig){
 	"bookget":          CliBookGet,
 	"bookremove":       CliBookRemove,
 	"bookfilter":       CliBookFilter,
+	"bookprogress":     CliBookProgress,
+	"lend":             CliLend,
+	"return":           CliReturn,
+	"loans":            CliLoans,
+	"copy":             CliCopy,
+	"location":         CliLocation,
+	"series":           CliSeries,
+	"review":           CliReview,
+	"note":             CliNote,
+	"work":             CliWork,
+	"dedupe":           CliDedupe,
 	"collectioncreate": CliCollectionCreate,
 	"collectionget":    CliCollectionGet,
 	"collectionremove": CliCollectionRemove,
+	"collectionorder":  CliCollectionOrder,
+	"collectionbook":   CliCollectionBook,
+	"collectiontree":   CliCollectionTree,
+	"collectionmove":   CliCollectionMove,
+	"collectionupdate": CliCollectionUpdate,
+	"collectionshare":  CliCollectionShare,
+	"apikey":           CliApiKey,
+	"user":             CliUser,
+	"context":          CliContext,
+	"import":           CliImport,
+	"export":           CliExport,
+	"backup":           CliBackup,
+	"restore":          CliRestore,
+	"audit":            CliAudit,
+	"trash":            CliTrash,
+	"undo":             CliUndo,
 }
 
 func GetCliFuncMap() map[string]func(*GoshelfConfig) {
 	return cliFuncMap
 }
 
+// Parses a command's flags from args, allowing flags before or after
+// positional arguments. Returns the positional arguments.
+func parseCommandFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flagSet.Args()
+
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Imports books from r in the given format: csv, or a reading app export
+// (see bookcsv.LibraryFormats).
+func importBooks(q GoshelfQuerier, format string, r io.Reader, dryRun bool) (*bookcsv.ImportReport, error) {
+	if format == "csv" {
+		rows, rowErrors, err := bookcsv.Read(r, bookcsv.DefaultColumns)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return bookcsv.Import(q, rows, rowErrors, dryRun), nil
+	}
+
+	library, ok := bookcsv.LibraryFormats[format]
+
+	if !ok {
+		return nil, errors.New("unsupported format " + format)
+	}
+
+	return bookcsv.ImportLibrary(q, r, library, dryRun)
+}
+
 func PanicErrorHandler(err error) {
 	if err != nil {
 		log.Panic(err)
@@ -34,34 +115,59 @@ func PanicErrorHandler(err error) {
 
 // TODO: automate these based on reflection
 // Creates a book from the cli. Requires a fully configured Goshelfconfig.
+// With -lookup <isbn>, the prompts are pre-filled from the metadata
+// provider and the book is shown for confirmation before it is created.
+// -work, -language and -translation-of set the book's edition details.
 func CliBookCreate(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("bookcreate", flag.ContinueOnError)
+	lookup := flagSet.String("lookup", "", "ISBN to pre-fill the book from")
+	workId := flagSet.Int("work", 0, "Work the book is an edition of (default a new work)")
+	language := flagSet.String("language", "", "Language of the edition, e.g. en")
+	translationOf := flagSet.Int("translation-of", 0, "Book id of the edition this is translated from")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	candidate := &v1.Book{}
+
+	if *lookup != "" {
+		candidate, err = metadataProvider(cfg).Lookup(metadata.Query{Isbn: *lookup})
+		PanicErrorHandler(err)
+	}
+
+	defaults := bookPromptDefaults(candidate)
+
 	// TODO: implement cli tooling interface
 	prompt := "\tEnter title: "
-	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	title, err := cli.GetCliPromptWithDefault(&prompt, defaults["title"], os.Stdin)
 	PanicErrorHandler(err)
 
 	prompt = "\tEnter author's first name: "
-	aFirst, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	aFirst, err := cli.GetCliPromptWithDefault(&prompt, defaults["first"], os.Stdin)
 	PanicErrorHandler(err)
 
-	prompt = "\tEnter author's first name: "
-	aLast, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	prompt = "\tEnter author's last name: "
+	aLast, err := cli.GetCliPromptWithDefault(&prompt, defaults["last"], os.Stdin)
 	PanicErrorHandler(err)
 
 	prompt = "\tEnter description (optional): "
-	desc, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	desc, err := cli.GetCliPromptWithDefault(&prompt, defaults["description"], os.Stdin)
 	PanicErrorHandler(err)
 
 	prompt = "\tEnter edition (optional): "
-	ed, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	ed, err := cli.GetCliPromptWithDefault(&prompt, defaults["edition"], os.Stdin)
 	PanicErrorHandler(err)
 
 	prompt = "\tEnter genre (optional): "
-	genre, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	genre, err := cli.GetCliPromptWithDefault(&prompt, defaults["genre"], os.Stdin)
 	PanicErrorHandler(err)
 
 	prompt = "\tEnter publish date YYYY-MM-dd (optional): "
-	date, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	date, err := cli.GetCliPromptWithDefault(&prompt, defaults["date"], os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter ISBN-10 or ISBN-13 (optional): "
+	isbnStr, err := cli.GetCliPromptWithDefault(&prompt, defaults["isbn"], os.Stdin)
 	PanicErrorHandler(err)
 
 	book := v1.Book{
@@ -70,6 +176,17 @@ func CliBookCreate(cfg *GoshelfConfig) {
 			FirstName: *aFirst,
 			LastName:  *aLast,
 		},
+		// Not prompted for, kept from the lookup
+		Identifiers: candidate.Identifiers,
+		WorkId:      *workId,
+	}
+
+	if *language != "" {
+		book.Language = language
+	}
+
+	if *translationOf > 0 {
+		book.TranslationOf = translationOf
 	}
 
 	if *desc != "" {
@@ -103,6 +220,32 @@ func CliBookCreate(cfg *GoshelfConfig) {
 		book.PublishDate = &pDate
 	}
 
+	if *isbnStr != "" {
+		book.Isbn13 = isbnStr
+
+		// Catch typos before anything is sent to the backend
+		err = isbn.NormalizeBook(&book)
+
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	if *lookup != "" {
+		json, err := json.Marshal(book)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+
+		prompt = "\tCreate this book? [Y/n]: "
+		confirm, err := cli.GetCliPrompt(&prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		if *confirm != "" && !strings.HasPrefix(strings.ToLower(*confirm), "y") {
+			return
+		}
+	}
+
 	id, err := cfg.Goshelf.BookCreate(&book)
 
 	PanicErrorHandler(err)
@@ -110,6 +253,37 @@ func CliBookCreate(cfg *GoshelfConfig) {
 	fmt.Printf("%v", *id)
 }
 
+// Returns the values of b to pre-fill CliBookCreate's prompts with.
+func bookPromptDefaults(b *v1.Book) map[string]string {
+	defaults := map[string]string{
+		"title": b.Title,
+		"first": b.Author.FirstName,
+		"last":  b.Author.LastName,
+	}
+
+	if b.Description != nil {
+		defaults["description"] = *b.Description
+	}
+
+	if b.Edition != nil {
+		defaults["edition"] = fmt.Sprint(*b.Edition)
+	}
+
+	if b.Genre != nil {
+		defaults["genre"] = *b.Genre
+	}
+
+	if b.PublishDate != nil {
+		defaults["date"] = b.PublishDate.Format("2006-01-02")
+	}
+
+	if b.Isbn13 != nil {
+		defaults["isbn"] = *b.Isbn13
+	}
+
+	return defaults
+}
+
 func CliBookGet(cfg *GoshelfConfig) {
 	prompt := "\tEnter book id: "
 	idStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
@@ -129,21 +303,74 @@ func CliBookGet(cfg *GoshelfConfig) {
 	fmt.Print(string(json))
 }
 
+// Moves a book to the trash after showing it and asking to confirm.
+// Usage: bookremove [book id] [-yes]
+// The id is prompted for if not given. -yes skips the confirmation.
 func CliBookRemove(cfg *GoshelfConfig) {
-	prompt := "\tEnter book id: "
-	idStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	flagSet := flag.NewFlagSet("bookremove", flag.ContinueOnError)
+	yes := flagSet.Bool("yes", false, "Remove without asking to confirm")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
 	PanicErrorHandler(err)
 
+	var idStr *string
+
+	if len(args) > 0 {
+		idStr = &args[0]
+	} else {
+		prompt := "\tEnter book id: "
+		idStr, err = cli.GetCliPrompt(&prompt, os.Stdin)
+		PanicErrorHandler(err)
+	}
+
 	idInt64, err := strconv.ParseInt(*idStr, 10, 32)
 	PanicErrorHandler(err)
 
 	id := int(idInt64)
 
+	book, err := cfg.Goshelf.BookGet(id)
+	PanicErrorHandler(err)
+
+	if book == nil {
+		PanicErrorHandler(errors.New("book not found"))
+	}
+
+	if !*yes {
+		ok, err := cli.GetCliConfirm("\tRemove book "+describeBook(book)+"?", os.Stdin)
+		PanicErrorHandler(err)
+
+		if !ok {
+			return
+		}
+	}
+
 	err = cfg.Goshelf.BookRemove(id)
 	PanicErrorHandler(err)
 }
 
+// Returns a short description of a book for prompts, e.g.
+// `12 "Dune" by Frank Herbert`.
+func describeBook(b *v1.Book) string {
+	author := strings.TrimSpace(b.Author.FirstName + " " + b.Author.LastName)
+
+	if author == "" {
+		return fmt.Sprintf("%d %q", b.BookId, b.Title)
+	}
+
+	return fmt.Sprintf("%d %q by %s", b.BookId, b.Title, author)
+}
+
+// Prompts for a filter and prints the matching books.
+// Usage: bookfilter [-save title]
+// With -save, the answers are also saved as a smart collection, whose
+// books are the matches at the time it is read.
 func CliBookFilter(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("bookfilter", flag.ContinueOnError)
+	save := flagSet.String("save", "", "Save the filter as a smart collection with this title")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
 	prompt := "\tEnter partial title to search (optional): "
 	titleStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
 	PanicErrorHandler(err)
@@ -156,6 +383,30 @@ func CliBookFilter(cfg *GoshelfConfig) {
 	genreStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
 	PanicErrorHandler(err)
 
+	prompt = "\tEnter ISBN (optional): "
+	isbnStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter reading status (optional): "
+	statusStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter series id (optional): "
+	seriesStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter published before date YYYY-MM-dd (optional): "
+	beforeStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter published on or after date YYYY-MM-dd (optional): "
+	afterStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter sort order, " + v1.BookSortRating + " (optional): "
+	sortStr, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
 	var title *string
 	var genre *string
 	var edition *int
@@ -180,7 +431,57 @@ func CliBookFilter(cfg *GoshelfConfig) {
 		edition = &editionInt
 	}
 
-	books, err := cfg.Goshelf.BookFilter(title, genre, edition)
+	filter := &v1.BookFilter{
+		Title:   title,
+		Genre:   genre,
+		Edition: edition,
+	}
+
+	if *isbnStr != "" {
+		filter.Isbn = isbnStr
+	}
+
+	if *statusStr != "" {
+		filter.Status = statusStr
+	}
+
+	if *seriesStr != "" {
+		seriesId, err := strconv.Atoi(*seriesStr)
+		PanicErrorHandler(err)
+
+		filter.SeriesId = &seriesId
+	}
+
+	if *beforeStr != "" {
+		before, err := time.Parse("2006-01-02", *beforeStr)
+
+		if err != nil {
+			log.Panic("invalid time format (must match YYYY-MM-dd)")
+		}
+
+		filter.PublishedBefore = &before
+	}
+
+	if *afterStr != "" {
+		after, err := time.Parse("2006-01-02", *afterStr)
+
+		if err != nil {
+			log.Panic("invalid time format (must match YYYY-MM-dd)")
+		}
+
+		filter.PublishedAfter = &after
+	}
+
+	if *sortStr != "" {
+		filter.Sort = sortStr
+	}
+
+	if *save != "" {
+		_, err := cfg.Goshelf.CollectionCreateSmart(save, filter)
+		PanicErrorHandler(err)
+	}
+
+	books, err := cfg.Goshelf.BookFilter(filter)
 	PanicErrorHandler(err)
 
 	for _, book := range books {
@@ -191,48 +492,1833 @@ func CliBookFilter(cfg *GoshelfConfig) {
 	}
 }
 
-func CliCollectionCreate(cfg *GoshelfConfig) {
-	prompt := "\tEnter collection title: "
-	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+// Shows or updates the user's reading progress of a book. Usage:
+// bookprogress <id> [-status s] [-page n] [-percent p] [-started date] [-finished date]
+// Without flags the current state and history are printed.
+func CliBookProgress(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("bookprogress", flag.ContinueOnError)
+	status := flagSet.String("status", "", "want-to-read, reading, finished or abandoned")
+	page := flagSet.Int("page", 0, "Current page")
+	percent := flagSet.Float64("percent", 0, "Percentage read, 0-100")
+	started := flagSet.String("started", "", "Start date YYYY-MM-dd, default when reading starts")
+	finished := flagSet.String("finished", "", "Finish date YYYY-MM-dd, default when finished or abandoned")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
 	PanicErrorHandler(err)
 
-	bookIds := []int{}
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: bookprogress <id> [-status s] [-page n] [-percent p] [-started date] [-finished date]")
+		return
+	}
 
-	for {
-		prompt := "\tEnter book id (press enter when finished): "
-		bookId, err := cli.GetIntFromCli(&prompt, os.Stdin, os.Stdout)
-		PanicErrorHandler(err)
+	idInt64, err := strconv.ParseInt(args[0], 10, 32)
+	PanicErrorHandler(err)
 
-		if bookId == nil {
-			break
+	id := int(idInt64)
+
+	update := &v1.ProgressUpdate{}
+	changed := false
+
+	parseDate := func(v string) *time.Time {
+		date, err := time.Parse("2006-01-02", v)
+
+		if err != nil {
+			log.Panic("invalid time format (must match YYYY-MM-dd)")
 		}
 
-		bookIds = append(bookIds, *bookId)
+		return &date
+	}
+
+	flagSet.Visit(func(f *flag.Flag) {
+		changed = true
+
+		switch f.Name {
+		case "status":
+			update.Status = status
+		case "page":
+			update.Page = page
+		case "percent":
+			update.Percent = percent
+		case "started":
+			update.StartedTs = parseDate(*started)
+		case "finished":
+			update.FinishedTs = parseDate(*finished)
+		}
+	})
+
+	var state *v1.ReadingState
+
+	if changed {
+		state, err = cfg.Goshelf.BookProgressUpdate(id, update)
+	} else {
+		state, err = cfg.Goshelf.BookProgressGet(id)
 	}
 
-	_, err = cfg.Goshelf.CollectionCreate(title, bookIds)
 	PanicErrorHandler(err)
+
+	json, err := json.Marshal(state)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
 }
 
-func CliCollectionGet(cfg *GoshelfConfig) {
-	prompt := "\tEnter collection title: "
-	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+// Lends a book. Usage: lend <book id> <borrower> [-due YYYY-MM-dd | -days n] [-note text]
+func CliLend(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("lend", flag.ContinueOnError)
+	due := flagSet.String("due", "", "Due date YYYY-MM-dd")
+	days := flagSet.Int("days", 0, "Due this many days from today, instead of -due")
+	note := flagSet.String("note", "", "Note about the loan")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
 	PanicErrorHandler(err)
 
-	col, err := cfg.Goshelf.CollectionGet(title)
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: lend <book id> <borrower> [-due YYYY-MM-dd | -days n] [-note text]")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(args[0], 10, 32)
 	PanicErrorHandler(err)
 
-	json, err := json.Marshal(col)
+	loan := v1.Loan{
+		BookId:   int(idInt64),
+		Borrower: strings.Join(args[1:], " "),
+	}
+
+	if *due != "" {
+		dueTs, err := time.Parse("2006-01-02", *due)
+
+		if err != nil {
+			log.Panic("invalid time format (must match YYYY-MM-dd)")
+		}
+
+		loan.DueTs = &dueTs
+	} else if *days > 0 {
+		dueTs := time.Now().AddDate(0, 0, *days)
+		loan.DueTs = &dueTs
+	}
+
+	if *note != "" {
+		loan.Note = note
+	}
+
+	id, err := cfg.Goshelf.LoanCreate(&loan)
 	PanicErrorHandler(err)
 
-	fmt.Println(string(json))
+	fmt.Printf("%v", *id)
 }
 
-func CliCollectionRemove(cfg *GoshelfConfig) {
-	prompt := "\tEnter collection title: "
-	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+// Checks a lent book back in. Usage: return <book id>
+func CliReturn(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: return <book id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[0], 10, 32)
+	PanicErrorHandler(err)
+
+	bookId := int(idInt64)
+
+	loans, err := cfg.Goshelf.LoanList(&v1.LoanFilter{BookId: &bookId, Active: true})
 	PanicErrorHandler(err)
 
-	err = cfg.Goshelf.CollectionRemove(title)
+	if len(loans) < 1 {
+		log.Panic("book is not on loan")
+	}
+
+	err = cfg.Goshelf.LoanReturn(loans[0].LoanId)
+	PanicErrorHandler(err)
+}
+
+// Lists loans, active ones by default. Usage: loans [-overdue] [-all] [-book id]
+func CliLoans(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("loans", flag.ContinueOnError)
+	overdue := flagSet.Bool("overdue", false, "Only overdue loans")
+	all := flagSet.Bool("all", false, "Include returned loans")
+	bookId := flagSet.Int("book", 0, "Only loans of this book, e.g. its loan history with -all")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	filter := &v1.LoanFilter{
+		Active:  !*all,
+		Overdue: *overdue,
+	}
+
+	if *bookId > 0 {
+		filter.BookId = bookId
+	}
+
+	loans, err := cfg.Goshelf.LoanList(filter)
+	PanicErrorHandler(err)
+
+	for _, loan := range loans {
+		json, err := json.Marshal(loan)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Manages physical copies of books. Expects one of the add, list, move or
+// remove subcommands.
+func CliCopy(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "add":
+		cliCopyAdd(cfg)
+	case "list":
+		cliCopyList(cfg)
+	case "move":
+		cliCopyMove(cfg)
+	case "remove":
+		cliCopyRemove(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: copy add|list|move|remove")
+	}
+}
+
+func cliCopyAdd(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("copy add", flag.ContinueOnError)
+	condition := flagSet.String("condition", "", "Condition, e.g. good")
+	acquired := flagSet.String("acquired", "", "Acquisition date YYYY-MM-dd")
+	price := flagSet.Float64("price", -1, "Price paid")
+	locationId := flagSet.Int("location", 0, "Location id")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: copy add <book id> [-condition text] [-acquired YYYY-MM-dd] [-price n] [-location id]")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(args[0], 10, 32)
+	PanicErrorHandler(err)
+
+	bookCopy := v1.Copy{BookId: int(idInt64)}
+
+	if *condition != "" {
+		bookCopy.Condition = condition
+	}
+
+	if *acquired != "" {
+		acquiredTs, err := time.Parse("2006-01-02", *acquired)
+
+		if err != nil {
+			log.Panic("invalid time format (must match YYYY-MM-dd)")
+		}
+
+		bookCopy.AcquiredTs = &acquiredTs
+	}
+
+	if *price >= 0 {
+		bookCopy.Price = price
+	}
+
+	if *locationId > 0 {
+		bookCopy.LocationId = locationId
+	}
+
+	id, err := cfg.Goshelf.CopyCreate(&bookCopy)
+	PanicErrorHandler(err)
+
+	fmt.Printf("%v", *id)
+}
+
+func cliCopyList(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("copy list", flag.ContinueOnError)
+	bookId := flagSet.Int("book", 0, "Only copies of this book")
+	locationId := flagSet.Int("location", 0, "Only copies in this location or locations inside it")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	filter := &v1.CopyFilter{}
+
+	if *bookId > 0 {
+		filter.BookId = bookId
+	}
+
+	if *locationId > 0 {
+		filter.LocationId = locationId
+	}
+
+	copies, err := cfg.Goshelf.CopyList(filter)
 	PanicErrorHandler(err)
+
+	for _, bookCopy := range copies {
+		json, err := json.Marshal(bookCopy)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Moves a copy. Usage: copy move <copy id> <location id|none>
+func cliCopyMove(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: copy move <copy id> <location id|none>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	var locationId *int
+
+	if cfg.Args[2] != "none" {
+		locInt64, err := strconv.ParseInt(cfg.Args[2], 10, 32)
+		PanicErrorHandler(err)
+
+		loc := int(locInt64)
+		locationId = &loc
+	}
+
+	err = cfg.Goshelf.CopyMove(int(idInt64), locationId)
+	PanicErrorHandler(err)
+}
+
+func cliCopyRemove(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: copy remove <copy id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	err = cfg.Goshelf.CopyRemove(int(idInt64))
+	PanicErrorHandler(err)
+}
+
+// Manages the locations copies are kept in. Expects one of the add, list
+// or remove subcommands.
+func CliLocation(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "add":
+		cliLocationAdd(cfg)
+	case "list":
+		cliLocationList(cfg)
+	case "remove":
+		cliLocationRemove(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: location add|list|remove")
+	}
+}
+
+func cliLocationAdd(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("location add", flag.ContinueOnError)
+	kind := flagSet.String("kind", "", "One of "+strings.Join(v1.LocationKinds, ", ")+" (default the kind below the parent's)")
+	parentId := flagSet.Int("parent", 0, "Id of the location this is inside")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: location add <name> [-kind kind] [-parent id]")
+		return
+	}
+
+	loc := v1.Location{
+		Name: strings.Join(args, " "),
+		Kind: *kind,
+	}
+
+	if *parentId > 0 {
+		loc.ParentId = parentId
+	}
+
+	id, err := cfg.Goshelf.LocationCreate(&loc)
+	PanicErrorHandler(err)
+
+	fmt.Printf("%v", *id)
+}
+
+func cliLocationList(cfg *GoshelfConfig) {
+	locs, err := cfg.Goshelf.LocationList()
+	PanicErrorHandler(err)
+
+	for _, loc := range locs {
+		json, err := json.Marshal(loc)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+func cliLocationRemove(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: location remove <location id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	err = cfg.Goshelf.LocationRemove(int(idInt64))
+	PanicErrorHandler(err)
+}
+
+// Manages series. Expects one of the create, list, get, add, drop, next or
+// remove subcommands.
+func CliSeries(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "create":
+		cliSeriesCreate(cfg)
+	case "list":
+		cliSeriesList(cfg)
+	case "get":
+		cliSeriesGet(cfg)
+	case "add":
+		cliSeriesAdd(cfg)
+	case "drop":
+		cliSeriesDrop(cfg)
+	case "next":
+		cliSeriesNext(cfg)
+	case "remove":
+		cliSeriesRemove(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: series create|list|get|add|drop|next|remove")
+	}
+}
+
+// Parses the integer arguments of a series subcommand, printing usage if
+// there are too few.
+func seriesIdArgs(cfg *GoshelfConfig, count int, usage string) []int {
+	if len(cfg.Args) < count+1 {
+		fmt.Fprintln(os.Stderr, "usage: series "+usage)
+		return nil
+	}
+
+	ids := make([]int, count)
+
+	for i := range ids {
+		idInt64, err := strconv.ParseInt(cfg.Args[i+1], 10, 32)
+		PanicErrorHandler(err)
+
+		ids[i] = int(idInt64)
+	}
+
+	return ids
+}
+
+func cliSeriesCreate(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("series create", flag.ContinueOnError)
+	description := flagSet.String("description", "", "Description of the series")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: series create <name> [-description text]")
+		return
+	}
+
+	series := v1.Series{Name: strings.Join(args, " ")}
+
+	if *description != "" {
+		series.Description = description
+	}
+
+	id, err := cfg.Goshelf.SeriesCreate(&series)
+	PanicErrorHandler(err)
+
+	fmt.Printf("%v", *id)
+}
+
+func cliSeriesList(cfg *GoshelfConfig) {
+	series, err := cfg.Goshelf.SeriesList()
+	PanicErrorHandler(err)
+
+	for _, s := range series {
+		json, err := json.Marshal(s)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Prints a series with its books in series order.
+func cliSeriesGet(cfg *GoshelfConfig) {
+	ids := seriesIdArgs(cfg, 1, "get <series id>")
+	if ids == nil {
+		return
+	}
+
+	series, err := cfg.Goshelf.SeriesGet(ids[0])
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(series)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Puts a book in a series. Usage: series add <series id> <book id> <position>
+func cliSeriesAdd(cfg *GoshelfConfig) {
+	usage := "add <series id> <book id> <position>"
+
+	ids := seriesIdArgs(cfg, 2, usage)
+	if ids == nil {
+		return
+	}
+
+	if len(cfg.Args) < 4 {
+		fmt.Fprintln(os.Stderr, "usage: series "+usage)
+		return
+	}
+
+	position, err := strconv.ParseFloat(cfg.Args[3], 64)
+	PanicErrorHandler(err)
+
+	err = cfg.Goshelf.SeriesSetBook(ids[0], ids[1], position)
+	PanicErrorHandler(err)
+}
+
+func cliSeriesDrop(cfg *GoshelfConfig) {
+	ids := seriesIdArgs(cfg, 2, "drop <series id> <book id>")
+	if ids == nil {
+		return
+	}
+
+	err := cfg.Goshelf.SeriesRemoveBook(ids[0], ids[1])
+	PanicErrorHandler(err)
+}
+
+// Prints the next book in the series the user hasn't read.
+func cliSeriesNext(cfg *GoshelfConfig) {
+	ids := seriesIdArgs(cfg, 1, "next <series id>")
+	if ids == nil {
+		return
+	}
+
+	book, err := cfg.Goshelf.SeriesNextUnread(ids[0])
+	PanicErrorHandler(err)
+
+	if book == nil {
+		fmt.Println("no unread books in the series")
+		return
+	}
+
+	json, err := json.Marshal(book)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+func cliSeriesRemove(cfg *GoshelfConfig) {
+	ids := seriesIdArgs(cfg, 1, "remove <series id>")
+	if ids == nil {
+		return
+	}
+
+	err := cfg.Goshelf.SeriesRemove(ids[0])
+	PanicErrorHandler(err)
+}
+
+// Shows or sets reviews of a book. Usage: review <book id> [-rating n] [-edit]
+// Without flags every review of the book is printed. -edit opens the
+// user's review in $EDITOR.
+func CliReview(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("review", flag.ContinueOnError)
+	rating := flagSet.Float64("rating", 0, "Rating from 0.5 to 5 in half stars")
+	edit := flagSet.Bool("edit", false, "Write the review in $EDITOR")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: review <book id> [-rating n] [-edit]")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(args[0], 10, 32)
+	PanicErrorHandler(err)
+
+	bookId := int(idInt64)
+
+	reviews, err := cfg.Goshelf.ReviewList(bookId)
+	PanicErrorHandler(err)
+
+	if *rating == 0 && !*edit {
+		for _, review := range reviews {
+			json, err := json.Marshal(review)
+			PanicErrorHandler(err)
+
+			fmt.Println(string(json))
+		}
+
+		return
+	}
+
+	review := v1.Review{BookId: bookId}
+
+	if *rating != 0 {
+		review.Rating = rating
+	}
+
+	if *edit {
+		body := ""
+
+		for _, existing := range reviews {
+			if existing.Username == cfg.Username && existing.Body != nil {
+				body = *existing.Body
+			}
+		}
+
+		review.Body, err = cli.EditText(body)
+		PanicErrorHandler(err)
+	}
+
+	saved, err := cfg.Goshelf.ReviewSet(&review)
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(saved)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Manages private notes on books. Expects one of the add, list, edit or
+// remove subcommands. Note bodies are written in $EDITOR.
+func CliNote(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "add":
+		cliNoteAdd(cfg)
+	case "list":
+		cliNoteList(cfg)
+	case "edit":
+		cliNoteEdit(cfg)
+	case "remove":
+		cliNoteRemove(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: note add|list|edit|remove")
+	}
+}
+
+// Parses a note subcommand's id argument and page and highlight flags.
+// Returns a nil id if it is missing.
+func parseNoteFlags(cfg *GoshelfConfig, name string) (id *int, page *int, highlight *string) {
+	flagSet := flag.NewFlagSet("note "+name, flag.ContinueOnError)
+	pageFlag := flagSet.Int("page", 0, "Page the note refers to")
+	highlightFlag := flagSet.String("highlight", "", "Passage quoted from the page")
+
+	positional, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	if len(positional) < 1 {
+		return nil, nil, nil
+	}
+
+	idInt64, err := strconv.ParseInt(positional[0], 10, 32)
+	PanicErrorHandler(err)
+
+	if *pageFlag > 0 {
+		page = pageFlag
+	}
+
+	if *highlightFlag != "" {
+		highlight = highlightFlag
+	}
+
+	idInt := int(idInt64)
+
+	return &idInt, page, highlight
+}
+
+func cliNoteAdd(cfg *GoshelfConfig) {
+	bookId, page, highlight := parseNoteFlags(cfg, "add")
+
+	if bookId == nil {
+		fmt.Fprintln(os.Stderr, "usage: note add <book id> [-page n] [-highlight text]")
+		return
+	}
+
+	body, err := cli.EditText("")
+	PanicErrorHandler(err)
+
+	note := v1.Note{
+		BookId:    *bookId,
+		Page:      page,
+		Highlight: highlight,
+		Body:      *body,
+	}
+
+	id, err := cfg.Goshelf.NoteCreate(&note)
+	PanicErrorHandler(err)
+
+	fmt.Printf("%v", *id)
+}
+
+func cliNoteList(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: note list <book id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	notes, err := cfg.Goshelf.NoteList(int(idInt64))
+	PanicErrorHandler(err)
+
+	for _, note := range notes {
+		json, err := json.Marshal(note)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Opens a note in $EDITOR. -page and -highlight replace those fields.
+func cliNoteEdit(cfg *GoshelfConfig) {
+	noteId, page, highlight := parseNoteFlags(cfg, "edit")
+
+	if noteId == nil {
+		fmt.Fprintln(os.Stderr, "usage: note edit <note id> [-page n] [-highlight text]")
+		return
+	}
+
+	note, err := cfg.Goshelf.NoteGet(*noteId)
+	PanicErrorHandler(err)
+
+	if note == nil {
+		log.Panic("note not found")
+	}
+
+	if page != nil {
+		note.Page = page
+	}
+
+	if highlight != nil {
+		note.Highlight = highlight
+	}
+
+	body, err := cli.EditText(note.Body)
+	PanicErrorHandler(err)
+
+	note.Body = *body
+
+	err = cfg.Goshelf.NoteUpdate(note)
+	PanicErrorHandler(err)
+}
+
+func cliNoteRemove(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: note remove <note id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	err = cfg.Goshelf.NoteRemove(int(idInt64))
+	PanicErrorHandler(err)
+}
+
+// Manages works, the groups of editions of a book. Expects one of the
+// list, get, group or suggest subcommands.
+func CliWork(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "list":
+		cliWorkList(cfg)
+	case "get":
+		cliWorkGet(cfg)
+	case "group":
+		cliWorkGroup(cfg)
+	case "suggest":
+		cliWorkSuggest(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: work list|get|group|suggest")
+	}
+}
+
+func cliWorkList(cfg *GoshelfConfig) {
+	works, err := cfg.Goshelf.WorkList()
+	PanicErrorHandler(err)
+
+	for _, work := range works {
+		json, err := json.Marshal(work)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Prints a work with its editions.
+func cliWorkGet(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: work get <work id>")
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[1], 10, 32)
+	PanicErrorHandler(err)
+
+	work, err := cfg.Goshelf.WorkGet(int(idInt64))
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(work)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Makes books editions of a work. Usage: work group <work id> <book id>...
+func cliWorkGroup(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: work group <work id> <book id>...")
+		return
+	}
+
+	ids := make([]int, 0, len(cfg.Args)-1)
+
+	for _, arg := range cfg.Args[1:] {
+		idInt64, err := strconv.ParseInt(arg, 10, 32)
+		PanicErrorHandler(err)
+
+		ids = append(ids, int(idInt64))
+	}
+
+	for _, bookId := range ids[1:] {
+		err := cfg.Goshelf.WorkSetBook(ids[0], bookId)
+		PanicErrorHandler(err)
+	}
+}
+
+// Suggests books to group into works by normalized title and author.
+// Usage: work suggest [-apply]
+// Each suggestion is printed as a work group command; -apply runs them.
+func cliWorkSuggest(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("work suggest", flag.ContinueOnError)
+	apply := flagSet.Bool("apply", false, "Group the suggested books")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	books, err := cfg.Goshelf.BookFilter(nil)
+	PanicErrorHandler(err)
+
+	for _, group := range v1.SuggestWorkGroups(books) {
+		workId := group[0].WorkId
+		bookIds := []string{}
+
+		for _, b := range group[1:] {
+			if b.WorkId != workId {
+				bookIds = append(bookIds, fmt.Sprint(b.BookId))
+			}
+		}
+
+		fmt.Printf("work group %d %s\t# %s\n", workId, strings.Join(bookIds, " "), group[0].Title)
+
+		if !*apply {
+			continue
+		}
+
+		for _, b := range group[1:] {
+			if b.WorkId != workId {
+				err := cfg.Goshelf.WorkSetBook(workId, b.BookId)
+				PanicErrorHandler(err)
+			}
+		}
+	}
+}
+
+// Lists books that are likely duplicates, most similar first.
+// Usage: dedupe [-threshold n] [-merge]
+// With -merge, each pair is confirmed and the newer book merged into the
+// older one, moving its collections, notes, loans and copies.
+func CliDedupe(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	threshold := flagSet.Float64("threshold", dedupe.DefaultThreshold, "Minimum title similarity, 0 to 1")
+	merge := flagSet.Bool("merge", false, "Prompt to merge each pair")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	books, err := cfg.Goshelf.BookFilter(nil)
+	PanicErrorHandler(err)
+
+	merged := map[int]bool{}
+
+	for _, pair := range dedupe.Find(books, *threshold) {
+		// A book merged away earlier can't be merged again
+		if merged[pair.Keep.BookId] || merged[pair.Drop.BookId] {
+			continue
+		}
+
+		json, err := json.Marshal(pair)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+
+		if !*merge {
+			continue
+		}
+
+		prompt := fmt.Sprintf("\tMerge book %d into book %d?", pair.Drop.BookId, pair.Keep.BookId)
+		ok, err := cli.GetCliConfirm(prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		if !ok {
+			continue
+		}
+
+		err = cfg.Goshelf.BookMerge(pair.Keep.BookId, pair.Drop.BookId)
+		PanicErrorHandler(err)
+
+		merged[pair.Drop.BookId] = true
+	}
+}
+
+func CliCollectionCreate(cfg *GoshelfConfig) {
+	prompt := "\tEnter collection title: "
+	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	bookIds := []int{}
+
+	for {
+		prompt := "\tEnter book id (press enter when finished): "
+		bookId, err := cli.GetIntFromCli(&prompt, os.Stdin, os.Stdout)
+		PanicErrorHandler(err)
+
+		if bookId == nil {
+			break
+		}
+
+		bookIds = append(bookIds, *bookId)
+	}
+
+	_, err = cfg.Goshelf.CollectionCreate(title, bookIds)
+	PanicErrorHandler(err)
+}
+
+// Prints a collection. Usage: collectionget [-recursive]
+// With -recursive, the books of collections nested under it are included.
+func CliCollectionGet(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("collectionget", flag.ContinueOnError)
+	recursive := flagSet.Bool("recursive", false, "Include books of nested collections")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	prompt := "\tEnter collection title: "
+	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	var col *v1.Collection
+
+	if *recursive {
+		col, err = cfg.Goshelf.CollectionGetRecursive(title)
+	} else {
+		col, err = cfg.Goshelf.CollectionGet(title)
+	}
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(col)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Reorders a collection. Usage: collectionorder <title> <book id>...
+// Every book in the collection must be listed once, in the new order.
+func CliCollectionOrder(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: collectionorder <title> <book id>...")
+		return
+	}
+
+	title := cfg.Args[0]
+	bookIds := make([]int, 0, len(cfg.Args)-1)
+
+	for _, arg := range cfg.Args[1:] {
+		idInt64, err := strconv.ParseInt(arg, 10, 32)
+		PanicErrorHandler(err)
+
+		bookIds = append(bookIds, int(idInt64))
+	}
+
+	err := cfg.Goshelf.CollectionReorder(&title, bookIds)
+	PanicErrorHandler(err)
+}
+
+// Moves a book within a collection or sets its note.
+// Usage: collectionbook <title> <book id> [-position n] [-note text | -clear-note]
+func CliCollectionBook(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("collectionbook", flag.ContinueOnError)
+	position := flagSet.Int("position", 0, "Move the book to this position, 1 for first")
+	note := flagSet.String("note", "", "Set the book's note in the collection")
+	clearNote := flagSet.Bool("clear-note", false, "Remove the book's note")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	if len(args) < 2 || (*position == 0 && *note == "" && !*clearNote) {
+		fmt.Fprintln(os.Stderr, "usage: collectionbook <title> <book id> [-position n] [-note text | -clear-note]")
+		return
+	}
+
+	title := args[0]
+	bookIdInt64, err := strconv.ParseInt(args[1], 10, 32)
+	PanicErrorHandler(err)
+	bookId := int(bookIdInt64)
+
+	if *clearNote {
+		err = cfg.Goshelf.CollectionSetNote(&title, bookId, nil)
+		PanicErrorHandler(err)
+	} else if *note != "" {
+		err = cfg.Goshelf.CollectionSetNote(&title, bookId, note)
+		PanicErrorHandler(err)
+	}
+
+	if *position != 0 {
+		err = cfg.Goshelf.CollectionMoveBook(&title, bookId, *position)
+		PanicErrorHandler(err)
+	}
+}
+
+// Prints the user's collections as a tree.
+func CliCollectionTree(cfg *GoshelfConfig) {
+	roots, err := cfg.Goshelf.CollectionTree()
+	PanicErrorHandler(err)
+
+	printCollectionTree(os.Stdout, roots, "")
+}
+
+// Writes collections and their children to w, one per line, with box
+// drawing lines under prefix.
+func printCollectionTree(w io.Writer, collections []v1.Collection, prefix string) {
+	for i, c := range collections {
+		branch, indent := "├── ", "│   "
+
+		if i == len(collections)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		label := c.Title
+
+		if c.Smart {
+			label += " [smart]"
+		}
+
+		fmt.Fprintln(w, prefix+branch+label)
+
+		printCollectionTree(w, c.Children, prefix+indent)
+	}
+}
+
+// Moves a collection and everything under it.
+// Usage: collectionmove <title> [parent title]
+// Without a parent, the collection becomes a root collection.
+func CliCollectionMove(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: collectionmove <title> [parent title]")
+		return
+	}
+
+	title := cfg.Args[0]
+	var parent *string
+
+	if len(cfg.Args) > 1 {
+		parent = &cfg.Args[1]
+	}
+
+	err := cfg.Goshelf.CollectionSetParent(&title, parent)
+	PanicErrorHandler(err)
+}
+
+// Renames a collection or updates its metadata. An empty description or
+// cover clears it.
+// Usage: collectionupdate <title> [-title new] [-description text] [-cover url] [-visibility public|private]
+func CliCollectionUpdate(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("collectionupdate", flag.ContinueOnError)
+	newTitle := flagSet.String("title", "", "Rename the collection")
+	description := flagSet.String("description", "", "Set the collection's description")
+	cover := flagSet.String("cover", "", "Set the collection's cover image URL")
+	visibility := flagSet.String("visibility", "", "Either public or private")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	update := v1.CollectionUpdate{}
+
+	// Only flags that were given are updated
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title":
+			update.Title = newTitle
+		case "description":
+			update.Description = description
+		case "cover":
+			update.CoverUrl = cover
+		}
+	})
+
+	switch *visibility {
+	case "":
+	case "public", "private":
+		public := *visibility == "public"
+		update.Public = &public
+	default:
+		args = nil
+	}
+
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: collectionupdate <title> [-title new] [-description text] [-cover url] [-visibility public|private]")
+		return
+	}
+
+	col, err := cfg.Goshelf.CollectionGet(&args[0])
+	PanicErrorHandler(err)
+
+	if col == nil {
+		fmt.Fprintln(os.Stderr, "collection not found")
+		return
+	}
+
+	col, err = cfg.Goshelf.CollectionUpdate(col.CollectionId, &update)
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(col)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Moves a collection to the trash after showing it and asking to confirm.
+// Usage: collectionremove [title] [-yes]
+// The title is prompted for if not given. -yes skips the confirmation.
+func CliCollectionRemove(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("collectionremove", flag.ContinueOnError)
+	yes := flagSet.Bool("yes", false, "Remove without asking to confirm")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	var title *string
+
+	if len(args) > 0 {
+		joined := strings.Join(args, " ")
+		title = &joined
+	} else {
+		prompt := "\tEnter collection title: "
+		title, err = cli.GetCliPrompt(&prompt, os.Stdin)
+		PanicErrorHandler(err)
+	}
+
+	collection, err := cfg.Goshelf.CollectionGet(title)
+	PanicErrorHandler(err)
+
+	if collection == nil {
+		PanicErrorHandler(errors.New("collection not found"))
+	}
+
+	if !*yes {
+		prompt := fmt.Sprintf("\tRemove collection %q with %d books?", collection.Title, len(collection.Books))
+		ok, err := cli.GetCliConfirm(prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		if !ok {
+			return
+		}
+	}
+
+	err = cfg.Goshelf.CollectionRemove(&collection.Title)
+	PanicErrorHandler(err)
+}
+
+// Shares a collection from the cli. With no subcommand (or create) a new
+// share link is created and its URL printed. The list, revoke, public and
+// private subcommands manage existing links and public visibility.
+func CliCollectionShare(cfg *GoshelfConfig) {
+	subcommand := "create"
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "create":
+		cliCollectionShareCreate(cfg)
+	case "list":
+		cliCollectionShareList(cfg)
+	case "revoke":
+		cliCollectionShareRevoke(cfg)
+	case "public":
+		cliCollectionSetPublic(cfg, true)
+	case "private":
+		cliCollectionSetPublic(cfg, false)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: collectionshare [create|list|revoke|public|private]")
+	}
+}
+
+func cliCollectionShareCreate(cfg *GoshelfConfig) {
+	prompt := "\tEnter collection title: "
+	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter days until the link expires (optional): "
+	days, err := cli.GetIntFromCli(&prompt, os.Stdin, os.Stdout)
+	PanicErrorHandler(err)
+
+	var expiresTs *time.Time
+
+	if days != nil {
+		expires := time.Now().AddDate(0, 0, *days)
+		expiresTs = &expires
+	}
+
+	token, prefix, tokenHash, err := GenerateShareToken()
+	PanicErrorHandler(err)
+
+	_, err = cfg.Goshelf.CollectionShareCreate(title, prefix, tokenHash, expiresTs)
+	PanicErrorHandler(err)
+
+	fmt.Println(ShareUrl(cfg, token))
+}
+
+func cliCollectionShareList(cfg *GoshelfConfig) {
+	prompt := "\tEnter collection title: "
+	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	shares, err := cfg.Goshelf.CollectionShareList(title)
+	PanicErrorHandler(err)
+
+	for _, share := range shares {
+		json, err := json.Marshal(share)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+func cliCollectionShareRevoke(cfg *GoshelfConfig) {
+	prompt := "\tEnter share id: "
+	id, err := cli.GetIntFromCli(&prompt, os.Stdin, os.Stdout)
+	PanicErrorHandler(err)
+
+	if id == nil {
+		return
+	}
+
+	err = cfg.Goshelf.CollectionShareRevoke(*id)
+	PanicErrorHandler(err)
+}
+
+func cliCollectionSetPublic(cfg *GoshelfConfig, public bool) {
+	prompt := "\tEnter collection title: "
+	title, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	err = cfg.Goshelf.CollectionSetPublic(title, public)
+	PanicErrorHandler(err)
+
+	if public {
+		fmt.Println(ShareUrl(cfg, cfg.Username+"/"+url.PathEscape(*title)))
+	}
+}
+
+// Manages API keys from the cli. Expects one of the create, list or
+// revoke subcommands.
+func CliApiKey(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "create":
+		cliApiKeyCreate(cfg)
+	case "list":
+		cliApiKeyList(cfg)
+	case "revoke":
+		cliApiKeyRevoke(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: apikey create|list|revoke")
+	}
+}
+
+func cliApiKeyCreate(cfg *GoshelfConfig) {
+	prompt := "\tEnter key name: "
+	name, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter scope, " + v1.ApiKeyScopeRead + " or " + v1.ApiKeyScopeReadWrite + " (default " + v1.ApiKeyScopeRead + "): "
+	scope, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	if *scope == "" {
+		*scope = v1.ApiKeyScopeRead
+	}
+
+	if *scope != v1.ApiKeyScopeRead && *scope != v1.ApiKeyScopeReadWrite {
+		log.Panic("invalid scope (must be " + v1.ApiKeyScopeRead + " or " + v1.ApiKeyScopeReadWrite + ")")
+	}
+
+	prompt = "\tEnter username to create key for (default current user): "
+	username, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	secret, prefix, keyHash, err := GenerateApiKey()
+	PanicErrorHandler(err)
+
+	key := v1.ApiKey{
+		Name:   *name,
+		Prefix: prefix,
+		Scope:  *scope,
+	}
+
+	if *username != "" {
+		user, err := cfg.Goshelf.UserGetByName(*username)
+		PanicErrorHandler(err)
+
+		if user == nil {
+			log.Panic("user not found")
+		}
+
+		key.UserId = user.UserId
+	}
+
+	id, err := cfg.Goshelf.ApiKeyCreate(&key, keyHash)
+	PanicErrorHandler(err)
+
+	fmt.Printf("id: %v\n", *id)
+	fmt.Println("key: " + secret)
+	fmt.Println("Store this key now, it cannot be shown again.")
+}
+
+func cliApiKeyList(cfg *GoshelfConfig) {
+	keys, err := cfg.Goshelf.ApiKeyList()
+	PanicErrorHandler(err)
+
+	for _, key := range keys {
+		json, err := json.Marshal(key)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+func cliApiKeyRevoke(cfg *GoshelfConfig) {
+	prompt := "\tEnter key id: "
+	id, err := cli.GetIntFromCli(&prompt, os.Stdin, os.Stdout)
+	PanicErrorHandler(err)
+
+	if id == nil {
+		return
+	}
+
+	err = cfg.Goshelf.ApiKeyRevoke(*id)
+	PanicErrorHandler(err)
+}
+
+// Manages users from the cli. Expects one of the create or list
+// subcommands.
+func CliUser(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "create":
+		cliUserCreate(cfg)
+	case "list":
+		cliUserList(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: user create|list")
+	}
+}
+
+func cliUserCreate(cfg *GoshelfConfig) {
+	prompt := "\tEnter username: "
+	username, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	prompt = "\tEnter role, " + v1.UserRoleAdmin + " or " + v1.UserRoleMember + " (default " + v1.UserRoleMember + "): "
+	role, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	if *role == "" {
+		*role = v1.UserRoleMember
+	}
+
+	if *role != v1.UserRoleAdmin && *role != v1.UserRoleMember {
+		log.Panic("invalid role (must be " + v1.UserRoleAdmin + " or " + v1.UserRoleMember + ")")
+	}
+
+	id, err := cfg.Goshelf.UserCreate(&v1.User{Username: *username, Role: *role})
+	PanicErrorHandler(err)
+
+	fmt.Printf("%v", *id)
+}
+
+func cliUserList(cfg *GoshelfConfig) {
+	users, err := cfg.Goshelf.UserList()
+	PanicErrorHandler(err)
+
+	for _, user := range users {
+		json, err := json.Marshal(user)
+		PanicErrorHandler(err)
+
+		fmt.Println(string(json))
+	}
+}
+
+// Manages the remote contexts in the user's profile. Expects one of the
+// list, current, set, use, remove or unset subcommands; set, use and
+// remove take the context name as an argument or prompt for it.
+func CliContext(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	path, err := ProfilePath(cfg)
+	PanicErrorHandler(err)
+
+	profile, err := LoadProfile(path)
+	PanicErrorHandler(err)
+
+	switch subcommand {
+	case "list":
+		names := make([]string, 0, len(profile.Contexts))
+		for name := range profile.Contexts {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			c := profile.Contexts[name]
+			current := " "
+			if name == profile.CurrentContext {
+				current = "*"
+			}
+
+			fmt.Printf("%s %s\t%s\n", current, name, c.Server)
+		}
+		return
+	case "current":
+		fmt.Println(profile.CurrentContext)
+		return
+	case "set":
+		name := cliContextName(cfg)
+
+		prompt := "\tEnter server URL: "
+		server, err := cli.GetCliPrompt(&prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		prompt = "\tEnter API key (optional): "
+		token, err := cli.GetCliPrompt(&prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		profile.Contexts[name] = ProfileContext{Server: *server, Token: *token}
+
+		if profile.CurrentContext == "" {
+			profile.CurrentContext = name
+		}
+	case "use":
+		name := cliContextName(cfg)
+
+		if _, ok := profile.Contexts[name]; !ok {
+			log.Panic("context " + name + " not found")
+		}
+
+		profile.CurrentContext = name
+	case "remove":
+		name := cliContextName(cfg)
+
+		delete(profile.Contexts, name)
+
+		if profile.CurrentContext == name {
+			profile.CurrentContext = ""
+		}
+	case "unset":
+		// Without a current context the CLI uses the database directly
+		profile.CurrentContext = ""
+	default:
+		fmt.Fprintln(os.Stderr, "usage: context list|current|set|use|remove|unset [name]")
+		return
+	}
+
+	err = profile.Save(path)
+	PanicErrorHandler(err)
+}
+
+// Returns the context name given after the subcommand, prompting if missing.
+func cliContextName(cfg *GoshelfConfig) string {
+	if len(cfg.Args) > 1 {
+		return cfg.Args[1]
+	}
+
+	prompt := "\tEnter context name: "
+	name, err := cli.GetCliPrompt(&prompt, os.Stdin)
+	PanicErrorHandler(err)
+
+	if *name == "" {
+		log.Panic("context name required")
+	}
+
+	return *name
+}
+
+// Imports books from a file. Usage: import csv|goodreads|storygraph
+// <file> [-dry-run]
+func CliImport(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flagSet.Bool("dry-run", false, "Report what would be imported without creating books")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: import csv|goodreads|storygraph <file> [-dry-run]")
+		return
+	}
+
+	file, err := os.Open(args[1])
+	PanicErrorHandler(err)
+	defer file.Close()
+
+	report, err := importBooks(cfg.Goshelf, args[0], file, *dryRun)
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(report)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Exports all books. Usage: export csv [file], writing to stdout if no
+// file is given.
+func CliExport(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 1 || cfg.Args[0] != "csv" {
+		fmt.Fprintln(os.Stderr, "usage: export csv [file]")
+		return
+	}
+
+	books, err := cfg.Goshelf.BookFilter(nil)
+	PanicErrorHandler(err)
+
+	w := os.Stdout
+
+	if len(cfg.Args) > 1 {
+		file, err := os.Create(cfg.Args[1])
+		PanicErrorHandler(err)
+		defer file.Close()
+
+		w = file
+	}
+
+	err = bookcsv.Write(w, books)
+	PanicErrorHandler(err)
+}
+
+// Writes a backup archive of the user's books and collections. Usage:
+// backup <file>
+func CliBackup(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: backup <file>")
+		return
+	}
+
+	file, err := os.OpenFile(cfg.Args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	PanicErrorHandler(err)
+	defer file.Close()
+
+	err = backup.Backup(cfg.Goshelf, file)
+	PanicErrorHandler(err)
+
+	fmt.Printf("Backup written to %s\n", cfg.Args[0])
+}
+
+// Restores a backup archive. Usage: restore <file>
+func CliRestore(cfg *GoshelfConfig) {
+	if len(cfg.Args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: restore <file>")
+		return
+	}
+
+	file, err := os.Open(cfg.Args[0])
+	PanicErrorHandler(err)
+	defer file.Close()
+
+	report, err := backup.Restore(cfg.Goshelf, file)
+	PanicErrorHandler(err)
+
+	json, err := json.Marshal(report)
+	PanicErrorHandler(err)
+
+	fmt.Println(string(json))
+}
+
+// Prints audit log entries, newest first, one per line.
+// Usage: audit [-entity book|author|collection] [-id n] [-since time] [-until time] [-limit n] [-json]
+// Times are RFC 3339 or YYYY-MM-DD. With -json, entries are printed in
+// full with their before and after state.
+func CliAudit(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("audit", flag.ContinueOnError)
+	entity := flagSet.String("entity", "", "Only changes to book, author or collection")
+	entityId := flagSet.Int("id", 0, "Only changes to the entity with this id")
+	since := flagSet.String("since", "", "Only changes at or after this time")
+	until := flagSet.String("until", "", "Only changes before this time")
+	limit := flagSet.Int("limit", 50, "The number of entries to print, 0 for all")
+	asJson := flagSet.Bool("json", false, "Print entries as JSON")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	filter := &v1.AuditFilter{Limit: *limit}
+
+	if *entity != "" {
+		PanicErrorHandler(v1.ValidateAuditEntity(*entity))
+		filter.Entity = entity
+	}
+
+	if *entityId > 0 {
+		filter.EntityId = entityId
+	}
+
+	for _, t := range []struct {
+		value string
+		field **time.Time
+	}{
+		{*since, &filter.Since},
+		{*until, &filter.Until},
+	} {
+		if t.value == "" {
+			continue
+		}
+
+		parsed, err := v1.ParseAuditTime(t.value)
+		PanicErrorHandler(err)
+
+		*t.field = &parsed
+	}
+
+	entries, err := cfg.Goshelf.AuditList(filter)
+	PanicErrorHandler(err)
+
+	for _, entry := range entries {
+		if *asJson {
+			json, err := json.Marshal(entry)
+			PanicErrorHandler(err)
+
+			fmt.Println(string(json))
+			continue
+		}
+
+		line, err := formatAuditEntry(&entry)
+		PanicErrorHandler(err)
+
+		fmt.Println(line)
+	}
+}
+
+// Returns a one line summary of an audit log entry, e.g.
+// "2024-03-10T09:00:00Z alice update collection 7 (description, title)".
+func formatAuditEntry(e *v1.AuditEntry) (string, error) {
+	actor := "system"
+
+	if e.Actor != nil {
+		actor = *e.Actor
+	}
+
+	line := fmt.Sprintf("%s %s %s %s %d", e.CreatedTs.UTC().Format(time.RFC3339), actor, e.Action, e.Entity, e.EntityId)
+
+	if e.Action != v1.AuditActionUpdate {
+		return line, nil
+	}
+
+	changed, err := e.ChangedFields()
+
+	if err != nil {
+		return "", err
+	}
+
+	return line + " (" + strings.Join(changed, ", ") + ")", nil
+}
+
+// Manages removed books and collections. Expects one of the list, restore
+// or purge subcommands.
+func CliTrash(cfg *GoshelfConfig) {
+	subcommand := ""
+	if len(cfg.Args) > 0 {
+		subcommand = cfg.Args[0]
+	}
+
+	switch subcommand {
+	case "list":
+		cliTrashList(cfg)
+	case "restore":
+		cliTrashRestore(cfg)
+	case "purge":
+		cliTrashPurge(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: trash list|restore|purge")
+	}
+}
+
+func cliTrashList(cfg *GoshelfConfig) {
+	trash, err := cfg.Goshelf.TrashList()
+	PanicErrorHandler(err)
+
+	for _, b := range trash.Books {
+		fmt.Printf("book %d %s (removed %s)\n", b.BookId, b.Title, b.DeletedTs.Format(time.RFC3339))
+	}
+
+	for _, c := range trash.Collections {
+		fmt.Printf("collection %d %s (removed %s)\n", c.CollectionId, c.Title, c.DeletedTs.Format(time.RFC3339))
+	}
+}
+
+func cliTrashRestore(cfg *GoshelfConfig) {
+	usage := "usage: trash restore book|collection <id>"
+
+	if len(cfg.Args) < 3 {
+		fmt.Fprintln(os.Stderr, usage)
+		return
+	}
+
+	idInt64, err := strconv.ParseInt(cfg.Args[2], 10, 32)
+	PanicErrorHandler(err)
+
+	switch cfg.Args[1] {
+	case "book":
+		err = cfg.Goshelf.TrashRestoreBook(int(idInt64))
+	case "collection":
+		err = cfg.Goshelf.TrashRestoreCollection(int(idInt64))
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return
+	}
+
+	PanicErrorHandler(err)
+}
+
+// Usage: trash purge [-all] [-yes]
+// Purges what is older than the -trashretention flag, or everything with
+// -all, after asking to confirm. -yes skips the confirmation.
+func cliTrashPurge(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("trash purge", flag.ContinueOnError)
+	all := flagSet.Bool("all", false, "Purge everything in the trash")
+	yes := flagSet.Bool("yes", false, "Purge without asking to confirm")
+
+	_, err := parseCommandFlags(flagSet, cfg.Args[1:])
+	PanicErrorHandler(err)
+
+	var before *time.Time
+	prompt := "\tDelete everything in the trash for good?"
+
+	if !*all {
+		before = v1.TrashPurgeCutoff(time.Now(), cfg.TrashRetention)
+
+		if before == nil {
+			fmt.Fprintln(os.Stderr, "-trashretention is 0, use -all to purge everything")
+			return
+		}
+
+		prompt = "\tDelete what was trashed before " + before.Format(time.RFC3339) + " for good?"
+	}
+
+	if !*yes {
+		ok, err := cli.GetCliConfirm(prompt, os.Stdin)
+		PanicErrorHandler(err)
+
+		if !ok {
+			return
+		}
+	}
+
+	report, err := cfg.Goshelf.TrashPurge(before)
+	PanicErrorHandler(err)
+
+	fmt.Printf("Purged %d books and %d collections\n", report.Books, report.Collections)
+}
+
+// Reverses the current user's last changes to books and collections after
+// listing them and asking to confirm.
+// Usage: undo [n] [-yes]
+// n defaults to 1. -yes skips the confirmation.
+func CliUndo(cfg *GoshelfConfig) {
+	flagSet := flag.NewFlagSet("undo", flag.ContinueOnError)
+	yes := flagSet.Bool("yes", false, "Undo without asking to confirm")
+
+	args, err := parseCommandFlags(flagSet, cfg.Args)
+	PanicErrorHandler(err)
+
+	count := 1
+
+	if len(args) > 0 {
+		countInt64, err := strconv.ParseInt(args[0], 10, 32)
+		PanicErrorHandler(err)
+
+		count = int(countInt64)
+	}
+
+	entries, err := cfg.Goshelf.UndoList(count)
+	PanicErrorHandler(err)
+
+	if len(entries) < 1 {
+		fmt.Println("Nothing to undo")
+		return
+	}
+
+	for _, entry := range entries {
+		line, err := formatAuditEntry(&entry)
+		PanicErrorHandler(err)
+
+		fmt.Println(line)
+	}
+
+	if !*yes {
+		ok, err := cli.GetCliConfirm(fmt.Sprintf("\tUndo these %d changes?", len(entries)), os.Stdin)
+		PanicErrorHandler(err)
+
+		if !ok {
+			return
+		}
+	}
+
+	// Exactly what was shown is undone, or nothing if it has changed since
+	auditIds := make([]int, len(entries))
+
+	for i, entry := range entries {
+		auditIds[i] = entry.AuditId
+	}
+
+	undone, err := cfg.Goshelf.Undo(auditIds)
+	PanicErrorHandler(err)
+
+	fmt.Printf("Undid %d changes\n", len(undone))
 }
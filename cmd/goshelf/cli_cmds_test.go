@@ -0,0 +1,60 @@
+package goshelf
+
+import (
+	"bytes"
+	"time"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CLI commands", func() {
+	It("should draw nested collections as a tree", func() {
+		var out bytes.Buffer
+
+		printCollectionTree(&out, []v1.Collection{
+			{Title: "courses", Children: []v1.Collection{
+				{Title: "algorithms", Children: []v1.Collection{{Title: "week-1"}}},
+				{Title: "unread", Smart: true},
+			}},
+			{Title: "favorites"},
+		}, "")
+
+		Expect(out.String()).To(Equal("" +
+			"├── courses\n" +
+			"│   ├── algorithms\n" +
+			"│   │   └── week-1\n" +
+			"│   └── unread [smart]\n" +
+			"└── favorites\n"))
+	})
+
+	It("should summarize audit entries on one line", func() {
+		actor := "alice"
+		ts := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+
+		line, err := formatAuditEntry(&v1.AuditEntry{
+			CreatedTs: ts,
+			Actor:     &actor,
+			Entity:    v1.AuditEntityCollection,
+			EntityId:  7,
+			Action:    v1.AuditActionUpdate,
+			Before:    []byte(`{"title": "sf", "public": false}`),
+			After:     []byte(`{"title": "Sci-Fi", "public": false, "description": "Space"}`),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(line).To(Equal("2024-03-10T09:00:00Z alice update collection 7 (description, title)"))
+
+		line, err = formatAuditEntry(&v1.AuditEntry{CreatedTs: ts, Entity: v1.AuditEntityBook, EntityId: 3, Action: v1.AuditActionDelete})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(line).To(Equal("2024-03-10T09:00:00Z system delete book 3"))
+	})
+
+	It("should describe books in prompts", func() {
+		book := &v1.Book{BookId: 12, Title: "Dune", Author: v1.Author{FirstName: "Frank", LastName: "Herbert"}}
+		Expect(describeBook(book)).To(Equal(`12 "Dune" by Frank Herbert`))
+
+		book.Author = v1.Author{}
+		Expect(describeBook(book)).To(Equal(`12 "Dune"`))
+	})
+})
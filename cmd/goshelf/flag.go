@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"io"
+
+	"github.com/Max-Clark/goshelf/cmd/metadata"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 )
 
 func PrintFlagUsage(w io.Writer, flagSet *flag.FlagSet) {
@@ -22,6 +25,23 @@ func GetFlagSet(args []string, cfg *GoshelfConfig) *flag.FlagSet {
 	gsFlagSet.StringVar(&cfg.Host, "s", "0.0.0.0", "API mode: Host address, default 0.0.0.0")
 	gsFlagSet.IntVar(&cfg.Port, "p", 8080, "API mode: Host port, default 8080")
 	gsFlagSet.BoolVar(&cfg.RunApi, "a", false, "Run in API mode, default false")
+	gsFlagSet.StringVar(&cfg.TlsCert, "tlscert", "", "API mode: TLS certificate file, enables HTTPS (reloaded on SIGHUP)")
+	gsFlagSet.StringVar(&cfg.TlsKey, "tlskey", "", "API mode: TLS private key file")
+	gsFlagSet.StringVar(&cfg.TlsClientCa, "tlsca", "", "API mode: CA file to require and verify client certificates")
+	gsFlagSet.StringVar(&cfg.Socket, "socket", "", "API mode: Listen on this Unix socket instead of host/port")
+	gsFlagSet.StringVar(&cfg.SocketMode, "socketmode", "0660", "API mode: Unix socket permissions, default 0660")
+	gsFlagSet.BoolVar(&cfg.AnonymousRead, "anon", false, "API mode: Allow unauthenticated read-only requests, default false")
+	gsFlagSet.DurationVar(&cfg.TrashRetention, "trashretention", v1.DefaultTrashRetention, "How long removed books and collections stay in the trash, 0 to keep them until purged, default 720h")
+
+	gsFlagSet.StringVar(&cfg.BaseUrl, "url", "", "Public base URL of the API server used in share links, default http://<host>:<port>")
+	gsFlagSet.StringVar(&cfg.Username, "user", "admin", "CLI mode: User to act as, default admin")
+	gsFlagSet.StringVar(&cfg.Remote, "remote", "", "CLI mode: Use the goshelf API server at this URL instead of the database")
+	gsFlagSet.StringVar(&cfg.Context, "context", "", "CLI mode: Use this profile context, default the current context")
+	gsFlagSet.StringVar(&cfg.ProfilePath, "profile", "", "CLI mode: Profile file, default $GOSHELF_PROFILE or <config dir>/goshelf/profile.json")
+
+	gsFlagSet.StringVar(&cfg.MetadataUrl, "metaurl", metadata.DefaultOpenLibraryUrl, "Open Library compatible API for metadata lookups, default "+metadata.DefaultOpenLibraryUrl)
+	gsFlagSet.StringVar(&cfg.MetadataDump, "metadump", "", "Open Library editions dump for metadata lookups, used instead of -metaurl")
+	gsFlagSet.StringVar(&cfg.MetadataAuthors, "metaauthors", "", "Open Library authors dump to resolve author names with -metadump")
 
 	gsFlagSet.StringVar(&cfg.DbConfig.Host, "dh", "0.0.0.0", "Database address, default 0.0.0.0")
 	gsFlagSet.IntVar(&cfg.DbConfig.Port, "dp", 5432, "Database port, default 5432")
@@ -29,6 +49,9 @@ func GetFlagSet(args []string, cfg *GoshelfConfig) *flag.FlagSet {
 	gsFlagSet.StringVar(&cfg.DbConfig.Password, "dpw", "", "Database password, default \"\"")
 	gsFlagSet.StringVar(&cfg.DbConfig.DbName, "dn", "postgres", "Database name, default postgres")
 	gsFlagSet.StringVar(&cfg.DbConfig.SslMode, "ds", "disable", "Database SSL mode, default postgres")
+	gsFlagSet.StringVar(&cfg.DbConfig.SslRootCert, "dsrc", "", "Database SSL root certificate file, default \"\"")
+	gsFlagSet.StringVar(&cfg.DbConfig.SslCert, "dscert", "", "Database SSL client certificate file, default \"\"")
+	gsFlagSet.StringVar(&cfg.DbConfig.SslKey, "dskey", "", "Database SSL client key file, default \"\"")
 
 	return gsFlagSet
 }
@@ -5,49 +5,104 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/Max-Clark/goshelf/cmd/client"
 	"github.com/Max-Clark/goshelf/cmd/db"
 	pg "github.com/Max-Clark/goshelf/cmd/db/postgresql"
+	"github.com/Max-Clark/goshelf/cmd/metadata"
 	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
 )
 
 const SchemaVersion = "v1"
 
 type GoshelfConfig struct {
-	RunApi   bool
-	Host     string
-	Port     int
-	DbConfig db.ConnectionConfig
-	Goshelf  GoshelfQuerier
+	RunApi          bool
+	Host            string
+	Port            int
+	TlsCert         string // API mode: PEM certificate, enables HTTPS
+	TlsKey          string // API mode: PEM private key for TlsCert
+	TlsClientCa     string // API mode: PEM CA bundle, enables mutual TLS
+	Socket          string // API mode: Unix socket path, replaces Host/Port
+	SocketMode      string // API mode: octal permissions for Socket
+	AnonymousRead   bool
+	BaseUrl         string        // Public URL of the API server, used in share links
+	Username        string        // CLI mode: user to act as
+	Remote          string        // CLI mode: goshelf API server to use instead of the database
+	Context         string        // CLI mode: profile context to use
+	ProfilePath     string        // CLI mode: profile file holding contexts
+	MetadataUrl     string        // Open Library compatible API used for metadata lookups
+	MetadataDump    string        // Open Library editions dump, used instead of MetadataUrl if set
+	MetadataAuthors string        // Open Library authors dump for MetadataDump
+	TrashRetention  time.Duration // How long removed items are kept; 0 keeps them until purged
+	DbConfig        db.ConnectionConfig
+	Goshelf         GoshelfQuerier
+	Args            []string // Arguments following the CLI command
 }
 
-type GoshelfQuerier interface {
-	Connect() error
-	BookCreate(b *v1.Book) (*int, error)
-	BookGet(id int) (*v1.Book, error)
-	BookRemove(id int) error
-	BookFilter(title *string, genre *string, edition *int) ([]v1.Book, error)
-	CollectionCreate(title *string, bookIds []int) (*string, error)
-	CollectionGet(title *string) (*v1.Collection, error)
-	CollectionRemove(title *string) error
+// Kept for existing callers, see db.GoshelfQuerier.
+type GoshelfQuerier = db.GoshelfQuerier
+
+// Returns the metadata provider configured by the -meta flags.
+func metadataProvider(cfg *GoshelfConfig) metadata.Provider {
+	if cfg.MetadataDump != "" {
+		return metadata.NewDumpProvider(cfg.MetadataDump, cfg.MetadataAuthors)
+	}
+
+	return metadata.NewHttpProvider(cfg.MetadataUrl)
 }
 
 func ApiStart(cfg GoshelfConfig) {
+	go purgeTrashEvery(&cfg, time.Hour)
 	StartServer(cfg)
 }
 
-func CliStart(cfg GoshelfConfig, flagSet *flag.FlagSet) {
-	noFlagArgs := flagSet.Args()
-	fMap := GetCliFuncMap()
+// Purges the trash of items older than cfg.TrashRetention every interval,
+// for every user. Does nothing if the retention is 0.
+func purgeTrashEvery(cfg *GoshelfConfig, interval time.Duration) {
+	if cfg.TrashRetention <= 0 {
+		return
+	}
 
-	for _, v := range noFlagArgs {
-		f, ok := fMap[v]
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		// If the function given exists, run it
-		if ok {
-			f(&cfg)
-			return
+	for {
+		report, err := cfg.Goshelf.TrashPurge(v1.TrashPurgeCutoff(time.Now(), cfg.TrashRetention))
+
+		if err != nil {
+			log.Println("Failed to purge trash: " + err.Error())
+		} else if report.Books > 0 || report.Collections > 0 {
+			log.Printf("Purged %d books and %d collections from the trash\n", report.Books, report.Collections)
 		}
+
+		<-ticker.C
+	}
+}
+
+// Returns the index and name of the first CLI command in args, or -1 and
+// an empty string if none is found.
+func findCliCommand(args []string) (int, string) {
+	fMap := GetCliFuncMap()
+
+	for i, v := range args {
+		if _, ok := fMap[v]; ok {
+			return i, v
+		}
+	}
+
+	return -1, ""
+}
+
+func CliStart(cfg GoshelfConfig, flagSet *flag.FlagSet) {
+	noFlagArgs := flagSet.Args()
+	i, name := findCliCommand(noFlagArgs)
+
+	// If the function given exists, run it
+	if i >= 0 {
+		cfg.Args = noFlagArgs[i+1:]
+		GetCliFuncMap()[name](&cfg)
+		return
 	}
 
 	w := os.Stderr
@@ -64,6 +119,62 @@ func Goshelf(args []string) {
 		log.Fatal(err)
 	}
 
+	if cfg.RunApi {
+		cfg.Goshelf = &pg.PgDb{
+			Config:        cfg.DbConfig,
+			SchemaVersion: "v1", // TODO: make this dynamic & migrations
+		}
+
+		cfg.Goshelf.Connect()
+
+		// Users are resolved per request from their API key
+		ApiStart(*cfg)
+		return
+	}
+
+	// Profile contexts are managed locally, without a backend
+	if _, name := findCliCommand(flagSet.Args()); name == "context" {
+		CliStart(*cfg, flagSet)
+		return
+	}
+
+	path, err := ProfilePath(cfg)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	profile, err := LoadProfile(path)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, token, err := ResolveRemote(cfg, profile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if server != "" {
+		// The server acts as the user owning the API key
+		remote := client.New(server, token)
+		user, err := remote.Whoami()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg.Username = user.Username
+		if cfg.BaseUrl == "" {
+			cfg.BaseUrl = server
+		}
+
+		cfg.Goshelf = remote
+		CliStart(*cfg, flagSet)
+		return
+	}
+
 	cfg.Goshelf = &pg.PgDb{
 		Config:        cfg.DbConfig,
 		SchemaVersion: "v1", // TODO: make this dynamic & migrations
@@ -71,9 +182,17 @@ func Goshelf(args []string) {
 
 	cfg.Goshelf.Connect()
 
-	if cfg.RunApi {
-		ApiStart(*cfg)
-	} else {
-		CliStart(*cfg, flagSet)
+	user, err := cfg.Goshelf.UserGetByName(cfg.Username)
+
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	if user == nil {
+		log.Fatal("user " + cfg.Username + " not found")
+	}
+
+	cfg.Goshelf = cfg.Goshelf.AsUser(user)
+
+	CliStart(*cfg, flagSet)
 }
@@ -0,0 +1,179 @@
+package goshelf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// Holds the server's TLS key pair, reloading it from disk on SIGHUP so
+// certificates can be rotated without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Loads the key pair from disk. The previous pair is kept on failure.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert = &cert
+
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// Reloads the key pair every time the process receives SIGHUP.
+func (c *certReloader) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := c.reload(); err != nil {
+				log.Println("Failed to reload TLS certificate: " + err.Error())
+				continue
+			}
+
+			log.Println("Reloaded TLS certificate " + c.certFile)
+		}
+	}()
+}
+
+// Returns the TLS configuration for the API server, or nil if TLS is not
+// configured. Client certificates are required when cfg.TlsClientCa is set.
+func TlsConfig(cfg *GoshelfConfig) (*tls.Config, *certReloader, error) {
+	if cfg.TlsCert == "" && cfg.TlsKey == "" {
+		if cfg.TlsClientCa != "" {
+			return nil, nil, errors.New("client certificate authentication requires -tlscert and -tlskey")
+		}
+
+		return nil, nil, nil
+	}
+
+	if cfg.TlsCert == "" || cfg.TlsKey == "" {
+		return nil, nil, errors.New("both -tlscert and -tlskey are required for TLS")
+	}
+
+	reloader, err := newCertReloader(cfg.TlsCert, cfg.TlsKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if cfg.TlsClientCa != "" {
+		caPem, err := os.ReadFile(cfg.TlsClientCa)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, nil, errors.New("no certificates found in " + cfg.TlsClientCa)
+		}
+
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, reloader, nil
+}
+
+// Returns the listener for the API server: a Unix domain socket when
+// cfg.Socket is set, otherwise TCP on cfg.Host:cfg.Port.
+func Listen(cfg *GoshelfConfig) (net.Listener, error) {
+	if cfg.Socket == "" {
+		return net.Listen("tcp", net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port)))
+	}
+
+	mode, err := strconv.ParseUint(cfg.SocketMode, 8, 32)
+
+	if err != nil {
+		return nil, errors.New("invalid socket mode (must be octal, e.g. 0660)")
+	}
+
+	// Remove a socket left behind by a previous run
+	if info, err := os.Stat(cfg.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(cfg.Socket); err != nil {
+			return nil, err
+		}
+	}
+
+	// Bind in a private (0700) directory next to the socket and move it into
+	// place once it has its mode, so no one can connect before then
+	dir, err := os.MkdirTemp(filepath.Dir(cfg.Socket), ".goshelf-socket-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	bound := filepath.Join(dir, filepath.Base(cfg.Socket))
+
+	ln, err := net.Listen("unix", bound)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The bound path is gone once moved; a socket left behind by Close is
+	// removed on the next start
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(bound, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	if err := os.Rename(bound, cfg.Socket); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
@@ -0,0 +1,130 @@
+package goshelf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Writes a self-signed certificate and key for commonName to dir.
+func writeTestKeyPair(dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(BeNil())
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(Succeed())
+
+	return certFile, keyFile
+}
+
+func leafCommonName(cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	Expect(err).To(BeNil())
+
+	return leaf.Subject.CommonName
+}
+
+var _ = Describe("Listen", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	Context("TLS", func() {
+		It("should be disabled without a certificate", func() {
+			tlsCfg, _, err := TlsConfig(&GoshelfConfig{})
+			Expect(err).To(BeNil())
+			Expect(tlsCfg).To(BeNil())
+		})
+
+		It("should require a key with the certificate", func() {
+			_, _, err := TlsConfig(&GoshelfConfig{TlsCert: "cert.pem"})
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("should reload the certificate", func() {
+			certFile, keyFile := writeTestKeyPair(dir, "first")
+
+			tlsCfg, reloader, err := TlsConfig(&GoshelfConfig{TlsCert: certFile, TlsKey: keyFile})
+			Expect(err).To(BeNil())
+
+			cert, err := tlsCfg.GetCertificate(nil)
+			Expect(err).To(BeNil())
+			Expect(leafCommonName(cert)).To(Equal("first"))
+
+			writeTestKeyPair(dir, "second")
+			Expect(reloader.reload()).To(Succeed())
+
+			cert, err = tlsCfg.GetCertificate(nil)
+			Expect(err).To(BeNil())
+			Expect(leafCommonName(cert)).To(Equal("second"))
+		})
+
+		It("should require client certificates when a CA is given", func() {
+			certFile, keyFile := writeTestKeyPair(dir, "server")
+
+			tlsCfg, _, err := TlsConfig(&GoshelfConfig{TlsCert: certFile, TlsKey: keyFile, TlsClientCa: certFile})
+			Expect(err).To(BeNil())
+			Expect(tlsCfg.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+			Expect(tlsCfg.ClientCAs).ToNot(BeNil())
+		})
+	})
+
+	Context("Unix socket", func() {
+		It("should listen with the configured permissions", func() {
+			socket := filepath.Join(dir, "goshelf.sock")
+
+			ln, err := Listen(&GoshelfConfig{Socket: socket, SocketMode: "0600"})
+			Expect(err).To(BeNil())
+			defer ln.Close()
+
+			info, err := os.Stat(socket)
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			conn, err := net.Dial("unix", socket)
+			Expect(err).To(BeNil())
+			conn.Close()
+
+			// Only the socket is left, not the directory it was bound in
+			entries, err := os.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("should reject an invalid mode", func() {
+			_, err := Listen(&GoshelfConfig{Socket: filepath.Join(dir, "goshelf.sock"), SocketMode: "rw"})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
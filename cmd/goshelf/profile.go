@@ -0,0 +1,149 @@
+package goshelf
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Overrides the default profile location.
+const ProfileEnv = "GOSHELF_PROFILE"
+
+// Overrides the API key of the selected context.
+const TokenEnv = "GOSHELF_TOKEN"
+
+// The per-user profile holding named remote contexts, similar to kubectl
+// contexts. Stored as JSON readable only by the user as it holds API keys.
+type Profile struct {
+	CurrentContext string                    `json:"currentContext,omitempty"`
+	Contexts       map[string]ProfileContext `json:"contexts"`
+}
+
+type ProfileContext struct {
+	Server string `json:"server"`
+	Token  string `json:"token,omitempty"`
+}
+
+// Returns the profile path: cfg.ProfilePath, $GOSHELF_PROFILE, or
+// goshelf/profile.json in the user's config directory.
+func ProfilePath(cfg *GoshelfConfig) (string, error) {
+	if cfg.ProfilePath != "" {
+		return cfg.ProfilePath, nil
+	}
+
+	if path := os.Getenv(ProfileEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "goshelf", "profile.json"), nil
+}
+
+// Reads the profile at path. A missing file is an empty profile.
+func LoadProfile(path string) (*Profile, error) {
+	profile := &Profile{Contexts: map[string]ProfileContext{}}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return profile, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, err
+	}
+
+	if profile.Contexts == nil {
+		profile.Contexts = map[string]ProfileContext{}
+	}
+
+	return profile, nil
+}
+
+// Writes the profile to path, creating its directory if needed.
+func (p *Profile) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// Returns the server and API key the CLI should use, or an empty server for
+// direct database access. -remote takes precedence over -context, which
+// takes precedence over the profile's current context. With -remote, the
+// key of the context pointing at that server is used: the one named by
+// -context or the current context if it does, otherwise the only one.
+// $GOSHELF_TOKEN overrides the context's key.
+func ResolveRemote(cfg *GoshelfConfig, profile *Profile) (string, string, error) {
+	server, token := "", ""
+	envToken := os.Getenv(TokenEnv)
+
+	if cfg.Remote != "" {
+		server = cfg.Remote
+
+		matching := []string{}
+
+		for name, c := range profile.Contexts {
+			if c.Server == server {
+				matching = append(matching, name)
+			}
+		}
+
+		sort.Strings(matching)
+
+		for _, preferred := range []string{cfg.Context, profile.CurrentContext} {
+			if c, ok := profile.Contexts[preferred]; ok && preferred != "" && c.Server == server {
+				matching = []string{preferred}
+				break
+			}
+		}
+
+		if len(matching) > 1 && envToken == "" {
+			return "", "", errors.New("contexts " + strings.Join(matching, ", ") + " all use " + server + ", pick one with -context")
+		}
+
+		if len(matching) > 0 {
+			token = profile.Contexts[matching[0]].Token
+		}
+	} else {
+		name := cfg.Context
+		if name == "" {
+			name = profile.CurrentContext
+		}
+
+		if name != "" {
+			c, ok := profile.Contexts[name]
+
+			if !ok {
+				return "", "", errors.New("context " + name + " not found")
+			}
+
+			server, token = c.Server, c.Token
+		}
+	}
+
+	if envToken != "" {
+		token = envToken
+	}
+
+	return server, token, nil
+}
@@ -0,0 +1,107 @@
+package goshelf
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+	var path string
+	var profile *Profile
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "goshelf", "profile.json")
+		GinkgoT().Setenv(TokenEnv, "")
+
+		profile = &Profile{
+			CurrentContext: "office",
+			Contexts: map[string]ProfileContext{
+				"office": {Server: "https://office.example", Token: "gs_office"},
+				"home":   {Server: "https://home.example", Token: "gs_home"},
+			},
+		}
+	})
+
+	Context("loading and saving", func() {
+		It("should treat a missing file as empty", func() {
+			loaded, err := LoadProfile(path)
+			Expect(err).To(BeNil())
+			Expect(loaded.CurrentContext).To(BeEmpty())
+			Expect(loaded.Contexts).To(BeEmpty())
+		})
+
+		It("should round trip with private permissions", func() {
+			Expect(profile.Save(path)).To(Succeed())
+
+			info, err := os.Stat(path)
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			loaded, err := LoadProfile(path)
+			Expect(err).To(BeNil())
+			Expect(loaded).To(Equal(profile))
+		})
+
+		It("should prefer the -profile flag for the path", func() {
+			path, err := ProfilePath(&GoshelfConfig{ProfilePath: "custom.json"})
+			Expect(err).To(BeNil())
+			Expect(path).To(Equal("custom.json"))
+		})
+	})
+
+	Context("resolving the remote", func() {
+		It("should use the database without a context", func() {
+			server, _, err := ResolveRemote(&GoshelfConfig{}, &Profile{})
+			Expect(err).To(BeNil())
+			Expect(server).To(BeEmpty())
+		})
+
+		It("should use the current context", func() {
+			server, token, err := ResolveRemote(&GoshelfConfig{}, profile)
+			Expect(err).To(BeNil())
+			Expect(server).To(Equal("https://office.example"))
+			Expect(token).To(Equal("gs_office"))
+		})
+
+		It("should prefer -context over the current context", func() {
+			server, token, err := ResolveRemote(&GoshelfConfig{Context: "home"}, profile)
+			Expect(err).To(BeNil())
+			Expect(server).To(Equal("https://home.example"))
+			Expect(token).To(Equal("gs_home"))
+		})
+
+		It("should prefer -remote and reuse a matching context's key", func() {
+			server, token, err := ResolveRemote(&GoshelfConfig{Remote: "https://home.example", Context: "office"}, profile)
+			Expect(err).To(BeNil())
+			Expect(server).To(Equal("https://home.example"))
+			Expect(token).To(Equal("gs_home"))
+		})
+
+		It("should pick the named context's key when several share the server", func() {
+			profile.Contexts["home-admin"] = ProfileContext{Server: "https://home.example", Token: "gs_home_admin"}
+
+			_, _, err := ResolveRemote(&GoshelfConfig{Remote: "https://home.example"}, profile)
+			Expect(err).ToNot(BeNil())
+
+			_, token, err := ResolveRemote(&GoshelfConfig{Remote: "https://home.example", Context: "home-admin"}, profile)
+			Expect(err).To(BeNil())
+			Expect(token).To(Equal("gs_home_admin"))
+		})
+
+		It("should let the environment override the key", func() {
+			GinkgoT().Setenv(TokenEnv, "gs_env")
+
+			_, token, err := ResolveRemote(&GoshelfConfig{}, profile)
+			Expect(err).To(BeNil())
+			Expect(token).To(Equal("gs_env"))
+		})
+
+		It("should fail for unknown contexts", func() {
+			_, _, err := ResolveRemote(&GoshelfConfig{Context: "missing"}, profile)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
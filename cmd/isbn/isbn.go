@@ -0,0 +1,143 @@
+// Package isbn validates and normalizes ISBN-10 and ISBN-13 identifiers.
+package isbn
+
+import (
+	"errors"
+	"strings"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+var (
+	ErrLength   = errors.New("isbn must have 10 or 13 digits")
+	ErrChecksum = errors.New("isbn checksum is invalid")
+	ErrMismatch = errors.New("isbn10 and isbn13 are different books")
+)
+
+// Strips hyphens and spaces, and upper-cases an ISBN-10 check digit x.
+func clean(s string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s)))
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the ISBN-10 check digit for the first 9 digits of s.
+func checkDigit10(s string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(s[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+
+	if check == 10 {
+		return 'X'
+	}
+
+	return byte('0' + check)
+}
+
+// Returns the ISBN-13 check digit for the first 12 digits of s.
+func checkDigit13(s string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+
+		sum += int(s[i]-'0') * weight
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Returns the ISBN-13 form of an ISBN-10 or ISBN-13, without hyphens.
+// Returns an error if s is not a valid ISBN.
+func Normalize(s string) (string, error) {
+	s = clean(s)
+
+	switch len(s) {
+	case 10:
+		if !isDigits(s[:9]) || !(isDigits(s[9:]) || s[9] == 'X') {
+			return "", ErrLength
+		}
+
+		if checkDigit10(s) != s[9] {
+			return "", ErrChecksum
+		}
+
+		isbn13 := "978" + s[:9]
+		return isbn13 + string(checkDigit13(isbn13)), nil
+	case 13:
+		if !isDigits(s) {
+			return "", ErrLength
+		}
+
+		if checkDigit13(s) != s[12] {
+			return "", ErrChecksum
+		}
+
+		return s, nil
+	}
+
+	return "", ErrLength
+}
+
+// Returns the ISBN-10 form of a normalized ISBN-13. Only 978 ISBNs have an
+// ISBN-10; ok is false for others.
+func To10(isbn13 string) (isbn10 string, ok bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+
+	isbn10 = isbn13[3:12]
+
+	return isbn10 + string(checkDigit10(isbn10)), true
+}
+
+// Validates the ISBNs given on b and sets both forms. Either may be given;
+// if both are, they must be the same book.
+func NormalizeBook(b *v1.Book) error {
+	var isbn13 string
+
+	for _, given := range []*string{b.Isbn13, b.Isbn10} {
+		if given == nil || strings.TrimSpace(*given) == "" {
+			continue
+		}
+
+		normalized, err := Normalize(*given)
+
+		if err != nil {
+			return err
+		}
+
+		if isbn13 != "" && normalized != isbn13 {
+			return ErrMismatch
+		}
+
+		isbn13 = normalized
+	}
+
+	if isbn13 == "" {
+		b.Isbn10, b.Isbn13 = nil, nil
+		return nil
+	}
+
+	b.Isbn13 = &isbn13
+	b.Isbn10 = nil
+
+	if isbn10, ok := To10(isbn13); ok {
+		b.Isbn10 = &isbn10
+	}
+
+	return nil
+}
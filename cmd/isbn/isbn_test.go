@@ -0,0 +1,56 @@
+package isbn
+
+import (
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ISBN", func() {
+	DescribeTable("Normalize",
+		func(given string, expected string, expectedErr error) {
+			isbn13, err := Normalize(given)
+
+			if expectedErr != nil {
+				Expect(err).To(MatchError(expectedErr))
+				return
+			}
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isbn13).To(Equal(expected))
+		},
+		Entry("ISBN-13", "9780441172719", "9780441172719", nil),
+		Entry("hyphenated ISBN-13", "978-0-441-17271-9", "9780441172719", nil),
+		Entry("ISBN-10", "0441172717", "9780441172719", nil),
+		Entry("ISBN-10 with X check digit", "0-8044-2957-x", "9780804429573", nil),
+		Entry("bad ISBN-13 checksum", "9780441172710", "", ErrChecksum),
+		Entry("bad ISBN-10 checksum", "0441172718", "", ErrChecksum),
+		Entry("X in an ISBN-13", "978044117271X", "", ErrLength),
+		Entry("too short", "12345", "", ErrLength),
+	)
+
+	It("converts 978 ISBN-13s to ISBN-10", func() {
+		isbn10, ok := To10("9780804429573")
+		Expect(ok).To(BeTrue())
+		Expect(isbn10).To(Equal("080442957X"))
+
+		_, ok = To10("9791032305690")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("sets both forms on a book", func() {
+		given := "0441172717"
+		book := &v1.Book{Isbn10: &given}
+
+		Expect(NormalizeBook(book)).To(Succeed())
+		Expect(*book.Isbn13).To(Equal("9780441172719"))
+		Expect(*book.Isbn10).To(Equal("0441172717"))
+	})
+
+	It("rejects a book with different ISBN-10 and ISBN-13", func() {
+		isbn10, isbn13 := "0441172717", "9780804429573"
+		book := &v1.Book{Isbn10: &isbn10, Isbn13: &isbn13}
+
+		Expect(NormalizeBook(book)).To(MatchError(ErrMismatch))
+	})
+})
@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// Looks books up in a local Open Library editions dump, optionally
+// resolving author names from an authors dump. Dumps are the tab
+// separated files from https://openlibrary.org/developers/dumps, plain or
+// gzipped. Each lookup scans the dump, so this suits a filtered dump or
+// occasional lookups rather than a full dump on every request.
+type DumpProvider struct {
+	EditionsPath string
+	AuthorsPath  string // Optional, the by statement is used without it
+}
+
+func NewDumpProvider(editionsPath string, authorsPath string) *DumpProvider {
+	return &DumpProvider{EditionsPath: editionsPath, AuthorsPath: authorsPath}
+}
+
+func (d *DumpProvider) Lookup(q Query) (*v1.Book, error) {
+	var isbn13 string
+
+	if q.Isbn != "" {
+		normalized, err := isbn.Normalize(q.Isbn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		isbn13 = normalized
+	}
+
+	var found *olEdition
+
+	err := scanDump(d.EditionsPath, func(record []byte) bool {
+		e := olEdition{}
+
+		if json.Unmarshal(record, &e) != nil {
+			return true
+		}
+
+		if (isbn13 != "" && e.hasIsbn(isbn13)) || (isbn13 == "" && e.matches(q, "")) {
+			found = &e
+			return false
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	authorName, err := d.authorName(found)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return found.toBook(authorName), nil
+}
+
+// Returns the name of e's first author from the authors dump, or an empty
+// string if there is no authors dump or the author isn't in it.
+func (d *DumpProvider) authorName(e *olEdition) (string, error) {
+	if d.AuthorsPath == "" || len(e.Authors) == 0 {
+		return "", nil
+	}
+
+	name := ""
+
+	err := scanDump(d.AuthorsPath, func(record []byte) bool {
+		a := olAuthor{}
+
+		if json.Unmarshal(record, &a) == nil && a.Key == e.Authors[0].Key {
+			name = a.Name
+			return false
+		}
+
+		return true
+	})
+
+	return name, err
+}
+
+// Calls fn with the JSON record of each line in the dump at path until fn
+// returns false. Lines are either dump rows (the JSON is the last tab
+// separated column) or bare JSON.
+func scanDump(path string, fn func(record []byte) bool) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var r io.Reader = reader
+
+	// gzip magic number
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+
+		if err != nil {
+			return err
+		}
+
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Records with long descriptions exceed the default 64KB line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if idx := strings.LastIndex(line, "\t"); idx >= 0 {
+			line = line[idx+1:]
+		}
+
+		if !fn([]byte(line)) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,146 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+const DefaultOpenLibraryUrl = "https://openlibrary.org"
+
+// Looks books up with the Open Library API, or any server implementing
+// its /isbn/{isbn}.json, /authors/{id}.json and /search.json endpoints
+// (e.g. a stub in tests).
+type HttpProvider struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+func NewHttpProvider(baseUrl string) *HttpProvider {
+	return &HttpProvider{
+		BaseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Decodes the JSON at path into v. Returns ErrNotFound for a 404.
+func (h *HttpProvider) get(path string, query url.Values, v interface{}) error {
+	u := h.BaseUrl + path
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := h.HttpClient.Get(u)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata lookup failed: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (h *HttpProvider) Lookup(q Query) (*v1.Book, error) {
+	if q.Isbn != "" {
+		return h.lookupIsbn(q.Isbn)
+	}
+
+	return h.search(q)
+}
+
+func (h *HttpProvider) lookupIsbn(given string) (*v1.Book, error) {
+	isbn13, err := isbn.Normalize(given)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e := olEdition{}
+
+	if err := h.get("/isbn/"+isbn13+".json", nil, &e); err != nil {
+		return nil, err
+	}
+
+	authorName := ""
+
+	if len(e.Authors) > 0 {
+		a := olAuthor{}
+
+		// The by statement is used if the author can't be fetched
+		if err := h.get(e.Authors[0].Key+".json", nil, &a); err == nil {
+			authorName = a.Name
+		}
+	}
+
+	return e.toBook(authorName), nil
+}
+
+// A /search.json result.
+type olSearchDoc struct {
+	Title            string   `json:"title"`
+	AuthorName       []string `json:"author_name"`
+	FirstPublishYear int      `json:"first_publish_year"`
+	Isbn             []string `json:"isbn"`
+	Subject          []string `json:"subject"`
+}
+
+func (h *HttpProvider) search(q Query) (*v1.Book, error) {
+	if strings.TrimSpace(q.Title) == "" {
+		return nil, ErrNotFound
+	}
+
+	query := url.Values{}
+	query.Set("title", q.Title)
+	query.Set("limit", "1")
+
+	if q.Author != "" {
+		query.Set("author", q.Author)
+	}
+
+	ret := struct {
+		Docs []olSearchDoc `json:"docs"`
+	}{}
+
+	if err := h.get("/search.json", query, &ret); err != nil {
+		return nil, err
+	}
+
+	if len(ret.Docs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	doc := ret.Docs[0]
+	e := olEdition{
+		Title:    doc.Title,
+		Isbn13:   doc.Isbn,
+		Subjects: doc.Subject,
+	}
+
+	if doc.FirstPublishYear > 0 {
+		e.PublishDate = fmt.Sprint(doc.FirstPublishYear)
+	}
+
+	authorName := ""
+
+	if len(doc.AuthorName) > 0 {
+		authorName = doc.AuthorName[0]
+	}
+
+	return e.toBook(authorName), nil
+}
@@ -0,0 +1,146 @@
+// Package metadata looks up book details from external sources so they
+// don't have to be typed in by hand.
+package metadata
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Max-Clark/goshelf/cmd/bookcsv"
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+var ErrNotFound = errors.New("no metadata found")
+
+// What to look up. An ISBN is used if given, otherwise title and
+// (optionally) author.
+type Query struct {
+	Isbn   string
+	Title  string
+	Author string
+}
+
+// A source of book metadata, e.g. Open Library.
+type Provider interface {
+	// Returns a candidate book for q, or ErrNotFound.
+	Lookup(q Query) (*v1.Book, error)
+}
+
+// Returns the query for looking up b: its ISBN if set, otherwise its
+// title and author.
+func QueryForBook(b *v1.Book) Query {
+	q := Query{
+		Title:  b.Title,
+		Author: strings.TrimSpace(b.Author.FirstName + " " + b.Author.LastName),
+	}
+
+	if b.Isbn13 != nil {
+		q.Isbn = *b.Isbn13
+	} else if b.Isbn10 != nil {
+		q.Isbn = *b.Isbn10
+	}
+
+	return q
+}
+
+// Fills fields missing from b with those from candidate. Fields already
+// set on b are kept, so user input always wins.
+func Merge(b *v1.Book, candidate *v1.Book) {
+	if b.Title == "" {
+		b.Title = candidate.Title
+	}
+
+	if b.Author.FirstName == "" && b.Author.LastName == "" {
+		b.Author.FirstName = candidate.Author.FirstName
+		b.Author.LastName = candidate.Author.LastName
+	}
+
+	if b.PublishDate == nil {
+		b.PublishDate = candidate.PublishDate
+	}
+
+	if b.Edition == nil {
+		b.Edition = candidate.Edition
+	}
+
+	if b.Description == nil {
+		b.Description = candidate.Description
+	}
+
+	if b.Genre == nil {
+		b.Genre = candidate.Genre
+	}
+
+	if b.Isbn10 == nil && b.Isbn13 == nil {
+		b.Isbn10 = candidate.Isbn10
+		b.Isbn13 = candidate.Isbn13
+	}
+
+	if len(b.Identifiers) == 0 {
+		b.Identifiers = candidate.Identifiers
+	}
+}
+
+// Looks up b with p and merges the result into b.
+func Enrich(p Provider, b *v1.Book) error {
+	candidate, err := p.Lookup(QueryForBook(b))
+
+	if err != nil {
+		return err
+	}
+
+	Merge(b, candidate)
+
+	return nil
+}
+
+// Open Library writes dates however the cataloguer did, e.g. "June 1990"
+// or "Jun 01, 1990"
+var extraDateLayouts = []string{
+	"January 2, 2006",
+	"Jan 02, 2006",
+	"Jan 2, 2006",
+	"January 2006",
+	"Jan 2006",
+}
+
+var yearPattern = regexp.MustCompile(`\b(1[5-9]|20)\d\d\b`)
+
+// Parses a free-form publish date, falling back to the first year in v.
+// Returns nil if no date is found.
+func parseDate(v string) *time.Time {
+	v = strings.TrimSpace(v)
+
+	if date, err := bookcsv.ParseDate(v); err == nil {
+		return date
+	}
+
+	for _, layout := range extraDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t
+		}
+	}
+
+	if year := yearPattern.FindString(v); year != "" {
+		date, _ := bookcsv.ParseDate(year)
+		return date
+	}
+
+	return nil
+}
+
+// Returns the first valid ISBN in isbns, normalized.
+func firstIsbn(isbns ...[]string) string {
+	for _, list := range isbns {
+		for _, i := range list {
+			if normalized, err := isbn.Normalize(i); err == nil {
+				return normalized
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,21 @@
+package metadata
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetadata(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metadata Suite")
+}
+
+// Open Library records for Dune shared by the tests
+const duneEdition = `{"key": "/books/OL1532643M", "title": "Dune", "authors": [{"key": "/authors/OL79034A"}],
+	"publish_date": "June 1990", "isbn_10": ["0441172717"], "by_statement": "by Frank Herbert.",
+	"description": {"type": "/type/text", "value": "Desert planet"}, "subjects": ["Science fiction"],
+	"lccn": ["65022719"]}`
+
+const herbertAuthor = `{"key": "/authors/OL79034A", "name": "Frank Herbert"}`
@@ -0,0 +1,150 @@
+package metadata
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func expectDune(book *v1.Book) {
+	Expect(book.Title).To(Equal("Dune"))
+	Expect(book.Author.FirstName).To(Equal("Frank"))
+	Expect(book.Author.LastName).To(Equal("Herbert"))
+	Expect(*book.Isbn13).To(Equal("9780441172719"))
+	Expect(*book.Description).To(Equal("Desert planet"))
+	Expect(*book.Genre).To(Equal("Science fiction"))
+	Expect(book.PublishDate.Format("2006-01-02")).To(Equal("1990-06-01"))
+	Expect(book.Identifiers).To(ContainElement(v1.Identifier{Type: "lccn", Value: "65022719"}))
+}
+
+var _ = Describe("Metadata", func() {
+	Context("DumpProvider", func() {
+		var dir string
+
+		// Writes dump rows (type, key, revision, last modified, JSON) to name
+		writeDump := func(name string, gzipped bool, records ...string) string {
+			path := filepath.Join(dir, name)
+			file, err := os.Create(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close()
+
+			var w interface{ Write([]byte) (int, error) } = file
+
+			if gzipped {
+				gz := gzip.NewWriter(file)
+				defer gz.Close()
+				w = gz
+			}
+
+			for _, r := range records {
+				compact := strings.Join(strings.Fields(r), " ")
+				_, err := w.Write([]byte("/type/edition\t/books/x\t1\t2020-01-01T00:00:00\t" + compact + "\n"))
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			return path
+		}
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		It("finds a book by either ISBN form", func() {
+			editions := writeDump("editions.txt", false, `{"title": "Other", "isbn_13": ["9780804429573"]}`, duneEdition)
+			authors := writeDump("authors.txt.gz", true, herbertAuthor)
+			p := NewDumpProvider(editions, authors)
+
+			book, err := p.Lookup(Query{Isbn: "978-0-441-17271-9"})
+			Expect(err).ToNot(HaveOccurred())
+			expectDune(book)
+		})
+
+		It("finds a book by title and author", func() {
+			p := NewDumpProvider(writeDump("editions.txt.gz", true, duneEdition), "")
+
+			book, err := p.Lookup(Query{Title: "dune", Author: "herbert"})
+			Expect(err).ToNot(HaveOccurred())
+			// Without an authors dump the by statement is used
+			Expect(book.Author.LastName).To(Equal("Herbert"))
+		})
+
+		It("reports missing books", func() {
+			p := NewDumpProvider(writeDump("editions.txt", false, duneEdition), "")
+
+			_, err := p.Lookup(Query{Isbn: "9780804429573"})
+			Expect(err).To(MatchError(ErrNotFound))
+		})
+	})
+
+	Context("HttpProvider", func() {
+		var server *httptest.Server
+		var p *HttpProvider
+
+		BeforeEach(func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/isbn/9780441172719.json", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(duneEdition))
+			})
+			mux.HandleFunc("/authors/OL79034A.json", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(herbertAuthor))
+			})
+			mux.HandleFunc("/search.json", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("title")).To(Equal("Dune"))
+
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"docs": []map[string]interface{}{{
+						"title":              "Dune",
+						"author_name":        []string{"Frank Herbert"},
+						"first_publish_year": 1965,
+						"isbn":               []string{"0441172717"},
+					}},
+				})
+			})
+
+			server = httptest.NewServer(mux)
+			p = NewHttpProvider(server.URL + "/")
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("looks books up by ISBN-10", func() {
+			book, err := p.Lookup(Query{Isbn: "0441172717"})
+			Expect(err).ToNot(HaveOccurred())
+			expectDune(book)
+		})
+
+		It("searches by title", func() {
+			book, err := p.Lookup(Query{Title: "Dune"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(book.Author.FirstName).To(Equal("Frank"))
+			Expect(book.PublishDate.Year()).To(Equal(1965))
+		})
+
+		It("reports missing books", func() {
+			_, err := p.Lookup(Query{Isbn: "9780804429573"})
+			Expect(err).To(MatchError(ErrNotFound))
+		})
+	})
+
+	It("merges without overwriting user input", func() {
+		date := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		candidate := &v1.Book{Title: "Dune", Author: v1.Author{FirstName: "Frank", LastName: "Herbert"}, PublishDate: &date}
+		book := &v1.Book{Title: "Dune (my copy)"}
+
+		Merge(book, candidate)
+		Expect(book.Title).To(Equal("Dune (my copy)"))
+		Expect(book.Author.LastName).To(Equal("Herbert"))
+		Expect(book.PublishDate).To(Equal(&date))
+	})
+})
@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Max-Clark/goshelf/cmd/bookcsv"
+	"github.com/Max-Clark/goshelf/cmd/isbn"
+	v1 "github.com/Max-Clark/goshelf/cmd/model/v1"
+)
+
+// An Open Library edition record, as served by the API and found in the
+// editions data dump. Only the fields goshelf uses are decoded.
+type olEdition struct {
+	Key         string          `json:"key"`
+	Title       string          `json:"title"`
+	Subtitle    string          `json:"subtitle"`
+	Authors     []olRef         `json:"authors"`
+	ByStatement string          `json:"by_statement"`
+	PublishDate string          `json:"publish_date"`
+	Isbn10      []string        `json:"isbn_10"`
+	Isbn13      []string        `json:"isbn_13"`
+	Description json.RawMessage `json:"description"`
+	Subjects    []string        `json:"subjects"`
+	Lccn        []string        `json:"lccn"`
+	Oclc        []string        `json:"oclc_numbers"`
+}
+
+type olRef struct {
+	Key string `json:"key"`
+}
+
+type olAuthor struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Returns true if e has the given normalized ISBN-13.
+func (e *olEdition) hasIsbn(isbn13 string) bool {
+	for _, list := range [][]string{e.Isbn13, e.Isbn10} {
+		for _, i := range list {
+			if normalized, err := isbn.Normalize(i); err == nil && normalized == isbn13 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns true if e's title (and author name, if given) contain q's,
+// ignoring case.
+func (e *olEdition) matches(q Query, authorName string) bool {
+	contains := func(s, sub string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(strings.TrimSpace(sub)))
+	}
+
+	return contains(e.Title, q.Title) && (q.Author == "" || contains(authorName+" "+e.ByStatement, q.Author))
+}
+
+// Converts e to a book. authorName is the resolved name of e's first
+// author, or empty to fall back to the by statement.
+func (e *olEdition) toBook(authorName string) *v1.Book {
+	book := &v1.Book{Title: e.Title}
+
+	if e.Subtitle != "" {
+		book.Title += ": " + e.Subtitle
+	}
+
+	if authorName == "" {
+		// e.g. "by Frank Herbert."
+		authorName = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(e.ByStatement), "by "), ".")
+	}
+
+	book.Author.FirstName, book.Author.LastName = bookcsv.SplitAuthorName(authorName)
+	book.PublishDate = parseDate(e.PublishDate)
+
+	if description := decodeText(e.Description); description != "" {
+		book.Description = &description
+	}
+
+	if len(e.Subjects) > 0 {
+		genre := e.Subjects[0]
+		book.Genre = &genre
+	}
+
+	if isbn13 := firstIsbn(e.Isbn13, e.Isbn10); isbn13 != "" {
+		book.Isbn13 = &isbn13
+		isbn.NormalizeBook(book)
+	}
+
+	for _, lccn := range e.Lccn {
+		book.Identifiers = append(book.Identifiers, v1.Identifier{Type: "lccn", Value: lccn})
+	}
+
+	for _, oclc := range e.Oclc {
+		book.Identifiers = append(book.Identifiers, v1.Identifier{Type: "oclc", Value: oclc})
+	}
+
+	return book
+}
+
+// Open Library text fields are either a string or {"type": "/type/text",
+// "value": "..."}.
+func decodeText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var text struct {
+		Value string `json:"value"`
+	}
+	json.Unmarshal(raw, &text)
+
+	return text.Value
+}
@@ -0,0 +1,21 @@
+package v1
+
+import "time"
+
+const ApiKeyScopeRead = "read"
+const ApiKeyScopeReadWrite = "read-write"
+
+type ApiKey struct {
+	ApiKeyId  int        `validator:"required,min=1" json:"apiKeyId"`
+	UserId    int        `validator:"required,min=1" json:"userId"`
+	CreatedTs time.Time  `json:"createdTs"`
+	Name      string     `validator:"required,minLength=1" json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scope     string     `validator:"required" json:"scope"`
+	RevokedTs *time.Time `json:"revokedTs,omitempty"`
+}
+
+// Returns true if the key's scope permits creating, updating or removing entities.
+func (k *ApiKey) CanWrite() bool {
+	return k.Scope == ApiKeyScopeReadWrite
+}
@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	AuditEntityBook       = "book"
+	AuditEntityAuthor     = "author"
+	AuditEntityCollection = "collection"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore" // Taken out of the trash
+	AuditActionMerge   = "merge"   // A book merge, on both books
+	AuditActionPurge   = "purge"   // Deleted for good from the trash
+)
+
+// A recorded create, update, delete, restore, merge or purge of a book,
+// author or collection. Before is unset for creates and After for deletes
+// and purges; a restore's Before is the item in the trash. A merged away book has no
+// After, as it is in the trash. Entries are never changed
+// once written.
+type AuditEntry struct {
+	AuditId   int             `json:"auditId"`
+	CreatedTs time.Time       `json:"createdTs"`
+	ActorId   *int            `json:"actorId,omitempty"` // Nil for system changes, e.g. migrations
+	Actor     *string         `json:"actor,omitempty"`   // The actor's username at the time
+	OwnerId   *int            `json:"ownerId,omitempty"` // The changed row's owner; authors have none
+	Entity    string          `json:"entity"`
+	EntityId  int             `json:"entityId"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	UndoOf    *int            `json:"undoOf,omitempty"` // The entry this undid, for changes made by an undo
+}
+
+// Returns the top-level fields that differ between Before and After,
+// sorted. Creates and deletes list every field of the entity.
+func (e *AuditEntry) ChangedFields() ([]string, error) {
+	before, after := map[string]interface{}{}, map[string]interface{}{}
+
+	for _, side := range []struct {
+		raw    json.RawMessage
+		fields *map[string]interface{}
+	}{
+		{e.Before, &before},
+		{e.After, &after},
+	} {
+		if len(side.raw) == 0 || string(side.raw) == "null" {
+			continue
+		}
+
+		if err := json.Unmarshal(side.raw, side.fields); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := make([]string, 0)
+
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changed = append(changed, field)
+		}
+	}
+
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// Values to filter the audit log by. Nil fields are not filtered on.
+type AuditFilter struct {
+	Entity   *string
+	EntityId *int
+	ActorId  *int
+	Since    *time.Time // Inclusive
+	Until    *time.Time // Exclusive
+	Limit    int        // Newest entries first; 0 for no limit
+}
+
+// Parses an audit filter time given either as RFC 3339, e.g.
+// 2024-03-10T09:00:00Z, or as a date, e.g. 2024-03-10, meaning midnight UTC.
+func ParseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+
+	if err != nil {
+		return time.Time{}, errors.New("times must be RFC 3339 or YYYY-MM-DD")
+	}
+
+	return t, nil
+}
+
+// Returns an error unless entity is one of the audited entities.
+func ValidateAuditEntity(entity string) error {
+	switch entity {
+	case AuditEntityBook, AuditEntityAuthor, AuditEntityCollection:
+		return nil
+	}
+
+	return errors.New("entity must be book, author or collection")
+}
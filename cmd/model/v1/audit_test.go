@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuditEntry", func() {
+	It("lists the fields an update changed", func() {
+		entry := &AuditEntry{
+			Before: []byte(`{"title": "sf", "public": false, "entries": [{"bookId": 1}], "description": "Old"}`),
+			After:  []byte(`{"title": "Sci-Fi", "public": false, "entries": [{"bookId": 1}, {"bookId": 2}]}`),
+		}
+
+		Expect(entry.ChangedFields()).To(Equal([]string{"description", "entries", "title"}))
+	})
+
+	It("lists every field of a create", func() {
+		entry := &AuditEntry{After: []byte(`{"bookId": 3, "title": "Dune"}`)}
+
+		Expect(entry.ChangedFields()).To(Equal([]string{"bookId", "title"}))
+	})
+
+	It("parses RFC 3339 times and dates", func() {
+		t, err := ParseAuditTime("2024-03-10T09:30:00+01:00")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.UTC()).To(Equal(time.Date(2024, 3, 10, 8, 30, 0, 0, time.UTC)))
+
+		t, err = ParseAuditTime("2024-03-10")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t).To(Equal(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)))
+
+		_, err = ParseAuditTime("last week")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -2,13 +2,31 @@ package v1
 
 import "time"
 
+// An edition of a work. Books created without a WorkId get a new work.
 type Book struct {
-	BookId      int        `validator:"required,min=1" json:"bookId"`
-	Author      Author     `validator:"required" json:"author"`
-	CreatedTs   time.Time  `json:"createdTs"`
-	Title       string     `validator:"required,minLength=1" json:"title"`
-	PublishDate *time.Time `validator:"optional" json:"publishDate,omitempty"`
-	Edition     *int       `validator:"optional,min=1" json:"edition,omitempty"`
-	Description *string    `validator:"optional,minLength=1" json:"description,omitempty"`
-	Genre       *string    `validator:"optional" json:"genre,omitempty"`
+	BookId        int          `validator:"required,min=1" json:"bookId"`
+	WorkId        int          `validator:"optional" json:"workId"`
+	OwnerId       int          `json:"ownerId"`
+	Author        Author       `validator:"required" json:"author"`
+	CreatedTs     time.Time    `json:"createdTs"`
+	Title         string       `validator:"required,minLength=1" json:"title"`
+	PublishDate   *time.Time   `validator:"optional" json:"publishDate,omitempty"`
+	Edition       *int         `validator:"optional,min=1" json:"edition,omitempty"`
+	Description   *string      `validator:"optional,minLength=1" json:"description,omitempty"`
+	Genre         *string      `validator:"optional" json:"genre,omitempty"`
+	Isbn10        *string      `validator:"optional" json:"isbn10,omitempty"`
+	Isbn13        *string      `validator:"optional" json:"isbn13,omitempty"`
+	Identifiers   []Identifier `validator:"optional" json:"identifiers,omitempty"`
+	Language      *string      `validator:"optional" json:"language,omitempty"`
+	TranslationOf *int         `validator:"optional" json:"translationOf,omitempty"` // Book id of the source edition
+	Series        *BookSeries  `json:"series,omitempty"`
+	Rating        *BookRating  `json:"rating,omitempty"`    // Read-only, from reviews
+	Loan          *Loan        `json:"loan,omitempty"`      // The active loan, set by BookGet
+	DeletedTs     *time.Time   `json:"deletedTs,omitempty"` // Set while the book is in the trash
+}
+
+// The average of a book's review ratings.
+type BookRating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
 }
@@ -0,0 +1,22 @@
+package v1
+
+import "time"
+
+// Values to filter books by. Nil fields are not filtered on. Title and
+// genre are wildcard searches; the rest are equality checks. Books
+// filtered by series are returned in series order and editions of a work
+// oldest first, unless Sort is given. Smart collections store a filter as
+// JSON.
+type BookFilter struct {
+	Title           *string    `json:"title,omitempty"`
+	TitleExact      *string    `json:"titleExact,omitempty"` // The whole title, ignoring case
+	Genre           *string    `json:"genre,omitempty"`
+	Edition         *int       `json:"edition,omitempty"`
+	Isbn            *string    `json:"isbn,omitempty"`   // ISBN-10 or ISBN-13
+	Status          *string    `json:"status,omitempty"` // The current user's reading status, see ReadingStatuses
+	SeriesId        *int       `json:"seriesId,omitempty"`
+	WorkId          *int       `json:"workId,omitempty"`
+	PublishedBefore *time.Time `json:"publishedBefore,omitempty"` // Exclusive
+	PublishedAfter  *time.Time `json:"publishedAfter,omitempty"`  // Inclusive
+	Sort            *string    `json:"sort,omitempty"`            // Sort order, e.g. BookSortRating
+}
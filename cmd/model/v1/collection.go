@@ -1,9 +1,98 @@
 package v1
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
+// A collection of books. Manual collections hold the books added to
+// them, in order, with Entries giving each book's position and note.
+// Smart collections hold a Filter instead, and their Books are the
+// owner's books matching it when the collection is read. Collections
+// may be nested under a Parent.
 type Collection struct {
-	Title     string    `validator:"required,minLength=1" json:"title"`
-	CreatedTs time.Time `json:"createdTs,omitempty"`
-	Books     []Book    `validator:"required" json:"books"`
+	CollectionId int               `json:"collectionId"`
+	OwnerId      int               `json:"ownerId"`
+	Title        string            `validator:"required,minLength=1" json:"title"`
+	Slug         string            `json:"slug"` // URL-safe form of the title, unique per owner
+	CreatedTs    time.Time         `json:"createdTs,omitempty"`
+	Public       bool              `json:"public"`
+	Description  *string           `validator:"optional" json:"description,omitempty"`
+	CoverUrl     *string           `validator:"optional" json:"coverUrl,omitempty"`
+	Parent       *string           `json:"parent,omitempty"` // The parent collection's title, nil for a root
+	Smart        bool              `json:"smart"`
+	Filter       *BookFilter       `json:"filter,omitempty"`
+	Books        []Book            `validator:"required" json:"books"`
+	Entries      []CollectionEntry `json:"entries,omitempty"`
+	Children     []Collection      `json:"children,omitempty"`  // Set by CollectionTree
+	DeletedTs    *time.Time        `json:"deletedTs,omitempty"` // Set while the collection is in the trash
+}
+
+// A book's membership of a manual collection. Positions start at 1.
+type CollectionEntry struct {
+	BookId   int     `json:"bookId"`
+	Position int     `json:"position"`
+	Note     *string `json:"note,omitempty"`
+}
+
+// Changes to a collection's title and metadata. Nil fields are left
+// unchanged; an empty description or cover URL clears it.
+type CollectionUpdate struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	CoverUrl    *string `json:"coverUrl,omitempty"`
+	Public      *bool   `json:"public,omitempty"`
+}
+
+const maxCollectionTitleLength = 4000
+
+// Returns an error unless title is a valid collection title: 1 to 4000
+// characters, not all whitespace. Any Unicode is allowed except a slash,
+// which can't be told apart from a path separator.
+func ValidateCollectionTitle(title string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title is required")
+	}
+
+	if strings.Contains(title, "/") {
+		return errors.New("title can't contain a slash")
+	}
+
+	if utf8.RuneCountInString(title) > maxCollectionTitleLength {
+		return errors.New("title must be at most 4000 characters")
+	}
+
+	return nil
+}
+
+// Returns the URL-safe form of a collection title: lower case letters
+// and digits, with everything else collapsed to single hyphens, e.g.
+// "Courses / Algorithms" becomes "courses-algorithms". Letters outside
+// ASCII are kept. Titles without letters or digits give "collection".
+func Slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+
+		hyphen = true
+	}
+
+	if b.Len() == 0 {
+		return "collection"
+	}
+
+	return b.String()
 }
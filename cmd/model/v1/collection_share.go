@@ -0,0 +1,65 @@
+package v1
+
+import "time"
+
+type CollectionShare struct {
+	ShareId   int        `validator:"required,min=1" json:"shareId"`
+	CreatedTs time.Time  `json:"createdTs"`
+	Title     string     `validator:"required,minLength=1" json:"title"`
+	Prefix    string     `json:"prefix"`
+	ExpiresTs *time.Time `validator:"optional" json:"expiresTs,omitempty"`
+	RevokedTs *time.Time `json:"revokedTs,omitempty"`
+}
+
+// The read-only view of a collection served to people without accounts.
+// Internal ids are left out.
+type SharedCollection struct {
+	Title string       `json:"title"`
+	Books []SharedBook `json:"books"`
+}
+
+type SharedBook struct {
+	Title       string       `json:"title"`
+	Author      SharedAuthor `json:"author"`
+	PublishDate *time.Time   `json:"publishDate,omitempty"`
+	Edition     *int         `json:"edition,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Genre       *string      `json:"genre,omitempty"`
+	Note        *string      `json:"note,omitempty"` // The collection's note on the book
+}
+
+type SharedAuthor struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// Returns the read-only view of c.
+func NewSharedCollection(c *Collection) SharedCollection {
+	shared := SharedCollection{
+		Title: c.Title,
+		Books: make([]SharedBook, len(c.Books)),
+	}
+
+	notes := map[int]*string{}
+
+	for _, e := range c.Entries {
+		notes[e.BookId] = e.Note
+	}
+
+	for i, b := range c.Books {
+		shared.Books[i] = SharedBook{
+			Title: b.Title,
+			Author: SharedAuthor{
+				FirstName: b.Author.FirstName,
+				LastName:  b.Author.LastName,
+			},
+			PublishDate: b.PublishDate,
+			Edition:     b.Edition,
+			Description: b.Description,
+			Genre:       b.Genre,
+			Note:        notes[b.BookId],
+		}
+	}
+
+	return shared
+}
@@ -0,0 +1,21 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SharedCollection", func() {
+	It("keeps the book order and notes without ids", func() {
+		note := "Chapters 1-3"
+		shared := NewSharedCollection(&Collection{
+			Title:   "syllabus",
+			Books:   []Book{{BookId: 9, Title: "SICP"}, {BookId: 4, Title: "CLRS"}},
+			Entries: []CollectionEntry{{BookId: 9, Position: 1, Note: &note}, {BookId: 4, Position: 2}},
+		})
+
+		Expect(shared.Books[0].Title).To(Equal("SICP"))
+		Expect(*shared.Books[0].Note).To(Equal(note))
+		Expect(shared.Books[1].Note).To(BeNil())
+	})
+})
@@ -0,0 +1,26 @@
+package v1
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collection", func() {
+	It("slugifies titles to lower case words joined by hyphens", func() {
+		Expect(Slugify("Courses / Algorithms")).To(Equal("courses-algorithms"))
+		Expect(Slugify("  Sci-Fi & Fantasy!  ")).To(Equal("sci-fi-fantasy"))
+		Expect(Slugify("Été 2024")).To(Equal("été-2024"))
+		Expect(Slugify("日本の小説")).To(Equal("日本の小説"))
+		Expect(Slugify("???")).To(Equal("collection"))
+	})
+
+	It("accepts any non-blank title up to the length limit", func() {
+		Expect(ValidateCollectionTitle("Cours d'été")).To(Succeed())
+		Expect(ValidateCollectionTitle("Lectures / été")).ToNot(Succeed())
+		Expect(ValidateCollectionTitle(" \t")).ToNot(Succeed())
+		Expect(ValidateCollectionTitle(strings.Repeat("é", 4000))).To(Succeed())
+		Expect(ValidateCollectionTitle(strings.Repeat("é", 4001))).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,32 @@
+package v1
+
+import "time"
+
+// A physical copy of a book (edition). LocationPath is read-only and
+// empty for copies without a location.
+type Copy struct {
+	CopyId       int        `json:"copyId"`
+	BookId       int        `validator:"required,min=1" json:"bookId"`
+	OwnerId      int        `json:"ownerId"`
+	CreatedTs    time.Time  `json:"createdTs"`
+	Condition    *string    `validator:"optional" json:"condition,omitempty"`
+	AcquiredTs   *time.Time `validator:"optional" json:"acquiredTs,omitempty"`
+	Price        *float64   `validator:"optional,min=0" json:"price,omitempty"`
+	LocationId   *int       `validator:"optional" json:"locationId,omitempty"`
+	LocationPath string     `json:"locationPath,omitempty"`
+	Moves        []CopyMove `json:"moves,omitempty"` // Set by CopyGet, oldest first
+}
+
+// A copy moved between locations. Nil locations are "not shelved".
+type CopyMove struct {
+	MoveId         int       `json:"moveId"`
+	MovedTs        time.Time `json:"movedTs"`
+	FromLocationId *int      `json:"fromLocationId,omitempty"`
+	ToLocationId   *int      `json:"toLocationId,omitempty"`
+}
+
+// Values to filter copies by. Nil fields are not filtered on.
+type CopyFilter struct {
+	BookId     *int
+	LocationId *int // Includes copies in locations inside it
+}
@@ -0,0 +1,8 @@
+package v1
+
+// An identifier other than the ISBN, e.g. an LCCN, OCLC number or ASIN.
+// Type is lower case.
+type Identifier struct {
+	Type  string `validator:"required,minLength=1" json:"type"`
+	Value string `validator:"required,minLength=1" json:"value"`
+}
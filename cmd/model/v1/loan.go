@@ -0,0 +1,31 @@
+package v1
+
+import "time"
+
+// A book lent to a borrower. A loan is active until ReturnedTs is set.
+type Loan struct {
+	LoanId     int        `json:"loanId"`
+	BookId     int        `validator:"required,min=1" json:"bookId"`
+	OwnerId    int        `json:"ownerId"`
+	Borrower   string     `validator:"required,minLength=1" json:"borrower"`
+	LoanedTs   time.Time  `json:"loanedTs"`
+	DueTs      *time.Time `validator:"optional" json:"dueTs,omitempty"`
+	ReturnedTs *time.Time `json:"returnedTs,omitempty"`
+	Note       *string    `validator:"optional" json:"note,omitempty"`
+}
+
+func (l *Loan) Active() bool {
+	return l.ReturnedTs == nil
+}
+
+// Returns true if the loan is active and was due before now.
+func (l *Loan) Overdue(now time.Time) bool {
+	return l.Active() && l.DueTs != nil && l.DueTs.Before(now)
+}
+
+// Values to filter loans by. Nil fields are not filtered on.
+type LoanFilter struct {
+	BookId  *int
+	Active  bool // Only loans not yet returned
+	Overdue bool // Only active loans past their due date
+}
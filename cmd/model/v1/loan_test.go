@@ -0,0 +1,21 @@
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loan", func() {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	past := now.AddDate(0, 0, -1)
+	future := now.AddDate(0, 0, 1)
+
+	It("is overdue only when active and past due", func() {
+		Expect((&Loan{DueTs: &past}).Overdue(now)).To(BeTrue())
+		Expect((&Loan{DueTs: &future}).Overdue(now)).To(BeFalse())
+		Expect((&Loan{}).Overdue(now)).To(BeFalse())
+		Expect((&Loan{DueTs: &past, ReturnedTs: &now}).Overdue(now)).To(BeFalse())
+	})
+})
@@ -0,0 +1,123 @@
+package v1
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Location kinds, outermost first. A location's kind defaults to the one
+// after its parent's.
+const (
+	LocationKindBuilding = "building"
+	LocationKindRoom     = "room"
+	LocationKindShelf    = "shelf"
+	LocationKindPosition = "position"
+)
+
+var LocationKinds = []string{
+	LocationKindBuilding,
+	LocationKindRoom,
+	LocationKindShelf,
+	LocationKindPosition,
+}
+
+func ValidLocationKind(kind string) bool {
+	for _, k := range LocationKinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the default kind of a location inside parentKind, or a building
+// for top level locations ("").
+func ChildLocationKind(parentKind string) string {
+	for i, k := range LocationKinds {
+		if k == parentKind && i+1 < len(LocationKinds) {
+			return LocationKinds[i+1]
+		}
+	}
+
+	if parentKind == "" {
+		return LocationKindBuilding
+	}
+
+	return LocationKindPosition
+}
+
+// A place copies are kept, e.g. a shelf in a room. Path is the names of
+// the location and its parents, e.g. "Office / Library / B3".
+type Location struct {
+	LocationId int       `json:"locationId"`
+	ParentId   *int      `validator:"optional" json:"parentId,omitempty"`
+	OwnerId    int       `json:"ownerId"`
+	CreatedTs  time.Time `json:"createdTs"`
+	Name       string    `validator:"required,minLength=1" json:"name"`
+	Kind       string    `validator:"optional" json:"kind"`
+	Path       string    `json:"path"`
+}
+
+const locationPathSeparator = " / "
+
+// Sets the Path of each location in locs, which must include every
+// location's parents, and sorts locs by path.
+func SetLocationPaths(locs []Location) {
+	byId := map[int]*Location{}
+	for i := range locs {
+		byId[locs[i].LocationId] = &locs[i]
+	}
+
+	for i := range locs {
+		names := []string{}
+		seen := map[int]bool{}
+
+		for l := &locs[i]; l != nil && !seen[l.LocationId]; {
+			seen[l.LocationId] = true
+			names = append([]string{l.Name}, names...)
+
+			if l.ParentId == nil {
+				break
+			}
+
+			l = byId[*l.ParentId]
+		}
+
+		locs[i].Path = strings.Join(names, locationPathSeparator)
+	}
+
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i].Path < locs[j].Path
+	})
+}
+
+// Returns the ids of the location id and every location inside it.
+func LocationDescendants(locs []Location, id int) []int {
+	children := map[int][]int{}
+	for _, l := range locs {
+		if l.ParentId != nil {
+			children[*l.ParentId] = append(children[*l.ParentId], l.LocationId)
+		}
+	}
+
+	ids := []int{}
+	seen := map[int]bool{}
+	queue := []int{id}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		if seen[next] {
+			continue
+		}
+
+		seen[next] = true
+		ids = append(ids, next)
+		queue = append(queue, children[next]...)
+	}
+
+	return ids
+}
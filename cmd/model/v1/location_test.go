@@ -0,0 +1,42 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Location", func() {
+	office, room := 1, 2
+
+	locs := func() []Location {
+		return []Location{
+			{LocationId: 3, ParentId: &room, Name: "B3", Kind: LocationKindShelf},
+			{LocationId: 1, Name: "Office", Kind: LocationKindBuilding},
+			{LocationId: 4, ParentId: &office, Name: "Attic", Kind: LocationKindRoom},
+			{LocationId: 2, ParentId: &office, Name: "Library", Kind: LocationKindRoom},
+		}
+	}
+
+	It("sets paths and sorts by them", func() {
+		l := locs()
+		SetLocationPaths(l)
+
+		Expect(l).To(HaveLen(4))
+		Expect(l[0].Path).To(Equal("Office"))
+		Expect(l[1].Path).To(Equal("Office / Attic"))
+		Expect(l[2].Path).To(Equal("Office / Library"))
+		Expect(l[3].Path).To(Equal("Office / Library / B3"))
+	})
+
+	It("finds the locations inside a location", func() {
+		Expect(LocationDescendants(locs(), office)).To(ConsistOf(1, 2, 3, 4))
+		Expect(LocationDescendants(locs(), room)).To(ConsistOf(2, 3))
+		Expect(LocationDescendants(locs(), 3)).To(ConsistOf(3))
+	})
+
+	It("defaults kinds to the one below the parent's", func() {
+		Expect(ChildLocationKind("")).To(Equal(LocationKindBuilding))
+		Expect(ChildLocationKind(LocationKindRoom)).To(Equal(LocationKindShelf))
+		Expect(ChildLocationKind(LocationKindPosition)).To(Equal(LocationKindPosition))
+	})
+})
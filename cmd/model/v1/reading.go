@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReadingStatusWantToRead = "want-to-read"
+	ReadingStatusReading    = "reading"
+	ReadingStatusFinished   = "finished"
+	ReadingStatusAbandoned  = "abandoned"
+)
+
+var ReadingStatuses = []string{
+	ReadingStatusWantToRead,
+	ReadingStatusReading,
+	ReadingStatusFinished,
+	ReadingStatusAbandoned,
+}
+
+func ValidReadingStatus(status string) bool {
+	for _, s := range ReadingStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A user's reading state of a book. History lists the updates that led
+// to it, oldest first.
+type ReadingState struct {
+	BookId     int              `json:"bookId"`
+	UserId     int              `json:"userId"`
+	Status     string           `json:"status"`
+	StartedTs  *time.Time       `json:"startedTs,omitempty"`
+	FinishedTs *time.Time       `json:"finishedTs,omitempty"`
+	Page       *int             `json:"page,omitempty"`
+	Percent    *float64         `json:"percent,omitempty"`
+	UpdatedTs  time.Time        `json:"updatedTs"`
+	History    []ProgressUpdate `json:"history"`
+}
+
+// A progress update. Fields not set are left unchanged on the state;
+// in the history, Status is the status after the update.
+type ProgressUpdate struct {
+	ProgressId int        `json:"progressId,omitempty"`
+	CreatedTs  time.Time  `json:"createdTs,omitempty"`
+	Status     *string    `validator:"optional" json:"status,omitempty"`
+	Page       *int       `validator:"optional,min=0" json:"page,omitempty"`
+	Percent    *float64   `validator:"optional,min=0,max=100" json:"percent,omitempty"`
+	StartedTs  *time.Time `validator:"optional" json:"startedTs,omitempty"`
+	FinishedTs *time.Time `validator:"optional" json:"finishedTs,omitempty"`
+}
+
+func (u *ProgressUpdate) Validate() error {
+	if u.Status != nil && !ValidReadingStatus(*u.Status) {
+		return errors.New("status must be one of want-to-read, reading, finished or abandoned")
+	}
+
+	if u.Page != nil && *u.Page < 0 {
+		return errors.New("page must not be negative")
+	}
+
+	if u.Percent != nil && (*u.Percent < 0 || *u.Percent > 100) {
+		return errors.New("percent must be between 0 and 100")
+	}
+
+	return nil
+}
+
+// Applies u to s at time now. Progress without a status marks the book as
+// being read; starting and finishing set the dates unless u gives them.
+// Starting a finished or abandoned book again begins a re-read.
+func (s *ReadingState) Apply(u *ProgressUpdate, now time.Time) {
+	previous := s.Status
+
+	switch {
+	case u.Status != nil:
+		s.Status = *u.Status
+	case u.Page != nil || u.Percent != nil:
+		if s.Status == "" || s.Status == ReadingStatusWantToRead {
+			s.Status = ReadingStatusReading
+		}
+	case s.Status == "":
+		s.Status = ReadingStatusWantToRead
+	}
+
+	if s.Status != previous {
+		switch s.Status {
+		case ReadingStatusReading:
+			if previous == ReadingStatusFinished || previous == ReadingStatusAbandoned || s.StartedTs == nil {
+				s.StartedTs = &now
+				s.FinishedTs = nil
+				s.Page, s.Percent = nil, nil
+			}
+		case ReadingStatusFinished, ReadingStatusAbandoned:
+			s.FinishedTs = &now
+		case ReadingStatusWantToRead:
+			s.StartedTs, s.FinishedTs = nil, nil
+			s.Page, s.Percent = nil, nil
+		}
+	}
+
+	if u.Page != nil {
+		s.Page = u.Page
+	}
+
+	if u.Percent != nil {
+		s.Percent = u.Percent
+	}
+
+	if s.Status == ReadingStatusFinished && u.Percent == nil {
+		done := 100.0
+		s.Percent = &done
+	}
+
+	if u.StartedTs != nil {
+		s.StartedTs = u.StartedTs
+	}
+
+	if u.FinishedTs != nil {
+		s.FinishedTs = u.FinishedTs
+	}
+
+	s.UpdatedTs = now
+}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadingState", func() {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	status := func(s string) *string { return &s }
+	page := func(p int) *int { return &p }
+
+	It("starts reading when progress is recorded", func() {
+		s := &ReadingState{}
+		s.Apply(&ProgressUpdate{Page: page(10)}, day(1))
+
+		Expect(s.Status).To(Equal(ReadingStatusReading))
+		Expect(*s.StartedTs).To(Equal(day(1)))
+		Expect(*s.Page).To(Equal(10))
+	})
+
+	It("keeps the start date and sets the finish date", func() {
+		s := &ReadingState{}
+		s.Apply(&ProgressUpdate{Status: status(ReadingStatusReading)}, day(1))
+		s.Apply(&ProgressUpdate{Page: page(50)}, day(2))
+		s.Apply(&ProgressUpdate{Status: status(ReadingStatusFinished)}, day(3))
+
+		Expect(*s.StartedTs).To(Equal(day(1)))
+		Expect(*s.FinishedTs).To(Equal(day(3)))
+		Expect(*s.Percent).To(Equal(100.0))
+	})
+
+	It("begins a re-read after finishing", func() {
+		s := &ReadingState{}
+		s.Apply(&ProgressUpdate{Status: status(ReadingStatusFinished)}, day(1))
+		s.Apply(&ProgressUpdate{Status: status(ReadingStatusReading)}, day(5))
+
+		Expect(*s.StartedTs).To(Equal(day(5)))
+		Expect(s.FinishedTs).To(BeNil())
+		Expect(s.Percent).To(BeNil())
+	})
+
+	It("prefers given dates", func() {
+		started := day(2)
+		s := &ReadingState{}
+		s.Apply(&ProgressUpdate{Status: status(ReadingStatusReading), StartedTs: &started}, day(9))
+
+		Expect(*s.StartedTs).To(Equal(started))
+	})
+
+	It("validates updates", func() {
+		percent := 101.0
+		Expect((&ProgressUpdate{Status: status("skimmed")}).Validate()).ToNot(Succeed())
+		Expect((&ProgressUpdate{Percent: &percent}).Validate()).ToNot(Succeed())
+		Expect((&ProgressUpdate{Page: page(-1)}).Validate()).ToNot(Succeed())
+		Expect((&ProgressUpdate{Page: page(1)}).Validate()).To(Succeed())
+	})
+})
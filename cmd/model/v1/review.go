@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	MinRating = 0.5
+	MaxRating = 5.0
+)
+
+// A user's rating and review of a book. Each user has at most one review
+// per book; either field may be left out. Body is markdown.
+type Review struct {
+	BookId    int       `json:"bookId"`
+	UserId    int       `json:"userId"`
+	Username  string    `json:"username"` // Read-only
+	Rating    *float64  `validator:"optional" json:"rating,omitempty"`
+	Body      *string   `validator:"optional" json:"body,omitempty"`
+	CreatedTs time.Time `json:"createdTs"`
+	UpdatedTs time.Time `json:"updatedTs"`
+}
+
+// Checks the rating is between MinRating and MaxRating in half stars.
+func (r *Review) Validate() error {
+	if r.Rating == nil && r.Body == nil {
+		return errors.New("a review needs a rating or body")
+	}
+
+	if r.Rating != nil {
+		rating := *r.Rating
+
+		if rating < MinRating || rating > MaxRating || rating*2 != math.Trunc(rating*2) {
+			return errors.New("rating must be between 0.5 and 5 in steps of 0.5")
+		}
+	}
+
+	return nil
+}
+
+// A private note on a book, optionally quoting a highlighted passage from
+// a page. Notes are only visible to the user who wrote them.
+type Note struct {
+	NoteId    int       `json:"noteId"`
+	BookId    int       `json:"bookId"`
+	UserId    int       `json:"userId"`
+	Page      *int      `validator:"optional,min=1" json:"page,omitempty"`
+	Highlight *string   `validator:"optional" json:"highlight,omitempty"`
+	Body      string    `json:"body"`
+	CreatedTs time.Time `json:"createdTs"`
+	UpdatedTs time.Time `json:"updatedTs"`
+}
+
+// Book sort orders for BookFilter
+const (
+	BookSortRating = "rating" // Highest average rating first, unrated last
+)
@@ -0,0 +1,31 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Review", func() {
+	rated := func(rating float64) *Review {
+		return &Review{Rating: &rating}
+	}
+
+	It("accepts half stars from 0.5 to 5", func() {
+		Expect(rated(0.5).Validate()).To(Succeed())
+		Expect(rated(3.5).Validate()).To(Succeed())
+		Expect(rated(5).Validate()).To(Succeed())
+	})
+
+	It("rejects other ratings", func() {
+		Expect(rated(0).Validate()).ToNot(Succeed())
+		Expect(rated(3.25).Validate()).ToNot(Succeed())
+		Expect(rated(5.5).Validate()).ToNot(Succeed())
+	})
+
+	It("needs a rating or body", func() {
+		Expect((&Review{}).Validate()).ToNot(Succeed())
+
+		body := "Loved it"
+		Expect((&Review{Body: &body}).Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,28 @@
+package v1
+
+import "time"
+
+// A series of books, e.g. a trilogy. Entries are set by SeriesGet, in
+// series order.
+type Series struct {
+	SeriesId    int           `json:"seriesId"`
+	OwnerId     int           `json:"ownerId"`
+	CreatedTs   time.Time     `json:"createdTs"`
+	Name        string        `validator:"required,minLength=1" json:"name"`
+	Description *string       `validator:"optional" json:"description,omitempty"`
+	Entries     []SeriesEntry `json:"entries,omitempty"`
+}
+
+// A book's place in a series. Positions may be fractional, e.g. 2.5 for a
+// novella set between volumes 2 and 3.
+type SeriesEntry struct {
+	Position float64 `json:"position"`
+	Book     Book    `json:"book"`
+}
+
+// The series block of a book.
+type BookSeries struct {
+	SeriesId int     `json:"seriesId"`
+	Name     string  `json:"name"`
+	Position float64 `json:"position"`
+}
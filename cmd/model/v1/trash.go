@@ -0,0 +1,32 @@
+package v1
+
+import "time"
+
+// How long removed books and collections are kept in the trash before
+// they are purged, by default.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// The books and collections a user has removed, newest first. Books keep
+// their collection memberships until purged.
+type Trash struct {
+	Books       []Book       `json:"books"`
+	Collections []Collection `json:"collections"`
+}
+
+// The number of books and collections a purge deleted for good.
+type TrashPurgeReport struct {
+	Books       int `json:"books"`
+	Collections int `json:"collections"`
+}
+
+// Returns the time before which trashed items are purged, or nil if
+// retention is 0 and the trash is kept until purged by hand.
+func TrashPurgeCutoff(now time.Time, retention time.Duration) *time.Time {
+	if retention <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-retention)
+
+	return &cutoff
+}
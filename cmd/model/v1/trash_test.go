@@ -0,0 +1,20 @@
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TrashPurgeCutoff", func() {
+	It("purges what was removed before the retention", func() {
+		now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+		Expect(*TrashPurgeCutoff(now, DefaultTrashRetention)).To(Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+	})
+
+	It("keeps the trash with no retention", func() {
+		Expect(TrashPurgeCutoff(time.Now(), 0)).To(BeNil())
+	})
+})
@@ -0,0 +1,18 @@
+package v1
+
+import "time"
+
+const UserRoleAdmin = "admin"
+const UserRoleMember = "member"
+
+type User struct {
+	UserId    int       `validator:"required,min=1" json:"userId"`
+	CreatedTs time.Time `json:"createdTs"`
+	Username  string    `validator:"required,minLength=1" json:"username"`
+	Role      string    `validator:"required" json:"role"`
+}
+
+// Returns true if the user may act on other users' data.
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A work groups the editions (books) of the same text, including its
+// translations. Editions are set by WorkGet, oldest first.
+type Work struct {
+	WorkId           int        `json:"workId"`
+	OwnerId          int        `json:"ownerId"`
+	CreatedTs        time.Time  `json:"createdTs"`
+	Title            string     `validator:"required,minLength=1" json:"title"`
+	OriginalLanguage *string    `validator:"optional" json:"originalLanguage,omitempty"`
+	FirstPublished   *time.Time `validator:"optional" json:"firstPublished,omitempty"`
+	Editions         []Book     `json:"editions,omitempty"`
+}
+
+// Leading articles ignored when comparing titles
+var titleArticles = []string{"the ", "a ", "an "}
+
+// Drops a leading article from a lower-cased title, e.g. "the dispossessed"
+// becomes "dispossessed". Used wherever titles are compared, so books
+// grouped into works and books found to be duplicates agree.
+func TrimArticle(title string) string {
+	for _, article := range titleArticles {
+		title = strings.TrimPrefix(title, article)
+	}
+
+	return title
+}
+
+// Returns the key books are grouped into works by: the title without
+// subtitle, leading article, case or punctuation, and the author's name.
+func WorkKey(b *Book) string {
+	normalize := func(s string) string {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+
+			return ' '
+		}, s)
+
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	title, _, _ := strings.Cut(b.Title, ":")
+	title = TrimArticle(normalize(title))
+
+	return strings.Join([]string{
+		title,
+		normalize(b.Author.FirstName),
+		normalize(b.Author.LastName),
+	}, "\x00")
+}
+
+// Returns groups of books with the same WorkKey that are spread over more
+// than one work, each sorted by work then book id. The first book's work
+// is the suggested work to group the rest into.
+func SuggestWorkGroups(books []Book) [][]Book {
+	byKey := map[string][]Book{}
+	keys := []string{}
+
+	for _, b := range books {
+		key := WorkKey(&b)
+
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		byKey[key] = append(byKey[key], b)
+	}
+
+	groups := [][]Book{}
+
+	for _, key := range keys {
+		group := byKey[key]
+
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].WorkId != group[j].WorkId {
+				return group[i].WorkId < group[j].WorkId
+			}
+
+			return group[i].BookId < group[j].BookId
+		})
+
+		if group[0].WorkId != group[len(group)-1].WorkId {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,34 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Work", func() {
+	herbert := Author{FirstName: "Frank", LastName: "Herbert"}
+
+	It("ignores subtitles, articles, case and punctuation", func() {
+		a := &Book{Title: "Dune", Author: herbert}
+		b := &Book{Title: "DUNE: 50th Anniversary Edition", Author: herbert}
+		c := &Book{Title: "The Dune!", Author: herbert}
+
+		Expect(WorkKey(b)).To(Equal(WorkKey(a)))
+		Expect(WorkKey(c)).To(Equal(WorkKey(a)))
+		Expect(WorkKey(&Book{Title: "Dune Messiah", Author: herbert})).ToNot(Equal(WorkKey(a)))
+	})
+
+	It("suggests groups spread over several works", func() {
+		books := []Book{
+			{BookId: 3, WorkId: 3, Title: "Dune: Deluxe Edition", Author: herbert},
+			{BookId: 1, WorkId: 1, Title: "Dune", Author: herbert},
+			{BookId: 2, WorkId: 2, Title: "Dune Messiah", Author: herbert},
+			{BookId: 4, WorkId: 2, Title: "Dune Messiah", Author: herbert},
+		}
+
+		groups := SuggestWorkGroups(books)
+		Expect(groups).To(HaveLen(1))
+		Expect(groups[0][0].BookId).To(Equal(1))
+		Expect(groups[0][1].BookId).To(Equal(3))
+	})
+})
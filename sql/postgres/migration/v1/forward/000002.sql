@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS v1.api_key (
+	api_key_id serial4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	name text NOT NULL,
+	prefix text NOT NULL,
+	key_hash text NOT NULL,
+	scope text NOT NULL,
+	revoked_ts timestamp NULL,
+	CONSTRAINT api_key_pk PRIMARY KEY (api_key_id),
+	CONSTRAINT api_key_hash_un UNIQUE (key_hash),
+	CONSTRAINT api_key_scope_ck CHECK (scope IN ('read', 'read-write'))
+);
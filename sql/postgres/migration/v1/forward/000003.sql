@@ -0,0 +1,56 @@
+CREATE TABLE IF NOT EXISTS v1.app_user (
+	user_id serial4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	username text NOT NULL,
+	role text NOT NULL DEFAULT 'member',
+	CONSTRAINT app_user_pk PRIMARY KEY (user_id),
+	CONSTRAINT app_user_username_un UNIQUE (username),
+	CONSTRAINT app_user_role_ck CHECK (role IN ('admin', 'member'))
+);
+
+-- Existing books, collections and keys are given to an initial admin
+INSERT INTO v1.app_user (username, role) VALUES ('admin', 'admin') ON CONFLICT (username) DO NOTHING;
+
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS owner_id int4 NULL;
+UPDATE v1.book SET owner_id = (SELECT user_id FROM v1.app_user WHERE username = 'admin') WHERE owner_id IS NULL;
+ALTER TABLE v1.book ALTER COLUMN owner_id SET NOT NULL;
+
+ALTER TABLE v1.api_key ADD COLUMN IF NOT EXISTS user_id int4 NULL;
+UPDATE v1.api_key SET user_id = (SELECT user_id FROM v1.app_user WHERE username = 'admin') WHERE user_id IS NULL;
+ALTER TABLE v1.api_key ALTER COLUMN user_id SET NOT NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'book_owner_fk') THEN
+		ALTER TABLE v1.book ADD CONSTRAINT book_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id);
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'api_key_user_fk') THEN
+		ALTER TABLE v1.api_key ADD CONSTRAINT api_key_user_fk FOREIGN KEY (user_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE;
+	END IF;
+END $$;
+
+-- Collections are keyed by owner and title so each user may reuse titles
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS owner_id int4 NULL;
+UPDATE v1.collection SET owner_id = (SELECT user_id FROM v1.app_user WHERE username = 'admin') WHERE owner_id IS NULL;
+ALTER TABLE v1.collection ALTER COLUMN owner_id SET NOT NULL;
+
+ALTER TABLE v1.collection_books ADD COLUMN IF NOT EXISTS owner_id int4 NULL;
+UPDATE v1.collection_books cb SET owner_id = c.owner_id FROM v1.collection c WHERE c.title = cb.title AND cb.owner_id IS NULL;
+ALTER TABLE v1.collection_books ALTER COLUMN owner_id SET NOT NULL;
+
+-- Collections are re-keyed once; later migrations add constraints that
+-- depend on the new key, so it isn't dropped again on a rerun
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'collection_owner_fk') THEN
+		ALTER TABLE v1.collection_books DROP CONSTRAINT IF EXISTS collection_books_collection_fk;
+		ALTER TABLE v1.collection_books DROP CONSTRAINT IF EXISTS collection_books_un;
+		ALTER TABLE v1.collection DROP CONSTRAINT IF EXISTS collection_pk;
+
+		ALTER TABLE v1.collection ADD CONSTRAINT collection_pk PRIMARY KEY (owner_id, title);
+		ALTER TABLE v1.collection ADD CONSTRAINT collection_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE;
+		ALTER TABLE v1.collection_books ADD CONSTRAINT collection_books_un UNIQUE (owner_id, title, book_id);
+		ALTER TABLE v1.collection_books ADD CONSTRAINT collection_books_collection_fk FOREIGN KEY (owner_id, title) REFERENCES v1.collection(owner_id, title) ON DELETE CASCADE ON UPDATE CASCADE;
+	END IF;
+END $$;
@@ -0,0 +1,15 @@
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS public boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS v1.collection_share (
+	share_id serial4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	owner_id int4 NOT NULL,
+	title text NOT NULL,
+	prefix text NOT NULL,
+	token_hash text NOT NULL,
+	expires_ts timestamp NULL,
+	revoked_ts timestamp NULL,
+	CONSTRAINT collection_share_pk PRIMARY KEY (share_id),
+	CONSTRAINT collection_share_token_un UNIQUE (token_hash),
+	CONSTRAINT collection_share_collection_fk FOREIGN KEY (owner_id, title) REFERENCES v1.collection(owner_id, title) ON DELETE CASCADE ON UPDATE CASCADE
+);
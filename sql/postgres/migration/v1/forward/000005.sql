@@ -0,0 +1,15 @@
+-- ISBNs are stored in ISBN-13 form; the ISBN-10 is derived on read
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS isbn13 text NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_owner_isbn13_un ON v1.book (owner_id, isbn13);
+
+-- Other identifiers, e.g. LCCN, OCLC or ASIN
+CREATE TABLE IF NOT EXISTS v1.book_identifier (
+	book_id int4 NOT NULL,
+	type text NOT NULL,
+	value text NOT NULL,
+	CONSTRAINT book_identifier_pk PRIMARY KEY (book_id, type, value),
+	CONSTRAINT book_identifier_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS book_identifier_value_idx ON v1.book_identifier (type, value);
@@ -0,0 +1,30 @@
+-- Each user's reading state of a book
+CREATE TABLE IF NOT EXISTS v1.reading_state (
+	user_id int4 NOT NULL,
+	book_id int4 NOT NULL,
+	status text NOT NULL,
+	started_ts timestamp NULL,
+	finished_ts timestamp NULL,
+	page int4 NULL,
+	percent numeric(5,2) NULL,
+	updated_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT reading_state_pk PRIMARY KEY (user_id, book_id),
+	CONSTRAINT reading_state_user_fk FOREIGN KEY (user_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE,
+	CONSTRAINT reading_state_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE,
+	CONSTRAINT reading_state_status_ck CHECK (status IN ('want-to-read', 'reading', 'finished', 'abandoned'))
+);
+
+CREATE INDEX IF NOT EXISTS reading_state_status_idx ON v1.reading_state (user_id, status);
+
+-- Every progress update, for reading history
+CREATE TABLE IF NOT EXISTS v1.reading_progress (
+	progress_id serial4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id int4 NOT NULL,
+	book_id int4 NOT NULL,
+	status text NOT NULL,
+	page int4 NULL,
+	percent numeric(5,2) NULL,
+	CONSTRAINT reading_progress_pk PRIMARY KEY (progress_id),
+	CONSTRAINT reading_progress_state_fk FOREIGN KEY (user_id, book_id) REFERENCES v1.reading_state(user_id, book_id) ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS v1.loan (
+	loan_id serial4 NOT NULL,
+	book_id int4 NOT NULL,
+	owner_id int4 NOT NULL,
+	borrower text NOT NULL,
+	loaned_ts timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	due_ts timestamp NULL,
+	returned_ts timestamp NULL,
+	note text NULL,
+	CONSTRAINT loan_pk PRIMARY KEY (loan_id),
+	CONSTRAINT loan_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE,
+	CONSTRAINT loan_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE
+);
+
+-- A book can only be lent to one borrower at a time
+CREATE UNIQUE INDEX IF NOT EXISTS loan_book_active_un ON v1.loan (book_id) WHERE returned_ts IS NULL;
+
+CREATE INDEX IF NOT EXISTS loan_due_idx ON v1.loan (due_ts) WHERE returned_ts IS NULL;
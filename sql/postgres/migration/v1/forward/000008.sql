@@ -0,0 +1,45 @@
+-- Hierarchical locations, e.g. building > room > shelf > position
+CREATE TABLE IF NOT EXISTS v1.location (
+	location_id serial4 NOT NULL,
+	parent_id int4 NULL,
+	owner_id int4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	name text NOT NULL,
+	kind text NOT NULL,
+	CONSTRAINT location_pk PRIMARY KEY (location_id),
+	CONSTRAINT location_parent_fk FOREIGN KEY (parent_id) REFERENCES v1.location(location_id),
+	CONSTRAINT location_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE,
+	CONSTRAINT location_kind_ck CHECK (kind IN ('building', 'room', 'shelf', 'position'))
+);
+
+-- Physical copies of a book
+CREATE TABLE IF NOT EXISTS v1.book_copy (
+	copy_id serial4 NOT NULL,
+	book_id int4 NOT NULL,
+	owner_id int4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	condition text NULL,
+	acquired_ts timestamp NULL,
+	price numeric(10,2) NULL,
+	location_id int4 NULL,
+	CONSTRAINT book_copy_pk PRIMARY KEY (copy_id),
+	CONSTRAINT book_copy_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE,
+	CONSTRAINT book_copy_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE,
+	CONSTRAINT book_copy_location_fk FOREIGN KEY (location_id) REFERENCES v1.location(location_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS book_copy_book_idx ON v1.book_copy (book_id);
+CREATE INDEX IF NOT EXISTS book_copy_location_idx ON v1.book_copy (location_id);
+
+-- Where copies have been moved from and to
+CREATE TABLE IF NOT EXISTS v1.book_copy_move (
+	move_id serial4 NOT NULL,
+	copy_id int4 NOT NULL,
+	moved_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	from_location_id int4 NULL,
+	to_location_id int4 NULL,
+	CONSTRAINT book_copy_move_pk PRIMARY KEY (move_id),
+	CONSTRAINT book_copy_move_copy_fk FOREIGN KEY (copy_id) REFERENCES v1.book_copy(copy_id) ON DELETE CASCADE,
+	CONSTRAINT book_copy_move_from_fk FOREIGN KEY (from_location_id) REFERENCES v1.location(location_id) ON DELETE SET NULL,
+	CONSTRAINT book_copy_move_to_fk FOREIGN KEY (to_location_id) REFERENCES v1.location(location_id) ON DELETE SET NULL
+);
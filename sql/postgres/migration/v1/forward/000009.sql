@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS v1.series (
+	series_id serial4 NOT NULL,
+	owner_id int4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	name text NOT NULL,
+	description text NULL,
+	CONSTRAINT series_pk PRIMARY KEY (series_id),
+	CONSTRAINT series_owner_name_un UNIQUE (owner_id, name),
+	CONSTRAINT series_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE
+);
+
+-- A book is in at most one series. Positions may be fractional, e.g. 2.5
+-- for a novella between volumes 2 and 3.
+CREATE TABLE IF NOT EXISTS v1.series_entry (
+	book_id int4 NOT NULL,
+	series_id int4 NOT NULL,
+	position numeric(8,2) NOT NULL,
+	CONSTRAINT series_entry_pk PRIMARY KEY (book_id),
+	CONSTRAINT series_entry_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE,
+	CONSTRAINT series_entry_series_fk FOREIGN KEY (series_id) REFERENCES v1.series(series_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS series_entry_series_idx ON v1.series_entry (series_id, position);
@@ -0,0 +1,33 @@
+-- Each user's rating and review of a book
+CREATE TABLE IF NOT EXISTS v1.review (
+	user_id int4 NOT NULL,
+	book_id int4 NOT NULL,
+	rating numeric(2,1) NULL,
+	body text NULL,
+	created_ts timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_ts timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT review_pk PRIMARY KEY (user_id, book_id),
+	CONSTRAINT review_user_fk FOREIGN KEY (user_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE,
+	CONSTRAINT review_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE,
+	-- Half stars from 0.5 to 5
+	CONSTRAINT review_rating_ck CHECK (rating BETWEEN 0.5 AND 5 AND rating * 2 = trunc(rating * 2))
+);
+
+CREATE INDEX IF NOT EXISTS review_book_idx ON v1.review (book_id);
+
+-- Private notes and highlights
+CREATE TABLE IF NOT EXISTS v1.note (
+	note_id serial4 NOT NULL,
+	user_id int4 NOT NULL,
+	book_id int4 NOT NULL,
+	page int4 NULL,
+	highlight text NULL,
+	body text NOT NULL,
+	created_ts timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_ts timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT note_pk PRIMARY KEY (note_id),
+	CONSTRAINT note_user_fk FOREIGN KEY (user_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE,
+	CONSTRAINT note_book_fk FOREIGN KEY (book_id) REFERENCES v1.book(book_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS note_user_book_idx ON v1.note (user_id, book_id);
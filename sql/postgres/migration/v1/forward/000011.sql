@@ -0,0 +1,40 @@
+-- Works group the editions (books) of the same text
+CREATE TABLE IF NOT EXISTS v1.work (
+	work_id serial4 NOT NULL,
+	owner_id int4 NOT NULL,
+	created_ts timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+	title text NOT NULL,
+	original_language text NULL,
+	first_published timestamp NULL,
+	CONSTRAINT work_pk PRIMARY KEY (work_id),
+	CONSTRAINT work_owner_fk FOREIGN KEY (owner_id) REFERENCES v1.app_user(user_id) ON DELETE CASCADE
+);
+
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS work_id int4 NULL;
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS language text NULL;
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS translation_of int4 NULL;
+
+-- Each existing book becomes its own work, reusing the book id
+INSERT INTO v1.work (work_id, owner_id, created_ts, title, first_published)
+SELECT b.book_id, b.owner_id, b.created_ts, b.title, b.publish_date
+FROM v1.book b
+WHERE b.work_id IS NULL;
+
+UPDATE v1.book SET work_id = book_id WHERE work_id IS NULL;
+
+SELECT setval(pg_get_serial_sequence('v1.work', 'work_id'), COALESCE(max(work_id), 0) + 1, false) FROM v1.work;
+
+ALTER TABLE v1.book ALTER COLUMN work_id SET NOT NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'book_work_fk') THEN
+		ALTER TABLE v1.book ADD CONSTRAINT book_work_fk FOREIGN KEY (work_id) REFERENCES v1.work(work_id);
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'book_translation_of_fk') THEN
+		ALTER TABLE v1.book ADD CONSTRAINT book_translation_of_fk FOREIGN KEY (translation_of) REFERENCES v1.book(book_id) ON DELETE SET NULL;
+	END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS book_work_idx ON v1.book (work_id);
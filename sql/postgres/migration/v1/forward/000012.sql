@@ -0,0 +1,4 @@
+-- Supports the duplicate check on book create: title (ignoring case),
+-- author, edition and publish date. Migration 000020 makes them unique
+-- per owner once existing duplicates are merged with `goshelf dedupe`.
+CREATE INDEX IF NOT EXISTS book_identity_idx ON v1.book (owner_id, author_id, lower(title));
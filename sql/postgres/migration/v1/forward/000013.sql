@@ -0,0 +1,3 @@
+-- Smart collections store a book filter instead of members. A collection
+-- with a filter has no rows in collection_books.
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS filter jsonb NULL;
@@ -0,0 +1,15 @@
+-- Collections are ordered by position, 1 for the first book. Existing
+-- memberships are ordered by book id.
+ALTER TABLE v1.collection_books ADD COLUMN IF NOT EXISTS position int4 NULL;
+ALTER TABLE v1.collection_books ADD COLUMN IF NOT EXISTS note text NULL;
+
+UPDATE v1.collection_books cb SET position = ordered.position
+FROM (
+	SELECT owner_id, title, book_id,
+		row_number() OVER (PARTITION BY owner_id, title ORDER BY book_id) AS position
+	FROM v1.collection_books
+) ordered
+WHERE cb.owner_id = ordered.owner_id AND cb.title = ordered.title AND cb.book_id = ordered.book_id
+	AND cb.position IS NULL;
+
+ALTER TABLE v1.collection_books ALTER COLUMN position SET NOT NULL;
@@ -0,0 +1,12 @@
+-- Collections can be nested under a parent collection of the same owner.
+-- Root collections have no parent.
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS parent_title text NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'collection_parent_fk') THEN
+		ALTER TABLE v1.collection ADD CONSTRAINT collection_parent_fk FOREIGN KEY (owner_id, parent_title) REFERENCES v1.collection(owner_id, title) ON UPDATE CASCADE;
+	END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS collection_parent_idx ON v1.collection (owner_id, parent_title);
@@ -0,0 +1,59 @@
+-- Collections get a surrogate id and a URL-safe slug, unique per owner, so
+-- they can be renamed and looked up when their title isn't URL-safe. The
+-- owner and title stay unique and are still what memberships, shares and
+-- parents reference; those references follow a rename.
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS collection_id serial NOT NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'collection_id_un') THEN
+		ALTER TABLE v1.collection ADD CONSTRAINT collection_id_un UNIQUE (collection_id);
+	END IF;
+END $$;
+
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS slug text NULL;
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS description text NULL;
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS cover_url text NULL;
+
+-- Slugs are made as v1.Slugify makes them: lowercase letters and digits,
+-- with hyphens between runs. Titles are slugged in creation order and a
+-- slug already given out is numbered with the next free number, e.g.
+-- "Reading List", "reading list" and "reading-list-2" get reading-list,
+-- reading-list-2 and reading-list-2-2.
+DO $$
+DECLARE
+	c record;
+	base text;
+	candidate text;
+	n int;
+BEGIN
+	FOR c IN
+		SELECT owner_id, title FROM v1.collection
+		WHERE slug IS NULL
+		ORDER BY owner_id, created_ts, title
+	LOOP
+		base := COALESCE(NULLIF(trim(BOTH '-' FROM regexp_replace(lower(c.title), '[^[:alnum:]]+', '-', 'g')), ''), 'collection');
+		candidate := base;
+		n := 1;
+
+		WHILE EXISTS (
+			SELECT 1 FROM v1.collection s
+			WHERE s.owner_id = c.owner_id AND s.slug = candidate
+		) LOOP
+			n := n + 1;
+			candidate := base || '-' || n;
+		END LOOP;
+
+		UPDATE v1.collection SET slug = candidate
+		WHERE owner_id = c.owner_id AND title = c.title;
+	END LOOP;
+END $$;
+
+ALTER TABLE v1.collection ALTER COLUMN slug SET NOT NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'collection_slug_un') THEN
+		ALTER TABLE v1.collection ADD CONSTRAINT collection_slug_un UNIQUE (owner_id, slug);
+	END IF;
+END $$;
@@ -0,0 +1,33 @@
+-- Every create, update and delete of a book, author or collection, written
+-- in the same transaction as the change. Actors aren't foreign keys so the
+-- log outlives the users and rows it describes.
+CREATE TABLE IF NOT EXISTS v1.audit_log (
+	audit_id bigserial NOT NULL,
+	created_ts timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	actor_id int4 NULL,
+	actor text NULL,
+	owner_id int4 NULL,
+	entity text NOT NULL,
+	entity_id int4 NOT NULL,
+	action text NOT NULL,
+	before jsonb NULL,
+	after jsonb NULL,
+	CONSTRAINT audit_log_pk PRIMARY KEY (audit_id),
+	CONSTRAINT audit_log_entity_ck CHECK (entity IN ('book', 'author', 'collection')),
+	CONSTRAINT audit_log_action_ck CHECK (action IN ('create', 'update', 'delete'))
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON v1.audit_log (entity, entity_id, created_ts);
+CREATE INDEX IF NOT EXISTS audit_log_created_ts_idx ON v1.audit_log (created_ts);
+
+-- The log is append-only
+CREATE OR REPLACE FUNCTION v1.audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only_tr ON v1.audit_log;
+CREATE TRIGGER audit_log_append_only_tr
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON v1.audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION v1.audit_log_append_only();
@@ -0,0 +1,8 @@
+-- Removed books and collections go to the trash instead of being deleted,
+-- so they can be restored with their collection memberships. They are
+-- deleted for good when purged.
+ALTER TABLE v1.book ADD COLUMN IF NOT EXISTS deleted_ts timestamptz NULL;
+ALTER TABLE v1.collection ADD COLUMN IF NOT EXISTS deleted_ts timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS book_deleted_ts_idx ON v1.book (deleted_ts) WHERE deleted_ts IS NOT NULL;
+CREATE INDEX IF NOT EXISTS collection_deleted_ts_idx ON v1.collection (deleted_ts) WHERE deleted_ts IS NOT NULL;
@@ -0,0 +1,13 @@
+-- Entries written by an undo point at the entry they reverse. Each entry
+-- is undone at most once, and undos aren't undone themselves.
+ALTER TABLE v1.audit_log ADD COLUMN IF NOT EXISTS undo_of int8 NULL;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'audit_log_undo_of_fk') THEN
+		ALTER TABLE v1.audit_log ADD CONSTRAINT audit_log_undo_of_fk FOREIGN KEY (undo_of) REFERENCES v1.audit_log(audit_id);
+	END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_log_undo_of_idx ON v1.audit_log (undo_of);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON v1.audit_log (actor_id, created_ts);
@@ -0,0 +1,32 @@
+-- Makes a book's identity, checked on create, unique per owner: title
+-- (ignoring case), author, edition and publish date. Concurrent creates of
+-- the same book can't both succeed. Books in the trash are left out.
+-- Existing duplicates are not merged here, so this fails while an owner
+-- still has any; run `goshelf dedupe -merge` first.
+DO $$
+DECLARE
+	duplicates integer;
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = 'v1' AND indexname = 'book_identity_un') THEN
+		SELECT count(*) INTO duplicates FROM (
+			SELECT 1 FROM v1.book
+			WHERE deleted_ts IS NULL
+			GROUP BY owner_id, author_id, lower(title),
+				COALESCE(edition, -1), COALESCE(publish_date, '-infinity'::timestamp)
+			HAVING count(*) > 1
+		) d;
+
+		IF duplicates > 0 THEN
+			RAISE EXCEPTION '% sets of books share a title, author, edition and publish date', duplicates
+				USING HINT = 'Run `goshelf dedupe -merge` to merge them, then apply this migration again.';
+		END IF;
+	END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS book_identity_un ON v1.book (
+	owner_id,
+	author_id,
+	lower(title),
+	COALESCE(edition, -1),
+	COALESCE(publish_date, '-infinity'::timestamp)
+) WHERE deleted_ts IS NULL;
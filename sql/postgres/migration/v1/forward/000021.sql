@@ -0,0 +1,4 @@
+-- Restores from the trash are recorded as their own action, with the item
+-- as it was in the trash before and as restored after.
+ALTER TABLE v1.audit_log DROP CONSTRAINT IF EXISTS audit_log_action_ck;
+ALTER TABLE v1.audit_log ADD CONSTRAINT audit_log_action_ck CHECK (action IN ('create', 'update', 'delete', 'restore'));
@@ -0,0 +1,4 @@
+-- Book merges are recorded as their own action on both books, so undo can
+-- skip them. The merged away book is kept in the trash.
+ALTER TABLE v1.audit_log DROP CONSTRAINT IF EXISTS audit_log_action_ck;
+ALTER TABLE v1.audit_log ADD CONSTRAINT audit_log_action_ck CHECK (action IN ('create', 'update', 'delete', 'restore', 'merge'));
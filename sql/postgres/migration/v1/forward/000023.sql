@@ -0,0 +1,4 @@
+-- Purges from the trash are recorded as their own action, with the item's
+-- last state before. The background purge has no actor.
+ALTER TABLE v1.audit_log DROP CONSTRAINT IF EXISTS audit_log_action_ck;
+ALTER TABLE v1.audit_log ADD CONSTRAINT audit_log_action_ck CHECK (action IN ('create', 'update', 'delete', 'restore', 'merge', 'purge'));